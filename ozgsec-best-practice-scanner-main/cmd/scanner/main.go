@@ -13,10 +13,12 @@ import (
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/lmittmann/tint"
+	"github.com/miekg/dns"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/viper"
 
@@ -61,6 +63,7 @@ type responseTransformer interface {
 
 type tlsClient interface {
 	Get(ctx context.Context, target *url.URL, tlsConfig *tls.Config) (net.Conn, error)
+	Dial(ctx context.Context, target *url.URL) (net.Conn, error)
 }
 
 type httpClient interface {
@@ -99,6 +102,11 @@ type config struct {
 	Refresh       bool                     `json:"refresh"`     // if true, the cache will be ignored
 	Socks5Proxy   string                   `json:"socks5Proxy"` // if set, the socks5 proxy will be used for the scan
 	EnabledChecks []scanner.AnalysisRuleId `json:"enabledChecks"`
+	Profile       string                   `json:"profile"` // name of a scan profile defined in the config file
+	// if true, the certificate details contain the PEM encoded certificates
+	IncludeCertificatePEM bool `json:"includeCertificatePEM"`
+	// if set, the mail checks use this domain instead of the registrable domain of the target
+	MailDomain string `json:"mailDomain"`
 }
 
 type rmqMessage struct {
@@ -229,6 +237,109 @@ func getDefaultChecks() map[scanner.AnalysisRuleId]bool {
 	return defaultEnabledChecks
 }
 
+// a scan profile is a named set of checks defined in the config file.
+// it can mark informational checks as required and select the key strength policy.
+type scanProfile struct {
+	EnabledChecks     []scanner.AnalysisRuleId `mapstructure:"enabledChecks"`
+	RequiredChecks    []scanner.AnalysisRuleId `mapstructure:"requiredChecks"`
+	KeyStrengthPolicy string                   `mapstructure:"keyStrengthPolicy"`
+}
+
+func getProfile(name string) (scanProfile, bool) {
+	if name == "" {
+		return scanProfile{}, false
+	}
+	var profiles map[string]scanProfile
+	if err := viper.UnmarshalKey("profiles", &profiles); err != nil {
+		slog.Warn("could not read scan profiles from config", "err", err)
+		return scanProfile{}, false
+	}
+	// viper does lowercase all keys
+	profile, ok := profiles[strings.ToLower(name)]
+	if !ok {
+		slog.Warn("unknown scan profile", "profile", name)
+	}
+	return profile, ok
+}
+
+// the dkim selectors can be configured in the config file.
+// the selectors of a domain are looked up in addition to the global selectors.
+type dkimConfig struct {
+	Selectors []string `mapstructure:"selectors"`
+	Domains   []struct {
+		Domain    string   `mapstructure:"domain"`
+		Selectors []string `mapstructure:"selectors"`
+	} `mapstructure:"domains"`
+}
+
+func getDKIMConfig() ([]string, map[string][]string) {
+	var dkim dkimConfig
+	if err := viper.UnmarshalKey("dkim", &dkim); err != nil {
+		slog.Warn("could not read dkim selectors from config", "err", err)
+		return nil, nil
+	}
+	// the selectors are looked up using the registrable domain of the mail domain
+	domainSelectors := make(map[string][]string)
+	for _, domain := range dkim.Domains {
+		name := scanner.RegistrableDomain(domain.Domain)
+		domainSelectors[name] = append(domainSelectors[name], domain.Selectors...)
+	}
+	return dkim.Selectors, domainSelectors
+}
+
+// the mapping of issuing CAs to their CAA issuer domains can be extended in the config file.
+// the issuer is matched case-insensitive against the organization and common name of the certificate issuer.
+type caaConfig struct {
+	Issuers []struct {
+		Issuer  string   `mapstructure:"issuer"`
+		Domains []string `mapstructure:"domains"`
+	} `mapstructure:"issuers"`
+}
+
+func getCAAIssuerDomains() map[string][]string {
+	var caa caaConfig
+	if err := viper.UnmarshalKey("caa", &caa); err != nil {
+		slog.Warn("could not read caa issuers from config", "err", err)
+		return nil
+	}
+	issuerDomains := make(map[string][]string)
+	for _, issuer := range caa.Issuers {
+		issuerDomains[issuer.Issuer] = append(issuerDomains[issuer.Issuer], issuer.Domains...)
+	}
+	return issuerDomains
+}
+
+// the subdomains, which are checked for dangling CNAMEs, can be configured in the config file.
+type takeoverConfig struct {
+	Domains []struct {
+		Domain     string   `mapstructure:"domain"`
+		Subdomains []string `mapstructure:"subdomains"`
+	} `mapstructure:"domains"`
+}
+
+func getTakeoverSubdomains() map[string][]string {
+	var takeover takeoverConfig
+	if err := viper.UnmarshalKey("takeover", &takeover); err != nil {
+		slog.Warn("could not read takeover subdomains from config", "err", err)
+		return nil
+	}
+	// the subdomains are looked up using the registrable domain of the target.
+	// a relative subdomain is resolved against the configured domain before.
+	subdomains := make(map[string][]string)
+	for _, domain := range takeover.Domains {
+		configured := strings.TrimSuffix(strings.ToLower(domain.Domain), ".")
+		name := scanner.RegistrableDomain(configured)
+		for _, subdomain := range domain.Subdomains {
+			subdomain = strings.TrimSuffix(strings.ToLower(subdomain), ".")
+			if subdomain != configured && !strings.HasSuffix(subdomain, "."+configured) {
+				subdomain += "." + configured
+			}
+			subdomains[name] = append(subdomains[name], subdomain)
+		}
+	}
+	return subdomains
+}
+
 func applyConfig(config config) scanner.TargetScanOptions {
 	c := globalCache
 	if config.Refresh {
@@ -266,21 +377,47 @@ func applyConfig(config config) scanner.TargetScanOptions {
 		})
 	}
 
+	profile, hasProfile := getProfile(config.Profile)
+
 	enabledChecksMap := make(map[scanner.AnalysisRuleId]bool)
 	if config.EnabledChecks != nil {
 		slog.Debug("enabled checks", "checks", config.EnabledChecks)
 		for _, check := range config.EnabledChecks {
 			enabledChecksMap[check] = true
 		}
+	} else if hasProfile && len(profile.EnabledChecks) > 0 {
+		slog.Debug("enabled checks from profile", "profile", config.Profile, "checks", profile.EnabledChecks)
+		for _, check := range profile.EnabledChecks {
+			enabledChecksMap[check] = true
+		}
 	} else {
 		enabledChecksMap = getDefaultChecks()
 	}
 
+	requiredChecksMap := make(map[scanner.AnalysisRuleId]bool)
+	for _, check := range profile.RequiredChecks {
+		requiredChecksMap[check] = true
+	}
+
+	dkimSelectors, domainDKIMSelectors := getDKIMConfig()
+
 	return scanner.TargetScanOptions{
-		CachingLayer:  c,
-		HttpClient:    httpClient,
-		TlsClient:     tlsClient,
-		EnabledChecks: enabledChecksMap,
+		CachingLayer:   c,
+		HttpClient:     httpClient,
+		TlsClient:      tlsClient,
+		EnabledChecks:  enabledChecksMap,
+		RequiredChecks: requiredChecksMap,
+
+		IncludeCertificatePEM: config.IncludeCertificatePEM,
+		KeyStrengthPolicy:     profile.KeyStrengthPolicy,
+
+		DKIMSelectors:       dkimSelectors,
+		DomainDKIMSelectors: domainDKIMSelectors,
+
+		CAAIssuerDomains:   getCAAIssuerDomains(),
+		TakeoverSubdomains: getTakeoverSubdomains(),
+
+		MailDomain: config.MailDomain,
 	}
 }
 
@@ -290,10 +427,18 @@ func parseQueryParams(u *url.URL) (string, scanner.TargetScanOptions) {
 	// if the socks5Proxy query parameter is set, it will be used as a proxy for the scanning process.
 	// this is helpful to avoid IP-Blocking etc.
 	socks5Proxy := u.Query().Get("socks5Proxy")
+	// if the profile query parameter is set, the checks of the scan profile are used
+	profile := u.Query().Get("profile")
+	includeCertificatePEM := u.Query().Get("includeCertificatePEM") == "true"
+	// if the mailDomain query parameter is set, the mail checks are executed against this domain
+	mailDomain := u.Query().Get("mailDomain")
 	return targetURI, applyConfig(config{
-		Target:      targetURI,
-		Refresh:     refresh,
-		Socks5Proxy: socks5Proxy,
+		Target:                targetURI,
+		Refresh:               refresh,
+		Socks5Proxy:           socks5Proxy,
+		Profile:               profile,
+		IncludeCertificatePEM: includeCertificatePEM,
+		MailDomain:            mailDomain,
 	})
 }
 
@@ -311,6 +456,11 @@ func handlerFactory(responseTransformer responseTransformer, sc webScanner, moni
 			w.Write([]byte("target parameter missing")) // nolint // if this fails, there is nothing we can do
 			return
 		}
+		if _, ok := dns.IsDomainName(targetScanOptions.MailDomain); targetScanOptions.MailDomain != "" && !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("mailDomain parameter is not a valid domain name")) // nolint // if this fails, there is nothing we can do
+			return
+		}
 		// do a simple http request to check what URL we are actually looking at
 		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 		defer cancel()
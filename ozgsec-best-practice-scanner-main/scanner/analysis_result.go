@@ -39,12 +39,22 @@ const (
 	STARTTLS AnalysisRuleId = "starttls"
 	DANE     AnalysisRuleId = "dane"
 
+	MTASTS AnalysisRuleId = "mtaSts"
+	TLSRPT AnalysisRuleId = "tlsRpt"
+
+	MXHygiene AnalysisRuleId = "mxHygiene"
+
 	SubResourceIntegrity AnalysisRuleId = "subResourceIntegrity"
 	NoMixedContent       AnalysisRuleId = "noMixedContent"
 
 	ResponsibleDisclosure AnalysisRuleId = "responsibleDisclosure"
 	DNSSec                AnalysisRuleId = "dnsSec"
 	CAA                   AnalysisRuleId = "caa"
+	Nameservers           AnalysisRuleId = "nameservers"
+	// sends recursive queries and AXFR requests to the nameservers - not part of AllChecks, needs to be enabled explicitly
+	NameserverProbes  AnalysisRuleId = "nameserverProbes"
+	SubdomainTakeover AnalysisRuleId = "subdomainTakeover"
+	HTTPSRecord       AnalysisRuleId = "httpsRecord"
 
 	IPv6 AnalysisRuleId = "ipv6"
 	RPKI AnalysisRuleId = "rpki"
@@ -66,16 +76,25 @@ const (
 	TLS13                    AnalysisRuleId = "tlsv1_3"
 	DeprecatedTLSDeactivated AnalysisRuleId = "deprecatedTLSDeactivated"
 
-	StrongKeyExchange  AnalysisRuleId = "strongKeyExchange"
-	StrongCipherSuites AnalysisRuleId = "strongCipherSuites"
+	StrongKeyExchange      AnalysisRuleId = "strongKeyExchange"
+	StrongCipherSuites     AnalysisRuleId = "strongCipherSuites"
+	PostQuantumKeyExchange AnalysisRuleId = "postQuantumKeyExchange"
+	TR03116Compliance      AnalysisRuleId = "tr03116Compliance"
 
 	ValidCertificate         AnalysisRuleId = "validCertificate"
 	StrongPrivateKey         AnalysisRuleId = "strongPrivateKey"
 	StrongSignatureAlgorithm AnalysisRuleId = "strongSignatureAlgorithm"
 	MatchesHostname          AnalysisRuleId = "matchesHostname"
+	CertificateKeyUsage      AnalysisRuleId = "certificateKeyUsage"
+	LimitedSubjectAltNames   AnalysisRuleId = "limitedSubjectAltNames"
+	DefaultCertificate       AnalysisRuleId = "defaultCertificate"
 	NotRevoked               AnalysisRuleId = "notRevoked"
 	CertificateTransparency  AnalysisRuleId = "certificateTransparency"
 	ValidCertificateChain    AnalysisRuleId = "validCertificateChain"
+
+	Heartbleed   AnalysisRuleId = "heartbleed"
+	CCSInjection AnalysisRuleId = "ccsInjection"
+	ROBOT        AnalysisRuleId = "robot"
 )
 
 var HttpBasedScans = []AnalysisRuleId{
@@ -110,6 +129,9 @@ var AllChecks = []AnalysisRuleId{
 	ResponsibleDisclosure,
 	DNSSec,
 	CAA,
+	Nameservers,
+	SubdomainTakeover,
+	HTTPSRecord,
 	IPv6,
 	RPKI,
 	HTTP,
@@ -118,6 +140,8 @@ var AllChecks = []AnalysisRuleId{
 	HTTPS,
 	StrongKeyExchange,
 	StrongCipherSuites,
+	PostQuantumKeyExchange,
+	TR03116Compliance,
 	TLS12,
 	TLS13,
 	DeprecatedTLSDeactivated,
@@ -125,6 +149,9 @@ var AllChecks = []AnalysisRuleId{
 	StrongPrivateKey,
 	StrongSignatureAlgorithm,
 	MatchesHostname,
+	CertificateKeyUsage,
+	LimitedSubjectAltNames,
+	DefaultCertificate,
 	NotRevoked,
 	CertificateTransparency,
 	ValidCertificateChain,
@@ -133,6 +160,27 @@ var AllChecks = []AnalysisRuleId{
 	SPF,
 	STARTTLS,
 	DANE,
+	MTASTS,
+	TLSRPT,
+	MXHygiene,
+}
+
+// informational checks are reported like every other check.
+// nevertheless a failure is only a hint - unless a scan profile marks the check as required.
+var InformationalChecks = []AnalysisRuleId{
+	PostQuantumKeyExchange,
+	TR03116Compliance,
+	LimitedSubjectAltNames,
+	DefaultCertificate,
+	HTTPSRecord,
+}
+
+// the vulnerability probes send malformed messages to the target.
+// they are not part of AllChecks and need to be enabled explicitly.
+var VulnerabilityProbes = []AnalysisRuleId{
+	Heartbleed,
+	CCSInjection,
+	ROBOT,
 }
 
 type AnalysisResult struct {
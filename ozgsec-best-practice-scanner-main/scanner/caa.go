@@ -0,0 +1,289 @@
+package scanner
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+const (
+	CAASyntaxError             = "caaSyntaxError"
+	CAAInvalidIodef            = "caaInvalidIodef"
+	CAAMissingIssue            = "caaMissingIssue"
+	CAAUnknownCriticalProperty = "caaUnknownCriticalProperty"
+	CAAUnauthorizedIssuer      = "caaUnauthorizedIssuer"
+
+	CAAIssuerNotMapped = "caaIssuerNotMapped"
+)
+
+// the property tags, which are known to the scanner (RFC8659 Section 4, RFC9495)
+var knownCAAProperties = []string{"issue", "issuewild", "iodef", "issuemail", "issuevmc", "contactemail", "contactphone"}
+
+var caaIssuerDomainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)+[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// maps the organization (or common name) of an issuing CA to the domains, which are used in the CAA issue property.
+// the keys are matched case-insensitive as substring - it can be extended using the scan options.
+var defaultCAAIssuerDomains = map[string][]string{
+	"Let's Encrypt":         {"letsencrypt.org"},
+	"DigiCert":              {"digicert.com", "symantec.com", "geotrust.com", "rapidssl.com", "thawte.com", "digitalcertvalidation.com"},
+	"GeoTrust":              {"digicert.com", "geotrust.com"},
+	"Thawte":                {"digicert.com", "thawte.com"},
+	"RapidSSL":              {"digicert.com", "rapidssl.com"},
+	"Sectigo":               {"sectigo.com", "comodoca.com", "comodo.com", "usertrust.com", "trust-provider.com"},
+	"COMODO":                {"sectigo.com", "comodoca.com", "comodo.com"},
+	"ZeroSSL":               {"sectigo.com", "zerossl.com"},
+	"GlobalSign":            {"globalsign.com"},
+	"Google Trust Services": {"pki.goog"},
+	"Amazon":                {"amazon.com", "amazontrust.com", "awstrust.com", "amazonaws.com"},
+	"Microsoft":             {"microsoft.com"},
+	"Entrust":               {"entrust.net"},
+	"GoDaddy":               {"godaddy.com", "starfieldtech.com"},
+	"Starfield":             {"godaddy.com", "starfieldtech.com"},
+	"D-TRUST":               {"d-trust.net"},
+	"T-Systems":             {"telesec.de"},
+	"Deutsche Telekom":      {"telesec.de"},
+	"Telekom Security":      {"telesec.de"},
+	"Buypass":               {"buypass.com", "buypass.no"},
+	"SwissSign":             {"swisssign.com"},
+	"HARICA":                {"harica.gr"},
+	"Hellenic Academic":     {"harica.gr"},
+	"Certum":                {"certum.pl", "certum.eu"},
+	"Asseco Data Systems":   {"certum.pl", "certum.eu"},
+	"Actalis":               {"actalis.it"},
+	"SSL Corporation":       {"ssl.com"},
+	"SSL.com":               {"ssl.com"},
+}
+
+// a parsed issue or issuewild property (RFC8659 Section 4.2)
+type caaIssuer struct {
+	// the domain of the CA - an empty domain forbids the issuance
+	Domain     string            `json:"domain"`
+	Parameters map[string]string `json:"parameters"`
+}
+
+type caaEvaluation struct {
+	// the domain, at which the relevant record set was found (RFC8659 Section 3)
+	Domain string `json:"domain"`
+	// the CNAME targets, which were followed by the resolver
+	Aliases   []string    `json:"aliases"`
+	Issue     []caaIssuer `json:"issue"`
+	IssueWild []caaIssuer `json:"issuewild"`
+	Iodef     []string    `json:"iodef"`
+	// the issuer of the served certificate - added after the tls handshake
+	Issuer           string   `json:"issuer,omitempty"`
+	IssuerDomains    []string `json:"issuerDomains,omitempty"`
+	IssuerAuthorized *bool    `json:"issuerAuthorized,omitempty"`
+}
+
+func validateIoDefProperty(value string) bool {
+	return strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "mailto:") || strings.HasPrefix(value, "https://")
+}
+
+// parses the value of an issue or issuewild property: <domain> [; <key>=<value>]*
+func parseCAAIssueValue(value string) (caaIssuer, bool) {
+	domain, parameters, _ := strings.Cut(value, ";")
+	issuer := caaIssuer{
+		Domain:     strings.ToLower(strings.TrimSpace(domain)),
+		Parameters: make(map[string]string),
+	}
+	if issuer.Domain != "" && !caaIssuerDomainPattern.MatchString(issuer.Domain) {
+		return issuer, false
+	}
+	for _, parameter := range strings.Split(parameters, ";") {
+		if strings.TrimSpace(parameter) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimSpace(parameter), "=")
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return issuer, false
+		}
+		issuer.Parameters[key] = value
+	}
+	return issuer, true
+}
+
+// climbs the dns tree until a CAA record set is found (RFC8659 Section 3).
+// CNAMEs are followed by the resolver - the CAA records of the alias target are part of the answer.
+func (d domainAnalyzer) relevantCAARecords(ctx context.Context, target Target) (string, []string, []*dns.CAA, error) {
+	for _, domain := range getAllSubdomainsFromTarget(target) {
+		msg, err := d.exchange(ctx, domain, dns.TypeCAA)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		if msg.Rcode != dns.RcodeSuccess && msg.Rcode != dns.RcodeNameError {
+			// a CA must not issue, if the lookup fails (RFC8659 Section 3)
+			return "", nil, nil, fmt.Errorf("dns lookup of %s failed: %s", domain, dns.RcodeToString[msg.Rcode])
+		}
+		aliases := make([]string, 0)
+		records := make([]*dns.CAA, 0)
+		for _, answer := range msg.Answer {
+			switch rr := answer.(type) {
+			case *dns.CNAME:
+				aliases = append(aliases, normalizeHostname(rr.Target))
+			case *dns.CAA:
+				records = append(records, rr)
+			}
+		}
+		if len(records) > 0 {
+			return domain, aliases, records, nil
+		}
+	}
+	return "", nil, nil, nil
+}
+
+/*
+REQUIRED: The "CAA" records are present - the relevant record set is searched by climbing the dns tree (RFC8659 Section 3).
+REQUIRED: The "CAA" "issue" (value not ";") and/ or "issuewild" properties are present and well-formed.
+REQUIRED: If the "CAA" "iodef" property is present (mailto: or https://), it is valid.
+REQUIRED: There is no unknown property with the critical flag.
+REQUIRED: The CA, which issued the served certificate, is authorized (checked after the tls handshake - see applyCAAIssuer).
+
+	Base Format: CAA <flags> <tag> <value>
+	Example: CAA 0 issue "letsencrypt.org"
+	Example: CAA 0 issue "ca1.example.net; account=230123"
+	Example: CAA 0 issuewild "letsencrypt.org"
+	Example: CAA 0 iodef "mailto:opensource@neuland-homeland.de"
+	Example: CAA 0 iodef "https://iodef.example.com/"
+	Bad Example: CAA 128 unknown "value"
+	Malformed Example: CAA 0 issue "%%%%%"
+
+Source: https://www.rfc-editor.org/rfc/rfc8659
+*/
+func (d domainAnalyzer) caa(ctx context.Context, target Target) AnalysisResult {
+	start := time.Now()
+	domain, aliases, records, err := d.relevantCAARecords(ctx, target)
+	if err != nil {
+		return NewAnalysisResult(Unknown, nil, nil, nil, time.Since(start))
+	}
+	if len(records) == 0 {
+		return NewAnalysisResult(Failure, nil, nil, nil, time.Since(start))
+	}
+
+	evaluation := caaEvaluation{
+		Domain:    domain,
+		Aliases:   aliases,
+		Issue:     make([]caaIssuer, 0),
+		IssueWild: make([]caaIssuer, 0),
+		Iodef:     make([]string, 0),
+	}
+	errors := make([]string, 0)
+	addError := func(errorId string) {
+		if !utils.Includes(errors, errorId) {
+			errors = append(errors, errorId)
+		}
+	}
+	for _, record := range records {
+		tag := strings.ToLower(record.Tag)
+		switch tag {
+		case "issue", "issuewild":
+			issuer, ok := parseCAAIssueValue(record.Value)
+			if !ok {
+				addError(CAASyntaxError)
+				continue
+			}
+			if tag == "issue" {
+				evaluation.Issue = append(evaluation.Issue, issuer)
+			} else {
+				evaluation.IssueWild = append(evaluation.IssueWild, issuer)
+			}
+		case "iodef":
+			evaluation.Iodef = append(evaluation.Iodef, record.Value)
+			if !validateIoDefProperty(record.Value) {
+				addError(CAAInvalidIodef)
+			}
+		default:
+			// a CA must not issue, if it does not understand a critical property (RFC8659 Section 4.1)
+			if record.Flag&128 != 0 && !utils.Includes(knownCAAProperties, tag) {
+				addError(CAAUnknownCriticalProperty)
+			}
+		}
+	}
+	if len(evaluation.Issue) == 0 && len(evaluation.IssueWild) == 0 && !utils.Includes(errors, CAASyntaxError) {
+		addError(CAAMissingIssue)
+	}
+
+	if len(errors) > 0 {
+		return NewAnalysisResult(Failure, evaluation, errors, nil, time.Since(start))
+	}
+	return NewAnalysisResult(Success, evaluation, nil, nil, time.Since(start))
+}
+
+// returns the CAA domains of the issuing CA. the configured mapping is used in addition to the default mapping.
+func caaIssuerDomains(issuer pkix.Name, configured map[string][]string) []string {
+	names := append(append([]string{}, issuer.Organization...), issuer.CommonName)
+	domains := make([]string, 0)
+	for _, mapping := range []map[string][]string{defaultCAAIssuerDomains, configured} {
+		for key, keyDomains := range mapping {
+			if !utils.Some(names, func(name string) bool { return strings.Contains(strings.ToLower(name), strings.ToLower(key)) }) {
+				continue
+			}
+			for _, domain := range keyDomains {
+				if domain = strings.ToLower(domain); !utils.Includes(domains, domain) {
+					domains = append(domains, domain)
+				}
+			}
+		}
+	}
+	return domains
+}
+
+// the actual value might be restored from the cache - it is converted using its json representation
+func caaEvaluationFromActualValue(actualValue any) (caaEvaluation, bool) {
+	var evaluation caaEvaluation
+	b, err := json.Marshal(actualValue)
+	if err != nil || actualValue == nil {
+		return evaluation, false
+	}
+	return evaluation, json.Unmarshal(b, &evaluation) == nil
+}
+
+// checks, if the CA, which issued the served certificate, is authorized by the CAA records (RFC8659 Section 4.2 and 4.3).
+// the CAA check is done by the domain analyzer, which does not have access to the tls connection state.
+func applyCAAIssuer(res map[AnalysisRuleId]AnalysisResult, target Target, state *tls.ConnectionState) {
+	result, ok := res[CAA]
+	if !ok || result.DidPass == Unknown || state == nil || len(state.PeerCertificates) == 0 {
+		return
+	}
+	evaluation, ok := caaEvaluationFromActualValue(result.ActualValue)
+	if !ok {
+		return
+	}
+
+	leaf := state.PeerCertificates[0]
+	evaluation.Issuer = leaf.Issuer.String()
+	evaluation.IssuerDomains = caaIssuerDomains(leaf.Issuer, target.Options.CAAIssuerDomains)
+	result.ActualValue = evaluation
+	if len(evaluation.IssuerDomains) == 0 {
+		result.Recommendations = append(result.Recommendations, CAAIssuerNotMapped)
+		res[CAA] = result
+		return
+	}
+
+	// issuewild takes precedence for wildcard certificates
+	hostname := strings.ToLower(target.URL.Hostname())
+	wildcard := !utils.Some(leaf.DNSNames, func(name string) bool { return strings.EqualFold(name, hostname) })
+	properties := evaluation.Issue
+	if wildcard && len(evaluation.IssueWild) > 0 {
+		properties = evaluation.IssueWild
+	}
+	// without a property, the issuance is not restricted
+	authorized := len(properties) == 0 || utils.Some(properties, func(issuer caaIssuer) bool {
+		return issuer.Domain != "" && utils.Includes(evaluation.IssuerDomains, issuer.Domain)
+	})
+	evaluation.IssuerAuthorized = &authorized
+	result.ActualValue = evaluation
+	if !authorized {
+		result.DidPass = Failure
+		result.Errors = append(result.Errors, CAAUnauthorizedIssuer)
+	}
+	res[CAA] = result
+}
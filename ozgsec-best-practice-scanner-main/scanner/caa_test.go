@@ -0,0 +1,251 @@
+package scanner
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+func TestParseCAAIssueValue(t *testing.T) {
+	table := []struct {
+		value              string
+		expectedDomain     string
+		expectedParameters map[string]string
+		valid              bool
+	}{
+		{"letsencrypt.org", "letsencrypt.org", map[string]string{}, true},
+		{" LetsEncrypt.org ", "letsencrypt.org", map[string]string{}, true},
+		{";", "", map[string]string{}, true},
+		{"ca1.example.net; account=230123; validationmethods=dns-01", "ca1.example.net", map[string]string{"account": "230123", "validationmethods": "dns-01"}, true},
+		{"%%%%%", "", nil, false},
+		{"ca1.example.net; account", "", nil, false},
+	}
+
+	for _, test := range table {
+		t.Run(test.value, func(t *testing.T) {
+			actual, ok := parseCAAIssueValue(test.value)
+			if ok != test.valid {
+				t.Fatalf("Expected valid to be %v, got %v", test.valid, ok)
+			}
+			if !ok {
+				return
+			}
+			if actual.Domain != test.expectedDomain {
+				t.Errorf("Expected domain %s, got %s", test.expectedDomain, actual.Domain)
+			}
+			for key, value := range test.expectedParameters {
+				if actual.Parameters[key] != value {
+					t.Errorf("Expected parameter %s to be %s, got %s", key, value, actual.Parameters[key])
+				}
+			}
+		})
+	}
+}
+
+func TestCAA(t *testing.T) {
+	table := []struct {
+		name            string
+		records         map[string][]dns.RR
+		expectedDidPass DidPass
+		expectedDomain  string
+		expectedErrors  []string
+	}{
+		{
+			name:            "no records",
+			records:         map[string][]dns.RR{},
+			expectedDidPass: Failure,
+		},
+		{
+			name:            "records at the hostname",
+			records:         testRecords(t, `www.example.test. 3600 IN CAA 0 issue "letsencrypt.org"`, `example.test. 3600 IN CAA 0 issue "digicert.com"`),
+			expectedDidPass: Success,
+			expectedDomain:  "www.example.test",
+		},
+		{
+			name:            "records at the parent",
+			records:         testRecords(t, `example.test. 3600 IN CAA 0 issue "letsencrypt.org"`, `example.test. 3600 IN CAA 0 iodef "mailto:security@example.test"`),
+			expectedDidPass: Success,
+			expectedDomain:  "example.test",
+		},
+		{
+			name: "records of the alias target",
+			records: map[string][]dns.RR{
+				"www.example.test./CAA": {
+					mustNewRR(t, "www.example.test. 3600 IN CNAME cdn.example.net."),
+					mustNewRR(t, `cdn.example.net. 3600 IN CAA 0 issue "pki.goog"`),
+				},
+			},
+			expectedDidPass: Success,
+			expectedDomain:  "www.example.test",
+		},
+		{
+			name:            "malformed issue",
+			records:         testRecords(t, `example.test. 3600 IN CAA 0 issue "%%%%%"`),
+			expectedDidPass: Failure,
+			expectedDomain:  "example.test",
+			expectedErrors:  []string{CAASyntaxError},
+		},
+		{
+			name:            "invalid iodef",
+			records:         testRecords(t, `example.test. 3600 IN CAA 0 issue "letsencrypt.org"`, `example.test. 3600 IN CAA 0 iodef "security@example.test"`),
+			expectedDidPass: Failure,
+			expectedDomain:  "example.test",
+			expectedErrors:  []string{CAAInvalidIodef},
+		},
+		{
+			name:            "unknown critical property",
+			records:         testRecords(t, `example.test. 3600 IN CAA 0 issue "letsencrypt.org"`, `example.test. 3600 IN CAA 128 unknown "value"`),
+			expectedDidPass: Failure,
+			expectedDomain:  "example.test",
+			expectedErrors:  []string{CAAUnknownCriticalProperty},
+		},
+		{
+			name:            "unknown non-critical property",
+			records:         testRecords(t, `example.test. 3600 IN CAA 0 issue "letsencrypt.org"`, `example.test. 3600 IN CAA 0 unknown "value"`),
+			expectedDidPass: Success,
+			expectedDomain:  "example.test",
+		},
+		{
+			name:            "missing issue",
+			records:         testRecords(t, `example.test. 3600 IN CAA 0 iodef "mailto:security@example.test"`),
+			expectedDidPass: Failure,
+			expectedDomain:  "example.test",
+			expectedErrors:  []string{CAAMissingIssue},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			d := domainAnalyzer{
+				client:   new(dns.Client),
+				resolver: startTestResolver(t, test.records, nil),
+			}
+			target, _ := url.Parse("https://www.example.test")
+			actual := d.caa(context.Background(), Target{URL: target})
+
+			if test.expectedDidPass == Success && !actual.IsSuccess() || test.expectedDidPass == Failure && !actual.IsError() {
+				t.Fatalf("Expected %v, got %+v", *test.expectedDidPass, actual)
+			}
+			if len(actual.Errors) != len(test.expectedErrors) || !utils.IncludesSubset(actual.Errors, test.expectedErrors) {
+				t.Errorf("Expected errors %v, got %v", test.expectedErrors, actual.Errors)
+			}
+			if test.expectedDomain != "" {
+				evaluation, ok := caaEvaluationFromActualValue(actual.ActualValue)
+				if !ok || evaluation.Domain != test.expectedDomain {
+					t.Errorf("Expected domain %s, got %+v", test.expectedDomain, actual.ActualValue)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyCAAIssuer(t *testing.T) {
+	ca := newTestCA(t, "Let's Encrypt R3", nil)
+	unknownCA := newTestCA(t, "Unknown CA", nil)
+	exact := issueTestCertificate(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "www.example.test"},
+		DNSNames: []string{"www.example.test"},
+	}, &ca)
+	wildcard := issueTestCertificate(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "*.example.test"},
+		DNSNames: []string{"*.example.test"},
+	}, &ca)
+	unmapped := issueTestCertificate(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "www.example.test"},
+		DNSNames: []string{"www.example.test"},
+	}, &unknownCA)
+
+	table := []struct {
+		name                    string
+		evaluation              caaEvaluation
+		cert                    *x509.Certificate
+		issuerDomains           map[string][]string
+		expectedDidPass         DidPass
+		expectedErrors          []string
+		expectedRecommendations []string
+	}{
+		{
+			name:            "authorized",
+			evaluation:      caaEvaluation{Issue: []caaIssuer{{Domain: "letsencrypt.org"}}},
+			cert:            exact.cert,
+			expectedDidPass: Success,
+		},
+		{
+			name:            "not authorized",
+			evaluation:      caaEvaluation{Issue: []caaIssuer{{Domain: "digicert.com"}}},
+			cert:            exact.cert,
+			expectedDidPass: Failure,
+			expectedErrors:  []string{CAAUnauthorizedIssuer},
+		},
+		{
+			name:            "issuance forbidden",
+			evaluation:      caaEvaluation{Issue: []caaIssuer{{Domain: ""}}},
+			cert:            exact.cert,
+			expectedDidPass: Failure,
+			expectedErrors:  []string{CAAUnauthorizedIssuer},
+		},
+		{
+			name:            "issuewild is used for wildcard certificates",
+			evaluation:      caaEvaluation{Issue: []caaIssuer{{Domain: "letsencrypt.org"}}, IssueWild: []caaIssuer{{Domain: ""}}},
+			cert:            wildcard.cert,
+			expectedDidPass: Failure,
+			expectedErrors:  []string{CAAUnauthorizedIssuer},
+		},
+		{
+			name:            "issuewild is ignored for other certificates",
+			evaluation:      caaEvaluation{Issue: []caaIssuer{{Domain: "letsencrypt.org"}}, IssueWild: []caaIssuer{{Domain: ""}}},
+			cert:            exact.cert,
+			expectedDidPass: Success,
+		},
+		{
+			name:            "issuewild does not restrict other certificates",
+			evaluation:      caaEvaluation{IssueWild: []caaIssuer{{Domain: "letsencrypt.org"}}},
+			cert:            exact.cert,
+			expectedDidPass: Success,
+		},
+		{
+			name:                    "issuer not mapped",
+			evaluation:              caaEvaluation{Issue: []caaIssuer{{Domain: "ca.example.net"}}},
+			cert:                    unmapped.cert,
+			expectedDidPass:         Success,
+			expectedRecommendations: []string{CAAIssuerNotMapped},
+		},
+		{
+			name:            "configured issuer mapping",
+			evaluation:      caaEvaluation{Issue: []caaIssuer{{Domain: "ca.example.net"}}},
+			cert:            unmapped.cert,
+			issuerDomains:   map[string][]string{"unknown ca": {"ca.example.net"}},
+			expectedDidPass: Success,
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			target, _ := url.Parse("https://www.example.test")
+			res := map[AnalysisRuleId]AnalysisResult{
+				CAA: NewAnalysisResult(Success, test.evaluation, nil, nil, 0),
+			}
+			applyCAAIssuer(res, Target{URL: target, Options: TargetScanOptions{CAAIssuerDomains: test.issuerDomains}}, &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{test.cert},
+			})
+
+			actual := res[CAA]
+			if test.expectedDidPass == Success && !actual.IsSuccess() || test.expectedDidPass == Failure && !actual.IsError() {
+				t.Fatalf("Expected %v, got %+v", *test.expectedDidPass, actual)
+			}
+			if len(actual.Errors) != len(test.expectedErrors) || !utils.IncludesSubset(actual.Errors, test.expectedErrors) {
+				t.Errorf("Expected errors %v, got %v", test.expectedErrors, actual.Errors)
+			}
+			if len(actual.Recommendations) != len(test.expectedRecommendations) || !utils.IncludesSubset(actual.Recommendations, test.expectedRecommendations) {
+				t.Errorf("Expected recommendations %v, got %v", test.expectedRecommendations, actual.Recommendations)
+			}
+		})
+	}
+}
@@ -4,16 +4,30 @@ import (
 	"context"
 	"crypto/dsa" // nolint: staticcheck // dsa is needed for the rsa.PublicKey type switch
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/asn1"
-	"io"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
 	"log/slog"
+	"math"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"golang.org/x/crypto/ocsp"
+
 	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/cache"
 	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/concurrency"
 
@@ -21,10 +35,131 @@ import (
 )
 
 type certificateAnalyzer struct {
+	trustStore trustStore
+	ctLogs     ctLogList
+}
+
+const (
+	UnknownAuthority          = "unknownAuthority"
+	MissingIntermediate       = "missingIntermediate"
+	ExpiredCertificateInChain = "expiredCertificateInChain"
+	NotAuthorizedToSign       = "notAuthorizedToSign"
+	InvalidCertificateInChain = "invalidCertificateInChain"
+	ExpiresSoon               = "expiresSoon"
+	LifetimeExceedsMaximum    = "lifetimeExceedsMaximum"
+)
+
+const (
+	MissingDigitalSignature = "missingDigitalSignature"
+	KeyUsageNotAllowed      = "keyUsageNotAllowed"
+	MissingServerAuth       = "missingServerAuth"
+	MissingExtendedKeyUsage = "missingExtendedKeyUsage"
+	LeafIsCA                = "leafIsCA"
+	WildcardSubjectAltName  = "wildcardSubjectAltName"
+	TooManySubjectAltNames  = "tooManySubjectAltNames"
+)
+
+// the maximum number of intermediates, which are fetched using the authority information access extension
+const maxMissingIntermediates = 3
+
+// trustStore contains the roots used for the path building.
+// besides the system roots, a custom PEM encoded CA bundle can be configured (e.g. the German government PKI).
+type trustStore struct {
+	roots       *x509.CertPool
+	customRoots []*x509.Certificate
+}
+
+func (t trustStore) isCustom(cert *x509.Certificate) bool {
+	return utils.Some(t.customRoots, func(custom *x509.Certificate) bool {
+		return custom.Equal(cert)
+	})
+}
+
+// path to a PEM encoded CA bundle, which is trusted in addition to the system roots
+var trustStoreCABundle = os.Getenv("TRUST_STORE_CA_BUNDLE")
+
+func newTrustStore(caBundlePath string) (trustStore, error) {
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		slog.Warn("could not load system cert pool - using an empty pool", "err", err)
+		roots = x509.NewCertPool()
+	}
+	if caBundlePath == "" {
+		return trustStore{roots: roots}, nil
+	}
+
+	bundle, err := os.ReadFile(caBundlePath)
+	if err != nil {
+		return trustStore{roots: roots}, err
+	}
+	customRoots := make([]*x509.Certificate, 0)
+	for block, rest := pem.Decode(bundle); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return trustStore{roots: roots}, err
+		}
+		roots.AddCert(cert)
+		customRoots = append(customRoots, cert)
+	}
+	return trustStore{roots: roots, customRoots: customRoots}, nil
 }
 
 func NewCertificateAnalyzer() analyzer[*tls.ConnectionState] {
-	return &certificateAnalyzer{}
+	trustStore, err := newTrustStore(trustStoreCABundle)
+	if err != nil {
+		slog.Error("could not load custom ca bundle - using the system roots only", "path", trustStoreCABundle, "err", err)
+	}
+	ctLogs, err := loadCTLogList(ctLogListPath)
+	if err != nil {
+		slog.Error("could not load ct log list - signed certificate timestamps cannot be verified", "path", ctLogListPath, "err", err)
+	}
+	return &certificateAnalyzer{
+		trustStore: trustStore,
+		ctLogs:     ctLogs,
+	}
+}
+
+// the number of days before the expiry of a certificate, in which a recommendation is added
+var certificateExpiryWarningDays = parseCertificateExpiryWarningDays(os.Getenv("CERTIFICATE_EXPIRY_WARNING_DAYS"))
+
+func parseCertificateExpiryWarningDays(value string) int {
+	if value == "" {
+		return 30
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 {
+		slog.Warn("could not parse CERTIFICATE_EXPIRY_WARNING_DAYS - using 30 days as fallback", "value", value)
+		return 30
+	}
+	return days
+}
+
+type maximumLifetime struct {
+	issuedBefore time.Time
+	days         int
+}
+
+// maximum validity period of a tls server certificate according to the CA/Browser Forum Baseline Requirements.
+// the maximum depends on the date of issuance (Ballot SC-081).
+// REF: https://cabforum.org/working-groups/server/baseline-requirements/requirements/#632-certificate-operational-periods-and-key-pair-usage-periods
+var cabForumMaximumLifetimes = []maximumLifetime{
+	{issuedBefore: time.Date(2026, time.March, 15, 0, 0, 0, 0, time.UTC), days: 398},
+	{issuedBefore: time.Date(2027, time.March, 15, 0, 0, 0, 0, time.UTC), days: 200},
+	{issuedBefore: time.Date(2029, time.March, 15, 0, 0, 0, 0, time.UTC), days: 100},
+}
+
+const cabForumFinalMaximumLifetime = 47
+
+func cabForumMaximumLifetimeDays(notBefore time.Time) int {
+	for _, lifetime := range cabForumMaximumLifetimes {
+		if notBefore.Before(lifetime.issuedBefore) {
+			return lifetime.days
+		}
+	}
+	return cabForumFinalMaximumLifetime
 }
 
 /*
@@ -34,23 +169,89 @@ IMMEDIATE ACTION REQUIRED CHECK
 
 REQUIRED: Certificate is not expired
 REQUIRED: The certificates validity period does NOT start in the future
+RECOMMENDED: Certificate does not expire within the configured warning window (CERTIFICATE_EXPIRY_WARNING_DAYS)
+RECOMMENDED: The validity period does not exceed the maximum of the CA/Browser Forum Baseline Requirements
 */
 func validCertificate(cert *x509.Certificate) AnalysisResult {
 	start := time.Now()
+	// the validity period is inclusive - therefore one second is added
+	lifetimeDays := int(math.Ceil((cert.NotAfter.Sub(cert.NotBefore) + time.Second).Hours() / 24))
+	actualValue := map[string]any{
+		"notBefore":     cert.NotBefore.UTC().Format(time.RFC3339),
+		"notAfter":      cert.NotAfter.UTC().Format(time.RFC3339),
+		"daysRemaining": int(math.Floor(time.Until(cert.NotAfter).Hours() / 24)),
+		"lifetimeDays":  lifetimeDays,
+	}
+
 	// check if the cert is expired
 	if cert.NotAfter.Before(time.Now()) {
-		return NewAnalysisResult(Failure, map[string]any{
-			"expired": true,
-		}, nil, nil, time.Since(start))
+		actualValue["expired"] = true
+		return NewAnalysisResult(Failure, actualValue, nil, nil, time.Since(start))
 	}
 	// check if the cert is not yet valid
 	if cert.NotBefore.After(time.Now()) {
-		return NewAnalysisResult(Failure, map[string]any{
-			"notYetValid": true,
-		}, nil, nil, time.Since(start))
+		actualValue["notYetValid"] = true
+		return NewAnalysisResult(Failure, actualValue, nil, nil, time.Since(start))
 	}
 
-	return NewAnalysisResult(Success, nil, nil, nil, time.Since(start))
+	recommendations := make([]string, 0)
+	if time.Until(cert.NotAfter) < time.Duration(certificateExpiryWarningDays)*24*time.Hour {
+		recommendations = append(recommendations, ExpiresSoon)
+	}
+	// the baseline requirements do only apply to leaf certificates
+	if !cert.IsCA && lifetimeDays > cabForumMaximumLifetimeDays(cert.NotBefore) {
+		recommendations = append(recommendations, LifetimeExceedsMaximum)
+	}
+
+	return NewAnalysisResult(Success, actualValue, nil, recommendations, time.Since(start))
+}
+
+// fetches the certificate of the issuer using the authority information access extension.
+// the response is either a single DER encoded certificate or PEM encoded.
+func fetchIssuingCertificate(ctx context.Context, client httpClient, cert *x509.Certificate) (*x509.Certificate, error) {
+	for _, issuingCertificateURL := range cert.IssuingCertificateURL {
+		u, err := url.Parse(issuingCertificateURL)
+		if err != nil {
+			continue
+		}
+		resp, err := client.Get(ctx, u)
+		if err != nil {
+			continue
+		}
+		body, err := resp.ResponseBody()
+		if err != nil {
+			continue
+		}
+		if block, _ := pem.Decode(body); block != nil {
+			body = block.Bytes
+		}
+		issuer, err := x509.ParseCertificate(body)
+		if err != nil {
+			continue
+		}
+		return issuer, nil
+	}
+	return nil, fmt.Errorf("could not fetch issuing certificate of %s", cert.Subject.String())
+}
+
+func chainVerificationErrorId(err error) string {
+	var unknownAuthorityError x509.UnknownAuthorityError
+	var certificateInvalidError x509.CertificateInvalidError
+	switch {
+	case errors.As(err, &unknownAuthorityError):
+		return UnknownAuthority
+	case errors.As(err, &certificateInvalidError):
+		switch certificateInvalidError.Reason {
+		case x509.Expired:
+			return ExpiredCertificateInChain
+		case x509.NotAuthorizedToSign:
+			return NotAuthorizedToSign
+		default:
+			return InvalidCertificateInChain
+		}
+	default:
+		return InvalidCertificateInChain
+	}
 }
 
 /*
@@ -58,60 +259,77 @@ IMMEDIATE ACTION REQUIRED CHECK
 
 	(if a REQUIRED spec is not met, the call to immediate action MUST be shown to the user)
 
-REQUIRED: The certificate chain is valid (all certificates are signed by the issuer) according
+REQUIRED: The certificate chain is valid according to: https://datatracker.ietf.org/doc/html/rfc5280#section-6.1
 
-	to: https://datatracker.ietf.org/doc/html/rfc5280#section-6.1
-	Stating:
-	  (a)  for all x in {1, ..., n-1}, the subject of certificate x is
-	       the issuer of certificate x+1;
-	  (b)  certificate 1 is issued by the trust anchor;
-	  (c)  certificate n is the certificate to be validated (i.e., the
-	       target certificate); and
-	  (d)  for all x in {1, ..., n}, the certificate was valid at the
-	       time in question.
+	The path is built using x509.Verify against the system roots and the optional custom trust store.
+	The served chain needs to be complete. If an intermediate is missing, it is fetched using the
+	authority information access extension to report it - but the check still fails.
 
 	Note: The RFC includes checks that the certificate MUST NOT be revoked through OCSP or CRL.
 	  This is not checked here. There will be an indipendent check for this.
 */
-func validCertificateChain(certs []*x509.Certificate) AnalysisResult {
+func (c certificateAnalyzer) validCertificateChain(ctx context.Context, target Target, certs []*x509.Certificate) AnalysisResult {
 	start := time.Now()
-	// inspect the whole chain of certificates
-	for i := 0; i < len(certs)-1; i++ {
-		if certs[i].Issuer.CommonName != certs[i+1].Subject.CommonName {
-			return NewAnalysisResult(Failure, nil, nil, nil, time.Since(start))
-		}
-		// check that the cert is not yet expired
-		if certs[i].NotAfter.Before(time.Now()) {
-			return NewAnalysisResult(Failure, map[string]any{
-				"expired": true,
-			}, nil, nil, time.Since(start))
-		}
-		// check that the cert is not yet valid
-		if certs[i].NotBefore.After(time.Now()) {
-			return NewAnalysisResult(Failure, map[string]any{
-				"notYetValid": true,
-			}, nil, nil, time.Since(start))
-		}
 
-		// verify the signature
-		if err := certs[i].CheckSignatureFrom(certs[i+1]); err != nil {
-			return NewAnalysisResult(Failure, nil, nil, nil, time.Since(start))
-		}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
 	}
-	// check that the root cert is not yet expired
-	if certs[len(certs)-1].NotAfter.Before(time.Now()) {
-		return NewAnalysisResult(Failure, map[string]any{
-			"expired": true,
-		}, nil, nil, time.Since(start))
+
+	verifyOptions := x509.VerifyOptions{
+		Roots:         c.trustStore.roots,
+		Intermediates: intermediates,
+		// the key usage of the leaf is an independent check
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
 	}
-	// check that the root cert is not yet valid
-	if certs[len(certs)-1].NotBefore.After(time.Now()) {
-		return NewAnalysisResult(Failure, map[string]any{
-			"notYetValid": true,
+
+	chains, err := certs[0].Verify(verifyOptions)
+	if err == nil {
+		anchor := chains[0][len(chains[0])-1]
+		return NewAnalysisResult(Success, map[string]any{
+			"chain": utils.Map(chains[0], func(cert *x509.Certificate) string {
+				return cert.Subject.String()
+			}),
+			"anchor":               anchor.Subject.String(),
+			"customTrustAnchor":    c.trustStore.isCustom(anchor),
+			"missingIntermediates": []string{},
 		}, nil, nil, time.Since(start))
 	}
 
-	return NewAnalysisResult(Success, nil, nil, nil, time.Since(start))
+	actualValue := map[string]any{
+		"validationError":      err.Error(),
+		"missingIntermediates": []string{},
+	}
+
+	var unknownAuthorityError x509.UnknownAuthorityError
+	if !errors.As(err, &unknownAuthorityError) || target.Options.HttpClient == nil {
+		return NewAnalysisResult(Failure, actualValue, []string{chainVerificationErrorId(err)}, nil, time.Since(start))
+	}
+
+	// the chain might be incomplete - try to fetch the missing intermediates.
+	// this is what some browsers do as well, but we still report it as an error.
+	missingIntermediates := make([]*x509.Certificate, 0)
+	last := certs[len(certs)-1]
+	for i := 0; i < maxMissingIntermediates; i++ {
+		issuer, fetchErr := fetchIssuingCertificate(ctx, target.Options.HttpClient, last)
+		if fetchErr != nil {
+			break
+		}
+		missingIntermediates = append(missingIntermediates, issuer)
+		intermediates.AddCert(issuer)
+		if chains, err := certs[0].Verify(verifyOptions); err == nil {
+			anchor := chains[0][len(chains[0])-1]
+			actualValue["anchor"] = anchor.Subject.String()
+			actualValue["customTrustAnchor"] = c.trustStore.isCustom(anchor)
+			actualValue["missingIntermediates"] = utils.Map(missingIntermediates, func(cert *x509.Certificate) string {
+				return cert.Subject.String()
+			})
+			return NewAnalysisResult(Failure, actualValue, []string{MissingIntermediate}, nil, time.Since(start))
+		}
+		last = issuer
+	}
+
+	return NewAnalysisResult(Failure, actualValue, []string{chainVerificationErrorId(err)}, nil, time.Since(start))
 }
 
 /*
@@ -142,54 +360,328 @@ func matchesHostname(cert *x509.Certificate, hostname string) AnalysisResult {
 	return NewAnalysisResult(Success, nil, nil, nil, time.Since(start))
 }
 
-func isStrongPrivateKey(cert *x509.Certificate) AnalysisResult {
+var (
+	keyUsageExtensionOID    = asn1.ObjectIdentifier{2, 5, 29, 15}
+	extKeyUsageExtensionOID = asn1.ObjectIdentifier{2, 5, 29, 37}
+)
+
+var keyUsageNames = []struct {
+	usage x509.KeyUsage
+	name  string
+}{
+	{x509.KeyUsageDigitalSignature, "digitalSignature"},
+	{x509.KeyUsageContentCommitment, "contentCommitment"},
+	{x509.KeyUsageKeyEncipherment, "keyEncipherment"},
+	{x509.KeyUsageDataEncipherment, "dataEncipherment"},
+	{x509.KeyUsageKeyAgreement, "keyAgreement"},
+	{x509.KeyUsageCertSign, "keyCertSign"},
+	{x509.KeyUsageCRLSign, "cRLSign"},
+	{x509.KeyUsageEncipherOnly, "encipherOnly"},
+	{x509.KeyUsageDecipherOnly, "decipherOnly"},
+}
+
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:             "any",
+	x509.ExtKeyUsageServerAuth:      "serverAuth",
+	x509.ExtKeyUsageClientAuth:      "clientAuth",
+	x509.ExtKeyUsageCodeSigning:     "codeSigning",
+	x509.ExtKeyUsageEmailProtection: "emailProtection",
+	x509.ExtKeyUsageTimeStamping:    "timeStamping",
+	x509.ExtKeyUsageOCSPSigning:     "ocspSigning",
+}
+
+func hasExtension(cert *x509.Certificate, oid asn1.ObjectIdentifier) bool {
+	return utils.Some(cert.Extensions, func(extension pkix.Extension) bool {
+		return extension.Id.Equal(oid)
+	})
+}
+
+/*
+REQUIRED: The leaf certificate can be used as a TLS server certificate
+
+	KeyUsage: if present, it contains digitalSignature. keyEncipherment is only allowed for RSA keys. keyCertSign and cRLSign are not allowed.
+	An RSA key with keyEncipherment but without digitalSignature is only usable for the RSA key exchange - it is reported as recommendation.
+	ExtendedKeyUsage: it is present and contains serverAuth (or anyExtendedKeyUsage).
+	BasicConstraints: the leaf is not a CA.
+
+Source: https://datatracker.ietf.org/doc/html/rfc5280#section-4.2.1.3 and https://cabforum.org/working-groups/server/baseline-requirements/ (Section 7.1.2.7)
+*/
+func certificateKeyUsage(cert *x509.Certificate) AnalysisResult {
+	start := time.Now()
+	keyUsages := make([]string, 0)
+	for _, keyUsage := range keyUsageNames {
+		if cert.KeyUsage&keyUsage.usage != 0 {
+			keyUsages = append(keyUsages, keyUsage.name)
+		}
+	}
+	extKeyUsages := utils.Map(cert.ExtKeyUsage, func(usage x509.ExtKeyUsage) string {
+		if name, ok := extKeyUsageNames[usage]; ok {
+			return name
+		}
+		return fmt.Sprintf("unknown(%d)", usage)
+	})
+	for _, oid := range cert.UnknownExtKeyUsage {
+		extKeyUsages = append(extKeyUsages, oid.String())
+	}
+
+	actualValue := map[string]any{
+		"keyUsage":              keyUsages,
+		"extKeyUsage":           extKeyUsages,
+		"basicConstraintsValid": cert.BasicConstraintsValid,
+		"isCA":                  cert.IsCA,
+	}
+
+	errorIds := make([]string, 0)
+	recommendations := make([]string, 0)
+	if hasExtension(cert, keyUsageExtensionOID) {
+		_, isRSA := cert.PublicKey.(*rsa.PublicKey)
+		if cert.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+			// the RSA key exchange only needs keyEncipherment - digitalSignature is required for ECDHE and TLS 1.3
+			if isRSA && cert.KeyUsage&x509.KeyUsageKeyEncipherment != 0 {
+				recommendations = append(recommendations, MissingDigitalSignature)
+			} else {
+				errorIds = append(errorIds, MissingDigitalSignature)
+			}
+		}
+		if cert.KeyUsage&(x509.KeyUsageCertSign|x509.KeyUsageCRLSign) != 0 || (!isRSA && cert.KeyUsage&x509.KeyUsageKeyEncipherment != 0) {
+			errorIds = append(errorIds, KeyUsageNotAllowed)
+		}
+	}
+
+	if !hasExtension(cert, extKeyUsageExtensionOID) {
+		errorIds = append(errorIds, MissingExtendedKeyUsage)
+	} else if !utils.Includes(cert.ExtKeyUsage, x509.ExtKeyUsageServerAuth) && !utils.Includes(cert.ExtKeyUsage, x509.ExtKeyUsageAny) {
+		errorIds = append(errorIds, MissingServerAuth)
+	}
+
+	if cert.IsCA {
+		errorIds = append(errorIds, LeafIsCA)
+	}
+
+	if len(errorIds) > 0 {
+		return NewAnalysisResult(Failure, actualValue, errorIds, recommendations, time.Since(start))
+	}
+	return NewAnalysisResult(Success, actualValue, nil, recommendations, time.Since(start))
+}
+
+// the number of subject alternative names, from which on a certificate is flagged
+var certificateMaxSubjectAltNames = parseCertificateMaxSubjectAltNames(os.Getenv("CERTIFICATE_MAX_SUBJECT_ALT_NAMES"))
+
+func parseCertificateMaxSubjectAltNames(value string) int {
+	if value == "" {
+		return 100
+	}
+	maxSANs, err := strconv.Atoi(value)
+	if err != nil || maxSANs < 1 {
+		slog.Warn("could not parse CERTIFICATE_MAX_SUBJECT_ALT_NAMES - using 100 as fallback", "value", value)
+		return 100
+	}
+	return maxSANs
+}
+
+/*
+INFORMATIONAL CHECK
+
+	(the check does not fail a scan, unless it is marked as required inside a scan profile)
+
+RECOMMENDED: The certificate does not contain wildcard names
+RECOMMENDED: The certificate does not contain more subject alternative names than CERTIFICATE_MAX_SUBJECT_ALT_NAMES (default: 100)
+
+	A wildcard certificate or a large shared certificate (e.g. of a CDN) spreads the impact of a compromised key to many services.
+*/
+func limitedSubjectAltNames(cert *x509.Certificate, maxSubjectAltNames int) AnalysisResult {
+	start := time.Now()
+	sans := subjectAltNames(cert)
+	wildcardNames := utils.Filter(cert.DNSNames, func(name string) bool {
+		return strings.HasPrefix(name, "*.")
+	})
+
+	actualValue := map[string]any{
+		"subjectAltNames":        len(sans),
+		"wildcardNames":          wildcardNames,
+		"maximumSubjectAltNames": maxSubjectAltNames,
+	}
+
+	errorIds := make([]string, 0)
+	if len(wildcardNames) > 0 {
+		errorIds = append(errorIds, WildcardSubjectAltName)
+	}
+	if len(sans) > maxSubjectAltNames {
+		errorIds = append(errorIds, TooManySubjectAltNames)
+	}
+
+	if len(errorIds) > 0 {
+		return NewAnalysisResult(Failure, actualValue, errorIds, nil, time.Since(start))
+	}
+	return NewAnalysisResult(Success, actualValue, nil, nil, time.Since(start))
+}
+
+/*
+REQUIRED: The public key of the certificate meets the requirements of the selected key strength policy
+
+	RSA: minimum modulus size and minimum public exponent
+	DSA: minimum size of the parameters P and Q
+	EC: the named curve is allowed by the policy
+
+	The policy is selected by the scan (scan profile) or KEY_STRENGTH_POLICY.
+	The default is BSI TR-02102 of the current year. The applied policy is reported.
+*/
+func isStrongPrivateKey(cert *x509.Certificate, policy keyStrengthPolicy) AnalysisResult {
 	start := time.Now()
-	// check if the private key is strong
-	pubKey := cert.PublicKey
-	switch key := pubKey.(type) {
+	keyType, keySize := publicKeyDetails(cert)
+	actualValue := map[string]any{
+		"policy":  policy,
+		"keyType": keyType,
+		"keySize": keySize,
+	}
+
+	errorIds := make([]string, 0)
+	switch key := cert.PublicKey.(type) {
 	case *rsa.PublicKey:
-		// BSI TR-02102-1, Chapter 2.3.2
-		if key.N.BitLen() < 3000 {
-			return NewAnalysisResult(Failure, nil, nil, nil, time.Since(start))
+		actualValue["publicExponent"] = key.E
+		if policy.MinRSAModulusBits == 0 {
+			errorIds = append(errorIds, KeyTypeNotAllowed)
+			break
+		}
+		if key.N.BitLen() < policy.MinRSAModulusBits {
+			errorIds = append(errorIds, RSAKeyTooShort)
+		}
+		if key.E < policy.MinRSAExponent {
+			errorIds = append(errorIds, RSAExponentTooSmall)
 		}
-		return NewAnalysisResult(Success, nil, nil, nil, time.Since(start))
 	case *dsa.PublicKey:
-		// BSI TR-02102-1, Chapter 5.3.2
-		if key.P.BitLen() < 3000 || key.Q.BitLen() < 250 {
-			return NewAnalysisResult(Failure, nil, nil, nil, time.Since(start))
+		if policy.MinDSAPBits == 0 {
+			errorIds = append(errorIds, KeyTypeNotAllowed)
+			break
+		}
+		if key.P.BitLen() < policy.MinDSAPBits || key.Q.BitLen() < policy.MinDSAQBits {
+			errorIds = append(errorIds, DSAKeyTooShort)
 		}
-		return NewAnalysisResult(Success, nil, nil, nil, time.Since(start))
 	case *ecdsa.PublicKey:
-		// BSI TR-02102-1
-		if key.Curve.Params().BitSize < 250 {
-			return NewAnalysisResult(Failure, nil, nil, nil, time.Since(start))
+		curve, err := namedCurve(cert.RawSubjectPublicKeyInfo)
+		if err != nil {
+			curve = key.Curve.Params().Name
+		}
+		actualValue["curve"] = curve
+		if !utils.Includes(policy.AllowedCurves, curve) {
+			errorIds = append(errorIds, CurveNotAllowed)
+		}
+	case ed25519.PublicKey:
+		if !policy.AllowEd25519 {
+			errorIds = append(errorIds, KeyTypeNotAllowed)
 		}
-		return NewAnalysisResult(Success, nil, nil, nil, time.Since(start))
 	default:
-		return NewAnalysisResult(Failure, nil, nil, nil, time.Since(start))
+		errorIds = append(errorIds, KeyTypeNotAllowed)
+	}
+
+	if len(errorIds) > 0 {
+		return NewAnalysisResult(Failure, actualValue, errorIds, nil, time.Since(start))
 	}
+	return NewAnalysisResult(Success, actualValue, nil, nil, time.Since(start))
 }
 
-func certificateTransparency(connectionState *tls.ConnectionState) AnalysisResult {
-	start := time.Now()
-	// check if the certificate is in the certificate transparency log
-	for ex := range connectionState.PeerCertificates[0].Extensions {
-		if connectionState.PeerCertificates[0].Extensions[ex].Id.Equal(asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}) {
-			// if it does exist, return true
-			// TODO: Improve to really check if the certificate is in the log
-			return NewAnalysisResult(Success, nil, nil, nil, time.Since(start))
+type rawSCT struct {
+	raw    []byte
+	source string
+}
+
+// collects the signed certificate timestamps of the leaf certificate.
+// they are either embedded in the certificate, delivered using the tls extension or inside the stapled OCSP response.
+func collectSCTs(connectionState *tls.ConnectionState, issuer *x509.Certificate) ([]rawSCT, []sctVerification) {
+	leaf := connectionState.PeerCertificates[0]
+	scts := make([]rawSCT, 0)
+	malformed := make([]sctVerification, 0)
+
+	appendList := func(extensionValue []byte, source string) {
+		list, err := parseSCTList(extensionValue)
+		if err != nil {
+			malformed = append(malformed, sctVerification{Source: source, Error: SCTInvalid})
+			return
+		}
+		for _, raw := range list {
+			scts = append(scts, rawSCT{raw: raw, source: source})
 		}
 	}
 
-	if connectionState.SignedCertificateTimestamps != nil {
-		return NewAnalysisResult(Success, nil, nil, nil, time.Since(start))
+	for _, extension := range leaf.Extensions {
+		if extension.Id.Equal(sctListExtensionOID) {
+			appendList(extension.Value, SCTSourceEmbedded)
+		}
+	}
+	for _, raw := range connectionState.SignedCertificateTimestamps {
+		scts = append(scts, rawSCT{raw: raw, source: SCTSourceTLS})
 	}
-
 	if connectionState.OCSPResponse != nil {
-		return NewAnalysisResult(Success, nil, nil, nil, time.Since(start))
+		if response, err := ocsp.ParseResponseForCert(connectionState.OCSPResponse, leaf, issuer); err == nil {
+			for _, extension := range response.Extensions {
+				if extension.Id.Equal(ocspSCTListExtensionOID) {
+					appendList(extension.Value, SCTSourceOCSP)
+				}
+			}
+		}
+	}
+	return scts, malformed
+}
+
+/*
+REQUIRED: The certificate is logged in at least CT_MINIMUM_DISTINCT_LOGS (default: 2) distinct certificate transparency logs
+
+	The signed certificate timestamps are collected from the certificate, the tls extension and the stapled OCSP response.
+	Every timestamp is verified against the public key of the log in the configured log list (CT_LOG_LIST).
+	Only logs, which were qualified at the time of the timestamp, are counted.
+	Without a log list, the timestamps cannot be verified - the check passes, if the certificate has at least one well-formed timestamp.
+
+	REF: https://www.rfc-editor.org/rfc/rfc6962
+*/
+func (c certificateAnalyzer) certificateTransparency(ctx context.Context, target Target, connectionState *tls.ConnectionState) AnalysisResult {
+	start := time.Now()
+	leaf := connectionState.PeerCertificates[0]
+
+	// the issuer is required for the verification of embedded timestamps
+	var issuer *x509.Certificate
+	if len(connectionState.PeerCertificates) > 1 {
+		issuer = connectionState.PeerCertificates[1]
+	} else if target.Options.HttpClient != nil {
+		issuer, _ = fetchIssuingCertificate(ctx, target.Options.HttpClient, leaf)
+	}
+
+	scts, verifications := collectSCTs(connectionState, issuer)
+	for _, sct := range scts {
+		verifications = append(verifications, verifySCT(sct.raw, sct.source, leaf, issuer, c.ctLogs))
 	}
 
-	return NewAnalysisResult(Failure, nil, nil, nil, time.Since(start))
+	verifiedLogs := make([]string, 0)
+	for _, verification := range verifications {
+		if verification.Valid && !utils.Includes(verifiedLogs, verification.Log) {
+			verifiedLogs = append(verifiedLogs, verification.Log)
+		}
+	}
+
+	actualValue := map[string]any{
+		"subject":             leaf.Subject.String(),
+		"serialNumber":        leaf.SerialNumber.Text(16),
+		"scts":                verifications,
+		"verifiedLogs":        verifiedLogs,
+		"minimumDistinctLogs": ctMinimumDistinctLogs,
+		"logListConfigured":   len(c.ctLogs) > 0,
+	}
+
+	if len(verifications) == 0 {
+		return NewAnalysisResult(Failure, actualValue, []string{NoSCT}, nil, time.Since(start))
+	}
+	if len(c.ctLogs) == 0 {
+		// the timestamps can not be verified - just check if the certificate was submitted to any log
+		if utils.Some(verifications, func(verification sctVerification) bool {
+			return verification.Error != SCTInvalid
+		}) {
+			return NewAnalysisResult(Success, actualValue, nil, nil, time.Since(start))
+		}
+		return NewAnalysisResult(Failure, actualValue, []string{NoSCT}, nil, time.Since(start))
+	}
+	if len(verifiedLogs) < ctMinimumDistinctLogs {
+		return NewAnalysisResult(Failure, actualValue, []string{InsufficientCTLogs}, nil, time.Since(start))
+	}
+	return NewAnalysisResult(Success, actualValue, nil, nil, time.Since(start))
 }
 
 // holds the revocation lists based upon the CRLDistributionPoints
@@ -200,18 +692,52 @@ var crlSet = cache.NewMaxMemoryMap[string, *x509.RevocationList](
 )
 var crlLock sync.Mutex
 
-func fetchRevocationList(ctx context.Context, distributionPoint string) (*x509.RevocationList, error) {
-	// fetch the revocation list if it is not already in the crlSet
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, distributionPoint, nil)
+const (
+	RevocationStatusGood    = "good"
+	RevocationStatusRevoked = "revoked"
+	RevocationStatusUnknown = "unknown"
+)
+
+const (
+	CRLInvalidSignature      = "crlInvalidSignature"
+	CRLExpired               = "crlExpired"
+	OCSPInvalidResponse      = "ocspInvalidResponse"
+	OCSPExpired              = "ocspExpired"
+	OCSPResponderUnavailable = "ocspResponderUnavailable"
+)
+
+// recommended, if neither the OCSP responses nor the CRLs determine the status of the leaf certificate
+const RevocationStatusNotDetermined = "revocationStatusNotDetermined"
+
+// the result of a single revocation source (stapled ocsp response, ocsp responder or crl)
+type revocationSourceResult struct {
+	Source string `json:"source"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type certificateRevocation struct {
+	Subject      string                   `json:"subject"`
+	SerialNumber string                   `json:"serialNumber"`
+	Status       string                   `json:"status"`
+	Sources      []revocationSourceResult `json:"sources"`
+}
+
+// fetches the revocation list using the http client of the scan.
+// this way the configured proxy is respected.
+func fetchRevocationList(ctx context.Context, client httpClient, distributionPoint string) (*x509.RevocationList, error) {
+	u, err := url.Parse(distributionPoint)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Get(ctx, u)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	crlBytes, err := io.ReadAll(resp.Body)
+	if resp.Response().StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.Response().StatusCode)
+	}
+	crlBytes, err := resp.ResponseBody()
 	if err != nil {
 		return nil, err
 	}
@@ -222,58 +748,206 @@ func fetchRevocationList(ctx context.Context, distributionPoint string) (*x509.R
 	return crl, nil
 }
 
-func isNotRevoked(ctx context.Context, certs []*x509.Certificate) AnalysisResult {
+// returns a cached revocation list as long as it is not outdated
+func getRevocationList(ctx context.Context, client httpClient, distributionPoint string) (*x509.RevocationList, error) {
+	if list, ok := crlSet.Get(distributionPoint); ok && list != nil && (list.NextUpdate.IsZero() || list.NextUpdate.After(time.Now())) {
+		return list, nil
+	}
+	list, err := fetchRevocationList(ctx, client, distributionPoint)
+	if err != nil {
+		return nil, err
+	}
+	// save the revocation list in the crlSet
+	crlLock.Lock()
+	crlSet.Set(distributionPoint, list)
+	crlLock.Unlock()
+	return list, nil
+}
+
+func crlRevocationStatus(ctx context.Context, client httpClient, cert, issuer *x509.Certificate, distributionPoint string) revocationSourceResult {
+	res := revocationSourceResult{Source: distributionPoint, Status: RevocationStatusUnknown}
+	list, err := getRevocationList(ctx, client, distributionPoint)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	// the crl needs to be signed by the issuer of the certificate
+	if err := list.CheckSignatureFrom(issuer); err != nil {
+		res.Error = CRLInvalidSignature
+		return res
+	}
+	if !list.NextUpdate.IsZero() && list.NextUpdate.Before(time.Now()) {
+		res.Error = CRLExpired
+		return res
+	}
+	for _, revoked := range list.RevokedCertificateEntries {
+		if cert.SerialNumber.Cmp(revoked.SerialNumber) == 0 {
+			res.Status = RevocationStatusRevoked
+			return res
+		}
+	}
+	res.Status = RevocationStatusGood
+	return res
+}
+
+func interpretOCSPResponse(source string, response *ocsp.Response, err error) revocationSourceResult {
+	res := revocationSourceResult{Source: source, Status: RevocationStatusUnknown}
+	if err != nil {
+		res.Error = OCSPInvalidResponse
+		return res
+	}
+	if !response.NextUpdate.IsZero() && response.NextUpdate.Before(time.Now()) {
+		res.Error = OCSPExpired
+		return res
+	}
+	switch response.Status {
+	case ocsp.Good:
+		res.Status = RevocationStatusGood
+	case ocsp.Revoked:
+		res.Status = RevocationStatusRevoked
+	}
+	return res
+}
+
+// uses the GET method defined in RFC6960 Appendix A.1.
+// the http client interface of the scan does only support GET requests.
+func ocspRevocationStatus(ctx context.Context, client httpClient, cert, issuer *x509.Certificate, responder string) revocationSourceResult {
+	res := revocationSourceResult{Source: responder, Status: RevocationStatusUnknown}
+	request, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	u, err := url.Parse(strings.TrimSuffix(responder, "/") + "/" + url.PathEscape(base64.StdEncoding.EncodeToString(request)))
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	resp, err := client.Get(ctx, u)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	// an error page (e.g. 404 or 503) is not an invalid ocsp response - the responder is just not available
+	mediaType, _, _ := mime.ParseMediaType(resp.Response().Header.Get("Content-Type"))
+	if resp.Response().StatusCode != http.StatusOK || mediaType != "application/ocsp-response" {
+		res.Error = OCSPResponderUnavailable
+		return res
+	}
+	body, err := resp.ResponseBody()
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	response, err := ocsp.ParseResponseForCert(body, cert, issuer)
+	return interpretOCSPResponse(responder, response, err)
+}
+
+func revocationStatus(ctx context.Context, client httpClient, cert, issuer *x509.Certificate, stapledOCSPResponse []byte) certificateRevocation {
+	revocation := certificateRevocation{
+		Subject:      cert.Subject.String(),
+		SerialNumber: cert.SerialNumber.Text(16),
+		Status:       RevocationStatusUnknown,
+		Sources:      []revocationSourceResult{},
+	}
+	// without the issuer, neither ocsp responses nor crls can be verified
+	if issuer == nil {
+		return revocation
+	}
+
+	sources := make([]<-chan revocationSourceResult, 0)
+	if stapledOCSPResponse != nil {
+		sources = append(sources, concurrency.WrapInChan(func() revocationSourceResult {
+			response, err := ocsp.ParseResponseForCert(stapledOCSPResponse, cert, issuer)
+			return interpretOCSPResponse("stapled", response, err)
+		}))
+	}
+	for _, responder := range cert.OCSPServer {
+		sources = append(sources, concurrency.WrapInChan(func() revocationSourceResult {
+			return ocspRevocationStatus(ctx, client, cert, issuer, responder)
+		}))
+	}
+	for _, crlDistributionPoint := range cert.CRLDistributionPoints {
+		sources = append(sources, concurrency.WrapInChan(func() revocationSourceResult {
+			return crlRevocationStatus(ctx, client, cert, issuer, crlDistributionPoint)
+		}))
+	}
+
+	revocation.Sources = concurrency.Collect(sources...)
+	for _, result := range revocation.Sources {
+		if result.Status == RevocationStatusRevoked {
+			revocation.Status = RevocationStatusRevoked
+			break
+		}
+		if result.Status == RevocationStatusGood {
+			revocation.Status = RevocationStatusGood
+		}
+	}
+	return revocation
+}
+
+/*
+IMMEDIATE ACTION REQUIRED CHECK
+
+	(if a REQUIRED spec is not met, the call to immediate action MUST be shown to the user)
+
+REQUIRED: No certificate of the served chain is revoked
+
+	The stapled OCSP response, the OCSP responders and the CRL distribution points are consulted.
+	OCSP responses and CRLs are only used, if their signature is valid and they are not outdated.
+	If the status of the leaf certificate cannot be determined (e.g. no CRL and no OCSP responder or an unavailable responder), the check passes with a recommendation.
+*/
+func isNotRevoked(ctx context.Context, client httpClient, certs []*x509.Certificate, stapledOCSPResponse []byte) AnalysisResult {
 	start := time.Now()
-	// check if the certificate is revoked
-	channels := make([]<-chan DidPass, len(certs))
+
+	// the last certificate of the chain does not have an issuer inside the chain.
+	// if the leaf is the only certificate, the issuer is fetched.
+	issuers := make([]*x509.Certificate, len(certs))
+	copy(issuers, certs[1:])
+	if len(certs) == 1 {
+		if issuer, err := fetchIssuingCertificate(ctx, client, certs[0]); err == nil {
+			issuers[0] = issuer
+		}
+	}
+
+	channels := make([]<-chan certificateRevocation, 0)
 	for i, cert := range certs {
-		channels[i] = concurrency.WrapInChan(func() DidPass {
-			if cert.IsCA {
-				return Success
-			}
-			ch := make([]<-chan DidPass, 0)
-			for _, crlDistributionPoint := range cert.CRLDistributionPoints {
-				ch = append(ch, concurrency.WrapInChan(
-					func() DidPass {
-						// fetch the revocation list if it is not already in the crlSet
-						if _, ok := crlSet.Get(crlDistributionPoint); !ok {
-							cr, err := fetchRevocationList(ctx, crlDistributionPoint)
-							if err != nil {
-								return Unknown
-							}
-							// save the revocation list in the crlSet
-							crlLock.Lock()
-							crlSet.Set(crlDistributionPoint, cr)
-							crlLock.Unlock()
-						}
-
-						list, _ := crlSet.Get(crlDistributionPoint)
-						if list == nil || list.RevokedCertificateEntries == nil {
-							return Unknown
-						}
-						for _, revoked := range list.RevokedCertificateEntries {
-							if cert.SerialNumber.Cmp(revoked.SerialNumber) == 0 {
-								return Failure
-							}
-						}
-						return Success
-					}))
-			}
+		// the leaf is always reported - even if its issuer is unknown
+		if issuers[i] == nil && i > 0 {
+			continue
+		}
+		var stapled []byte
+		if i == 0 {
+			stapled = stapledOCSPResponse
+		}
+		channels = append(channels, concurrency.WrapInChan(func() certificateRevocation {
+			return revocationStatus(ctx, client, cert, issuers[i], stapled)
+		}))
+	}
+	revocations := concurrency.Collect(channels...)
 
-			if utils.Every(concurrency.Collect(ch...), func(didPass DidPass) bool {
-				return didPass != Failure
-			}) {
-				return Success
+	errorIds := make([]string, 0)
+	for _, revocation := range revocations {
+		for _, source := range revocation.Sources {
+			if utils.Includes([]string{CRLInvalidSignature, CRLExpired, OCSPInvalidResponse, OCSPExpired}, source.Error) && !utils.Includes(errorIds, source.Error) {
+				errorIds = append(errorIds, source.Error)
 			}
-			return Failure
-		})
+		}
+	}
+
+	actualValue := map[string]any{
+		"certificates": revocations,
 	}
-	if utils.Every(concurrency.Collect(channels...), func(didPass DidPass) bool {
-		return didPass != Failure
+	if utils.Some(revocations, func(revocation certificateRevocation) bool {
+		return revocation.Status == RevocationStatusRevoked
 	}) {
-		return NewAnalysisResult(Success, nil, nil, nil, time.Since(start))
+		return NewAnalysisResult(Failure, actualValue, errorIds, nil, time.Since(start))
+	}
+	// the first entry always belongs to the leaf certificate
+	if revocations[0].Status == RevocationStatusUnknown {
+		return NewAnalysisResult(Success, actualValue, errorIds, []string{RevocationStatusNotDetermined}, time.Since(start))
 	}
-	return NewAnalysisResult(Failure, nil, nil, nil, time.Since(start))
+	return NewAnalysisResult(Success, actualValue, errorIds, nil, time.Since(start))
 }
 
 // https://developer.mozilla.org/en-US/docs/Web/Security/Weak_Signature_Algorithm
@@ -296,6 +970,9 @@ func (c certificateAnalyzer) GetAnalysisRuleIds() []AnalysisRuleId {
 		ValidCertificate,
 		ValidCertificateChain,
 		MatchesHostname,
+		CertificateKeyUsage,
+		LimitedSubjectAltNames,
+		DefaultCertificate,
 		StrongPrivateKey,
 		NotRevoked,
 		StrongSignatureAlgorithm,
@@ -313,15 +990,41 @@ func (c certificateAnalyzer) ExtractCacheableFromResult(analyzedTarget Target, r
 
 func (c certificateAnalyzer) GetCacheKeys(target Target) []string {
 	return []string{
-		target.URL.Hostname(),
+		certificateCacheKey(target),
+	}
+}
+
+// the key strength policy changes the result of the strongPrivateKey check - therefore it is part of the key
+func certificateCacheKey(target Target) string {
+	return target.URL.Hostname() + "/" + selectKeyStrengthPolicy(target.Options.KeyStrengthPolicy).Name
+}
+
+// crypto/tls aborts the handshake, if crypto/x509 is not able to parse the certificate of the server (e.g. a key using a brainpool curve).
+// the key strength is evaluated using the raw certificate in this case - every other check is reported as error.
+// crypto/tls does not expose a typed error for it - the raw handshake fetches the leaf again and parses it using crypto/x509.
+func (i certificateAnalyzer) analyzeUnparsableCertificate(ctx context.Context, target Target, err error) (map[AnalysisRuleId]AnalysisResult, error) {
+	// network errors and received alerts never stem from the certificate
+	var opErr *net.OpError
+	if ctx.Err() != nil || errors.As(err, &opErr) {
+		return nil, err
 	}
+	leaf, probeErr := probeUnparsableCertificate(ctx, target)
+	if !errors.Is(probeErr, errUnparsableCertificate) {
+		return nil, err
+	}
+	res := buildAnalysisError(probeErr, i.GetAnalysisRuleIds())
+	res[StrongPrivateKey] = maybeDoCheck(StrongPrivateKey, target.Options, func() AnalysisResult {
+		return isStrongRawPrivateKey(leaf, selectKeyStrengthPolicy(target.Options.KeyStrengthPolicy))
+	})
+	return res, nil
 }
 
 // an existing tls connection state can be provided to reuse it.
 // if it is nil, a new connection will be established
 func (i certificateAnalyzer) Analyze(ctx context.Context, target Target, state *tls.ConnectionState) (map[AnalysisRuleId]AnalysisResult, error) {
 	// check the cache
-	if cachedValue, err := target.Options.CachingLayer.Get(ctx, target.URL.Hostname()); err == nil {
+	cacheKey := certificateCacheKey(target)
+	if cachedValue, err := target.Options.CachingLayer.Get(ctx, cacheKey); err == nil {
 		cached, err := getFromCache(cachedValue, i.GetAnalysisRuleIds())
 		if err == nil {
 			return cached, nil
@@ -333,27 +1036,37 @@ func (i certificateAnalyzer) Analyze(ctx context.Context, target Target, state *
 		// get the certificate
 		conn, err := tlsConnect(ctx, target, nil)
 		if err != nil {
-			return nil, err
+			// the certificate was received before the server requested a client certificate
+			if s = clientAuthRequiredState(err); s == nil {
+				return i.analyzeUnparsableCertificate(ctx, target, err)
+			}
+		} else {
+			defer conn.Close()
+			var res = conn.(*tls.Conn).ConnectionState()
+			s = &res
 		}
-		defer conn.Close()
-		var res = conn.(*tls.Conn).ConnectionState()
-		s = &res
 	} else {
 		slog.Debug("reusing existing tls connection state")
 	}
 
 	certificate := s.PeerCertificates[0]
+	keyStrengthPolicy := selectKeyStrengthPolicy(target.Options.KeyStrengthPolicy)
 	res := map[AnalysisRuleId]AnalysisResult{
-		NotRevoked:               maybeDoCheck(NotRevoked, target.Options, func() AnalysisResult { return isNotRevoked(ctx, s.PeerCertificates) }),
+		NotRevoked: maybeDoCheck(NotRevoked, target.Options, func() AnalysisResult {
+			return isNotRevoked(ctx, target.Options.HttpClient, s.PeerCertificates, s.OCSPResponse)
+		}),
 		ValidCertificate:         maybeDoCheck(ValidCertificate, target.Options, func() AnalysisResult { return validCertificate(certificate) }),
-		ValidCertificateChain:    maybeDoCheck(ValidCertificateChain, target.Options, func() AnalysisResult { return validCertificateChain(s.PeerCertificates) }),
+		ValidCertificateChain:    maybeDoCheck(ValidCertificateChain, target.Options, func() AnalysisResult { return i.validCertificateChain(ctx, target, s.PeerCertificates) }),
 		MatchesHostname:          maybeDoCheck(MatchesHostname, target.Options, func() AnalysisResult { return matchesHostname(certificate, target.URL.Hostname()) }),
-		StrongPrivateKey:         maybeDoCheck(StrongPrivateKey, target.Options, func() AnalysisResult { return isStrongPrivateKey(certificate) }),
+		CertificateKeyUsage:      maybeDoCheck(CertificateKeyUsage, target.Options, func() AnalysisResult { return certificateKeyUsage(certificate) }),
+		LimitedSubjectAltNames:   maybeDoCheck(LimitedSubjectAltNames, target.Options, func() AnalysisResult { return limitedSubjectAltNames(certificate, certificateMaxSubjectAltNames) }),
+		DefaultCertificate:       maybeDoCheck(DefaultCertificate, target.Options, func() AnalysisResult { return defaultCertificate(ctx, target, certificate) }),
+		StrongPrivateKey:         maybeDoCheck(StrongPrivateKey, target.Options, func() AnalysisResult { return isStrongPrivateKey(certificate, keyStrengthPolicy) }),
 		StrongSignatureAlgorithm: maybeDoCheck(StrongSignatureAlgorithm, target.Options, func() AnalysisResult { return isStrongSignatureAlgorithm(certificate) }),
-		CertificateTransparency:  maybeDoCheck(CertificateTransparency, target.Options, func() AnalysisResult { return certificateTransparency(s) }),
+		CertificateTransparency:  maybeDoCheck(CertificateTransparency, target.Options, func() AnalysisResult { return i.certificateTransparency(ctx, target, s) }),
 	}
 
 	// cache the result
-	target.Options.CachingLayer.Set(ctx, target.URL.Hostname(), res, 1*time.Hour) // nolint It does not matter if the cache fails - it is just a cache
+	target.Options.CachingLayer.Set(ctx, cacheKey, res, 1*time.Hour) // nolint It does not matter if the cache fails - it is just a cache
 	return res, nil
 }
@@ -2,8 +2,27 @@ package scanner
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/cache"
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/httpclient"
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+	"golang.org/x/crypto/ocsp"
 )
 
 func TestIsNotRevoked(t *testing.T) {
@@ -13,9 +32,634 @@ func TestIsNotRevoked(t *testing.T) {
 		t.Errorf("Expected no error, got %v", err)
 	}
 
-	result := isNotRevoked(context.Background(), res.TLS.PeerCertificates)
+	result := isNotRevoked(context.Background(), httpclient.NewDefaultClient(), res.TLS.PeerCertificates, res.TLS.OCSPResponse)
 
 	if !*result.DidPass {
 		t.Errorf("Expected success, got %v", result)
 	}
 }
+
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// issues a certificate for testing purposes.
+// if the parent is nil, the certificate is self signed.
+func issueTestCertificate(t *testing.T, template *x509.Certificate, parent *testCertificate) testCertificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if template.SerialNumber == nil {
+		template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	}
+	if template.NotBefore.IsZero() {
+		template.NotBefore = time.Now().Add(-1 * time.Hour)
+	}
+	if template.NotAfter.IsZero() {
+		template.NotAfter = time.Now().Add(24 * time.Hour)
+	}
+	issuer, issuerKey := template, key
+	if parent != nil {
+		issuer, issuerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testCertificate{cert: cert, key: key}
+}
+
+func newTestCA(t *testing.T, commonName string, parent *testCertificate) testCertificate {
+	return issueTestCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: commonName},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}, parent)
+}
+
+func TestValidCertificateChain(t *testing.T) {
+	root := newTestCA(t, "Test Root", nil)
+	intermediate := newTestCA(t, "Test Intermediate", &root)
+
+	aiaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(intermediate.cert.Raw) // nolint
+	}))
+	defer aiaServer.Close()
+
+	leaf := issueTestCertificate(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "example.com"},
+		DNSNames: []string{"example.com"},
+	}, &intermediate)
+	leafWithAIA := issueTestCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "example.com"},
+		DNSNames:              []string{"example.com"},
+		IssuingCertificateURL: []string{aiaServer.URL + "/intermediate.der"},
+	}, &intermediate)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root.cert)
+	analyzer := certificateAnalyzer{trustStore: trustStore{roots: roots, customRoots: []*x509.Certificate{root.cert}}}
+	target := Target{Options: TargetScanOptions{HttpClient: httpclient.NewDefaultClient()}}
+
+	table := []struct {
+		name                 string
+		certs                []*x509.Certificate
+		expected             bool
+		expectedError        string
+		missingIntermediates []string
+	}{
+		{"complete chain", []*x509.Certificate{leaf.cert, intermediate.cert}, true, "", []string{}},
+		{"missing intermediate without aia", []*x509.Certificate{leaf.cert}, false, UnknownAuthority, []string{}},
+		{"missing intermediate with aia", []*x509.Certificate{leafWithAIA.cert}, false, MissingIntermediate, []string{"CN=Test Intermediate"}},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			result := analyzer.validCertificateChain(context.Background(), target, test.certs)
+			if *result.DidPass != test.expected {
+				t.Fatalf("Expected %v, got %v", test.expected, *result.DidPass)
+			}
+			if test.expectedError != "" && !utils.Includes(result.Errors, test.expectedError) {
+				t.Errorf("Expected error %s, got %v", test.expectedError, result.Errors)
+			}
+			actualValue := result.ActualValue.(map[string]any)
+			if fmt.Sprint(actualValue["missingIntermediates"]) != fmt.Sprint(test.missingIntermediates) {
+				t.Errorf("Expected missing intermediates %v, got %v", test.missingIntermediates, actualValue["missingIntermediates"])
+			}
+			if test.expected && actualValue["customTrustAnchor"] != true {
+				t.Errorf("Expected the custom trust anchor to be used, got %v", actualValue)
+			}
+		})
+	}
+}
+
+func TestValidCertificate(t *testing.T) {
+	table := []struct {
+		name                    string
+		notBefore               time.Time
+		notAfter                time.Time
+		expected                bool
+		expectedRecommendations []string
+	}{
+		{"valid", time.Now().Add(-1 * time.Hour), time.Now().Add(40 * 24 * time.Hour), true, []string{}},
+		{"expires soon", time.Now().Add(-1 * time.Hour), time.Now().Add(5 * 24 * time.Hour), true, []string{ExpiresSoon}},
+		{"lifetime exceeds maximum", time.Now().Add(-1 * time.Hour), time.Now().Add(500 * 24 * time.Hour), true, []string{LifetimeExceedsMaximum}},
+		{"expired", time.Now().Add(-48 * time.Hour), time.Now().Add(-24 * time.Hour), false, []string{}},
+		{"not yet valid", time.Now().Add(24 * time.Hour), time.Now().Add(48 * time.Hour), false, []string{}},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			cert := issueTestCertificate(t, &x509.Certificate{
+				Subject:   pkix.Name{CommonName: "example.com"},
+				NotBefore: test.notBefore,
+				NotAfter:  test.notAfter,
+			}, nil)
+
+			result := validCertificate(cert.cert)
+			if *result.DidPass != test.expected {
+				t.Fatalf("Expected %v, got %v", test.expected, *result.DidPass)
+			}
+			if len(result.Recommendations) != len(test.expectedRecommendations) || !utils.IncludesSubset(result.Recommendations, test.expectedRecommendations) {
+				t.Errorf("Expected recommendations %v, got %v", test.expectedRecommendations, result.Recommendations)
+			}
+			actualValue := result.ActualValue.(map[string]any)
+			for _, key := range []string{"notBefore", "notAfter", "daysRemaining"} {
+				if _, ok := actualValue[key]; !ok {
+					t.Errorf("Expected %s to be reported", key)
+				}
+			}
+		})
+	}
+}
+
+// issues a self-signed certificate for an rsa key
+func issueTestRSACertificate(t *testing.T, template *x509.Certificate) *x509.Certificate {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-1 * time.Hour)
+	template.NotAfter = time.Now().Add(24 * time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestCertificateKeyUsage(t *testing.T) {
+	table := []struct {
+		name                    string
+		template                *x509.Certificate
+		rsaKey                  bool
+		expected                bool
+		expectedErrors          []string
+		expectedRecommendations []string
+	}{
+		{"server certificate", &x509.Certificate{
+			KeyUsage:    x509.KeyUsageDigitalSignature,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}, false, true, []string{}, []string{}},
+		{"without key usage", &x509.Certificate{
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		}, false, true, []string{}, []string{}},
+		{"client certificate", &x509.Certificate{
+			KeyUsage:    x509.KeyUsageDigitalSignature,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}, false, false, []string{MissingServerAuth}, []string{}},
+		{"without extended key usage", &x509.Certificate{
+			KeyUsage: x509.KeyUsageDigitalSignature,
+		}, false, false, []string{MissingExtendedKeyUsage}, []string{}},
+		{"key encipherment with an ec key", &x509.Certificate{
+			KeyUsage:    x509.KeyUsageKeyEncipherment,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}, false, false, []string{MissingDigitalSignature, KeyUsageNotAllowed}, []string{}},
+		{"key encipherment with an rsa key", &x509.Certificate{
+			KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}, true, true, []string{}, []string{}},
+		{"only key encipherment with an rsa key", &x509.Certificate{
+			KeyUsage:    x509.KeyUsageKeyEncipherment,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}, true, true, []string{}, []string{MissingDigitalSignature}},
+		{"neither digital signature nor key encipherment with an rsa key", &x509.Certificate{
+			KeyUsage:    x509.KeyUsageDataEncipherment,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}, true, false, []string{MissingDigitalSignature}, []string{}},
+		{"ca certificate", &x509.Certificate{
+			KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+		}, false, false, []string{KeyUsageNotAllowed, LeafIsCA}, []string{}},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			test.template.Subject = pkix.Name{CommonName: "example.com"}
+			cert := issueTestCertificate(t, test.template, nil).cert
+			if test.rsaKey {
+				cert = issueTestRSACertificate(t, test.template)
+			}
+
+			result := certificateKeyUsage(cert)
+			if *result.DidPass != test.expected {
+				t.Fatalf("Expected %v, got %v", test.expected, *result.DidPass)
+			}
+			if len(result.Errors) != len(test.expectedErrors) || !utils.IncludesSubset(result.Errors, test.expectedErrors) {
+				t.Errorf("Expected errors %v, got %v", test.expectedErrors, result.Errors)
+			}
+			if len(result.Recommendations) != len(test.expectedRecommendations) || !utils.IncludesSubset(result.Recommendations, test.expectedRecommendations) {
+				t.Errorf("Expected recommendations %v, got %v", test.expectedRecommendations, result.Recommendations)
+			}
+		})
+	}
+}
+
+func TestLimitedSubjectAltNames(t *testing.T) {
+	table := []struct {
+		name           string
+		dnsNames       []string
+		expected       bool
+		expectedErrors []string
+	}{
+		{"few names", []string{"example.com", "www.example.com"}, true, []string{}},
+		{"wildcard", []string{"example.com", "*.example.com"}, false, []string{WildcardSubjectAltName}},
+		{"too many names", []string{"a.example.com", "b.example.com", "c.example.com", "d.example.com"}, false, []string{TooManySubjectAltNames}},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			cert := issueTestCertificate(t, &x509.Certificate{
+				Subject:  pkix.Name{CommonName: "example.com"},
+				DNSNames: test.dnsNames,
+			}, nil)
+
+			result := limitedSubjectAltNames(cert.cert, 3)
+			if *result.DidPass != test.expected {
+				t.Fatalf("Expected %v, got %v", test.expected, *result.DidPass)
+			}
+			if len(result.Errors) != len(test.expectedErrors) || !utils.IncludesSubset(result.Errors, test.expectedErrors) {
+				t.Errorf("Expected errors %v, got %v", test.expectedErrors, result.Errors)
+			}
+		})
+	}
+}
+
+func TestRevocationStatus(t *testing.T) {
+	root := newTestCA(t, "Test Root", nil)
+	intermediate := newTestCA(t, "Test Intermediate", &root)
+	otherCA := newTestCA(t, "Other CA", nil)
+
+	// the leaf is defined later - the handlers need to know it
+	var leaf testCertificate
+	crlHandler := func(signer testCertificate, nextUpdate time.Time, revoked bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			entries := []x509.RevocationListEntry{}
+			if revoked {
+				entries = append(entries, x509.RevocationListEntry{SerialNumber: leaf.cert.SerialNumber, RevocationTime: time.Now().Add(-1 * time.Hour)})
+			}
+			crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+				Number:                    big.NewInt(1),
+				ThisUpdate:                time.Now().Add(-2 * time.Hour),
+				NextUpdate:                nextUpdate,
+				RevokedCertificateEntries: entries,
+			}, signer.cert, signer.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write(crl) // nolint
+		}
+	}
+	ocspHandler := func(status int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			response, err := ocsp.CreateResponse(intermediate.cert, intermediate.cert, ocsp.Response{
+				Status:       status,
+				SerialNumber: leaf.cert.SerialNumber,
+				ThisUpdate:   time.Now().Add(-1 * time.Hour),
+				NextUpdate:   time.Now().Add(1 * time.Hour),
+				RevokedAt:    time.Now().Add(-1 * time.Hour),
+			}, intermediate.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Header().Set("Content-Type", "application/ocsp-response")
+			w.Write(response) // nolint
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/crl/good", crlHandler(intermediate, time.Now().Add(24*time.Hour), false))
+	mux.HandleFunc("/crl/revoked", crlHandler(intermediate, time.Now().Add(24*time.Hour), true))
+	mux.HandleFunc("/crl/forged", crlHandler(otherCA, time.Now().Add(24*time.Hour), false))
+	mux.HandleFunc("/crl/expired", crlHandler(intermediate, time.Now().Add(-1*time.Hour), false))
+	mux.HandleFunc("/ocsp/good/", ocspHandler(ocsp.Good))
+	mux.HandleFunc("/ocsp/revoked/", ocspHandler(ocsp.Revoked))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	table := []struct {
+		name                   string
+		crl                    string
+		ocsp                   string
+		expected               DidPass
+		expectedError          string
+		expectedRecommendation string
+		expectedSourceError    string
+	}{
+		{"crl good", "/crl/good", "", Success, "", "", ""},
+		{"crl revoked", "/crl/revoked", "", Failure, "", "", ""},
+		{"crl with invalid signature", "/crl/forged", "", Success, CRLInvalidSignature, RevocationStatusNotDetermined, CRLInvalidSignature},
+		{"crl expired", "/crl/expired", "", Success, CRLExpired, RevocationStatusNotDetermined, CRLExpired},
+		{"ocsp only good", "", "/ocsp/good", Success, "", "", ""},
+		{"ocsp only revoked", "", "/ocsp/revoked", Failure, "", "", ""},
+		{"ocsp responder unavailable", "", "/ocsp/missing", Success, "", RevocationStatusNotDetermined, OCSPResponderUnavailable},
+		{"neither crl nor ocsp", "", "", Success, "", RevocationStatusNotDetermined, ""},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			template := &x509.Certificate{
+				Subject:  pkix.Name{CommonName: "example.com"},
+				DNSNames: []string{"example.com"},
+			}
+			if test.crl != "" {
+				template.CRLDistributionPoints = []string{server.URL + test.crl}
+			}
+			if test.ocsp != "" {
+				template.OCSPServer = []string{server.URL + test.ocsp}
+			}
+			leaf = issueTestCertificate(t, template, &intermediate)
+
+			result := isNotRevoked(context.Background(), httpclient.NewDefaultClient(), []*x509.Certificate{leaf.cert, intermediate.cert}, nil)
+			if result.DidPass != test.expected {
+				t.Fatalf("Expected %v, got %v (%v)", test.expected, result.DidPass, result.ActualValue)
+			}
+			if test.expectedError != "" && !utils.Includes(result.Errors, test.expectedError) {
+				t.Errorf("Expected error %s, got %v", test.expectedError, result.Errors)
+			}
+			if test.expectedRecommendation != "" && !utils.Includes(result.Recommendations, test.expectedRecommendation) {
+				t.Errorf("Expected recommendation %s, got %v", test.expectedRecommendation, result.Recommendations)
+			}
+			sources := result.ActualValue.(map[string]any)["certificates"].([]certificateRevocation)[0].Sources
+			if test.expectedSourceError != "" && !utils.Some(sources, func(source revocationSourceResult) bool {
+				return source.Error == test.expectedSourceError
+			}) {
+				t.Errorf("Expected source error %s, got %+v", test.expectedSourceError, sources)
+			}
+		})
+	}
+}
+
+func TestIsStrongPrivateKey(t *testing.T) {
+	ca := newTestCA(t, "Test CA", nil)
+	rsa2048, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsa3072, err := rsa.GenerateKey(rand.Reader, 3072)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p224, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p521, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the certificates are signed by the test ca - the public key does not need a matching private key
+	certificateWithKey := func(publicKey any) *x509.Certificate {
+		der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			Subject:      pkix.Name{CommonName: "example.com"},
+			NotBefore:    time.Now().Add(-1 * time.Hour),
+			NotAfter:     time.Now().Add(24 * time.Hour),
+		}, ca.cert, publicKey, ca.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+
+	mozilla, _ := parseKeyStrengthPolicy(KeyStrengthPolicyMozillaIntermediate)
+	bsi2023, _ := parseKeyStrengthPolicy("bsi-tr-02102-2023")
+	bsi2024, _ := parseKeyStrengthPolicy("bsi-tr-02102-2024")
+
+	table := []struct {
+		name          string
+		cert          *x509.Certificate
+		policy        keyStrengthPolicy
+		expected      bool
+		expectedError string
+	}{
+		{"rsa 2048 mozilla", certificateWithKey(&rsa2048.PublicKey), mozilla, true, ""},
+		{"rsa 2048 bsi 2023", certificateWithKey(&rsa2048.PublicKey), bsi2023, true, ""},
+		{"rsa 2048 bsi 2024", certificateWithKey(&rsa2048.PublicKey), bsi2024, false, RSAKeyTooShort},
+		{"rsa 3072 bsi 2024", certificateWithKey(&rsa3072.PublicKey), bsi2024, true, ""},
+		{"rsa small exponent", certificateWithKey(&rsa.PublicKey{N: rsa3072.N, E: 3}), bsi2024, false, RSAExponentTooSmall},
+		{"p256 bsi 2024", ca.cert, bsi2024, true, ""},
+		{"p224 bsi 2024", certificateWithKey(&p224.PublicKey), bsi2024, false, CurveNotAllowed},
+		{"p521 mozilla", certificateWithKey(&p521.PublicKey), mozilla, false, CurveNotAllowed},
+		{"p521 bsi 2024", certificateWithKey(&p521.PublicKey), bsi2024, true, ""},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			result := isStrongPrivateKey(test.cert, test.policy)
+			if *result.DidPass != test.expected {
+				t.Fatalf("Expected %v, got %v (%v)", test.expected, *result.DidPass, result.ActualValue)
+			}
+			if test.expectedError != "" && !utils.Includes(result.Errors, test.expectedError) {
+				t.Errorf("Expected error %s, got %v", test.expectedError, result.Errors)
+			}
+			if result.ActualValue.(map[string]any)["policy"].(keyStrengthPolicy).Name != test.policy.Name {
+				t.Errorf("Expected the policy %s to be reported", test.policy.Name)
+			}
+		})
+	}
+}
+
+// builds a DER encoded certificate with an EC public key on the provided curve.
+// crypto/x509 can neither create nor parse it, if the curve is not supported - the signature is not valid.
+func rawECCertificate(t *testing.T, issuer testCertificate, curve asn1.ObjectIdentifier) []byte {
+	algorithm, err := asn1.Marshal(curve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// an uncompressed point
+	point := make([]byte, 65)
+	point[0] = 4
+	type subjectPublicKeyInfo struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	type tbsCertificate struct {
+		Version      int `asn1:"optional,explicit,default:0,tag:0"`
+		SerialNumber *big.Int
+		Signature    pkix.AlgorithmIdentifier
+		Issuer       asn1.RawValue
+		Validity     struct{ NotBefore, NotAfter time.Time }
+		Subject      asn1.RawValue
+		PublicKey    subjectPublicKeyInfo
+	}
+	signatureAlgorithm := pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}}
+	der, err := asn1.Marshal(struct {
+		TBSCertificate     tbsCertificate
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Signature          asn1.BitString
+	}{
+		TBSCertificate: tbsCertificate{
+			Version:      2,
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			Signature:    signatureAlgorithm,
+			Issuer:       asn1.RawValue{FullBytes: issuer.cert.RawSubject},
+			Validity:     struct{ NotBefore, NotAfter time.Time }{time.Now().Add(-1 * time.Hour).UTC(), time.Now().Add(24 * time.Hour).UTC()},
+			Subject:      asn1.RawValue{FullBytes: issuer.cert.RawSubject},
+			PublicKey: subjectPublicKeyInfo{
+				Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidPublicKeyECDSA, Parameters: asn1.RawValue{FullBytes: algorithm}},
+				PublicKey: asn1.BitString{Bytes: point, BitLength: len(point) * 8},
+			},
+		},
+		SignatureAlgorithm: signatureAlgorithm,
+		Signature:          asn1.BitString{Bytes: []byte{0}, BitLength: 8},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestIsStrongRawPrivateKey(t *testing.T) {
+	ca := newTestCA(t, "Test CA", nil)
+	brainpoolP256r1 := rawECCertificate(t, ca, asn1.ObjectIdentifier{1, 3, 36, 3, 3, 2, 8, 1, 1, 7})
+	if _, err := x509.ParseCertificate(brainpoolP256r1); err == nil {
+		t.Fatal("Expected crypto/x509 to reject the brainpool certificate")
+	}
+
+	mozilla, _ := parseKeyStrengthPolicy(KeyStrengthPolicyMozillaIntermediate)
+	bsi2024, _ := parseKeyStrengthPolicy("bsi-tr-02102-2024")
+
+	table := []struct {
+		name          string
+		raw           []byte
+		policy        keyStrengthPolicy
+		expected      DidPass
+		expectedError string
+		expectedCurve string
+	}{
+		{"brainpoolP256r1 bsi 2024", brainpoolP256r1, bsi2024, Success, "", "brainpoolP256r1"},
+		{"brainpoolP256r1 mozilla", brainpoolP256r1, mozilla, Failure, CurveNotAllowed, "brainpoolP256r1"},
+		{"unknown curve", rawECCertificate(t, ca, asn1.ObjectIdentifier{1, 3, 36, 3, 3, 2, 8, 1, 1, 1}), bsi2024, Failure, CurveNotAllowed, "1.3.36.3.3.2.8.1.1.1"},
+		{"parsable certificate", ca.cert.Raw, bsi2024, Success, "", "secp256r1"},
+		{"malformed certificate", []byte{0x30, 0x01}, bsi2024, Unknown, "", ""},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			result := isStrongRawPrivateKey(test.raw, test.policy)
+			if test.expected == Unknown && result.DidPass != nil || test.expected != Unknown && (result.DidPass == nil || *result.DidPass != *test.expected) {
+				t.Fatalf("Expected %v, got %+v", test.expected, result)
+			}
+			if test.expectedError != "" && !utils.Includes(result.Errors, test.expectedError) {
+				t.Errorf("Expected error %s, got %v", test.expectedError, result.Errors)
+			}
+			if test.expectedCurve != "" && result.ActualValue.(map[string]any)["curve"] != test.expectedCurve {
+				t.Errorf("Expected the curve %s, got %v", test.expectedCurve, result.ActualValue)
+			}
+		})
+	}
+}
+
+// crypto/tls aborts the handshake - the certificate is fetched using a raw TLS 1.2 handshake
+func TestCertificateAnalyzerBrainpoolCertificate(t *testing.T) {
+	ca := newTestCA(t, "Test CA", nil)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// httptest parses the certificate - the handshake is done by a plain tls listener.
+	// the handshake is never completed - the key does not need to match the certificate.
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		MaxVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{{Certificate: [][]byte{rawECCertificate(t, ca, asn1.ObjectIdentifier{1, 3, 36, 3, 3, 2, 8, 1, 1, 7})}, PrivateKey: key}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake() // nolint // the handshake fails
+			conn.Close()
+		}
+	}()
+
+	target := vulnerabilityProbeTarget(t, "https://"+listener.Addr().String())
+	target.Options.CachingLayer = cache.NewDisableCache()
+	target.Options.KeyStrengthPolicy = "bsi-tr-02102-2024"
+	target.Options.EnabledChecks = map[AnalysisRuleId]bool{StrongPrivateKey: true, ValidCertificate: true}
+
+	res, err := certificateAnalyzer{}.Analyze(context.Background(), target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res[StrongPrivateKey].IsSuccess() || res[StrongPrivateKey].ActualValue.(map[string]any)["curve"] != "brainpoolP256r1" {
+		t.Errorf("Expected a brainpoolP256r1 key, got %+v", res[StrongPrivateKey])
+	}
+	if res[ValidCertificate].DidPass != Unknown {
+		t.Errorf("Expected the other checks to be reported as error, got %+v", res[ValidCertificate])
+	}
+}
+
+// the error message of crypto/tls alone does not mark a certificate as unparsable
+func TestAnalyzeUnparsableCertificateParsableCertificate(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+
+	target := vulnerabilityProbeTarget(t, server.URL)
+	handshakeErr := errors.New("tls: failed to parse certificate from server: x509: unsupported elliptic curve")
+	res, err := certificateAnalyzer{}.analyzeUnparsableCertificate(context.Background(), target, handshakeErr)
+	if err != handshakeErr || res != nil {
+		t.Errorf("Expected the handshake error to be returned, got %v %+v", err, res)
+	}
+}
+
+func TestParseKeyStrengthPolicy(t *testing.T) {
+	table := []struct {
+		name          string
+		expectedError bool
+		minRSABits    int
+	}{
+		{"mozilla-intermediate", false, 2048},
+		{"bsi-tr-02102-2023", false, 2000},
+		{"bsi-tr-02102-2030", false, 3000},
+		{"bsi-tr-02102-next", true, 0},
+		{"unknown", true, 0},
+	}
+	for _, test := range table {
+		policy, err := parseKeyStrengthPolicy(test.name)
+		if (err != nil) != test.expectedError {
+			t.Fatalf("%s: expected error %v, got %v", test.name, test.expectedError, err)
+		}
+		if policy.MinRSAModulusBits != test.minRSABits {
+			t.Errorf("%s: expected minimum of %d bits, got %d", test.name, test.minRSABits, policy.MinRSAModulusBits)
+		}
+	}
+}
+
+func TestCertificateCacheKeyContainsKeyStrengthPolicy(t *testing.T) {
+	u, _ := url.Parse("https://example.com")
+	mozilla := certificateCacheKey(Target{URL: u, Options: TargetScanOptions{KeyStrengthPolicy: KeyStrengthPolicyMozillaIntermediate}})
+	bsi := certificateCacheKey(Target{URL: u, Options: TargetScanOptions{KeyStrengthPolicy: "bsi-tr-02102-2024"}})
+	if mozilla == bsi {
+		t.Fatalf("Expected different cache keys for different policies, got %s", mozilla)
+	}
+}
@@ -0,0 +1,147 @@
+package scanner
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/tlsclient"
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+const (
+	LeaksHostnames             = "leaksHostnames"
+	DefaultCertificateMismatch = "defaultCertificateMismatch"
+)
+
+// the tld .invalid is reserved and never resolves (RFC2606 Section 2)
+func bogusServerName() string {
+	random := make([]byte, 8)
+	rand.Read(random) // nolint // the name just needs to be unlikely to be configured
+	return hex.EncodeToString(random) + ".invalid"
+}
+
+// returns the leaf certificate served for the provided server name.
+// an empty server name results in a handshake without the server_name extension.
+func servedCertificate(ctx context.Context, target Target, serverName string) (*x509.Certificate, error) {
+	conn, err := tlsConnect(ctx, target, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true, // nolint // the served certificate is compared - it is not validated
+	})
+	if err != nil {
+		if state := clientAuthRequiredState(err); state != nil && len(state.PeerCertificates) > 0 {
+			return state.PeerCertificates[0], nil
+		}
+		return nil, err
+	}
+	defer conn.Close()
+	state := conn.(*tls.Conn).ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return nil, errors.New("no certificate served")
+	}
+	return state.PeerCertificates[0], nil
+}
+
+// returns the names of the certificate, which are neither covered by the certificate served for the hostname nor the hostname itself
+func leakedNames(cert, sniCertificate *x509.Certificate, hostname string) []string {
+	names := append([]string{}, cert.DNSNames...)
+	if cert.Subject.CommonName != "" && net.ParseIP(cert.Subject.CommonName) == nil {
+		names = append(names, cert.Subject.CommonName)
+	}
+
+	leaked := make([]string, 0)
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if name == "localhost" || name == strings.ToLower(hostname) || utils.Includes(leaked, name) {
+			continue
+		}
+		if utils.Includes(sniCertificate.DNSNames, name) || sniCertificate.VerifyHostname(name) == nil {
+			continue
+		}
+		// a wildcard covering the hostname does not reveal any other host
+		if _, parent, ok := strings.Cut(strings.ToLower(hostname), "."); ok && name == "*."+parent {
+			continue
+		}
+		leaked = append(leaked, name)
+	}
+	return leaked
+}
+
+/*
+RECOMMENDED: The server does not reveal other hostnames to clients without (or with an unknown) server name indication
+
+	Hosting setups serve a default certificate to clients, which do not send the server_name extension.
+	The names of this certificate often reveal internal or unrelated hostnames.
+	A handshake without SNI and a handshake with a bogus SNI are done and the served certificates are compared with the certificate served for the hostname.
+	The names of the default certificates, which are not covered by the certificate of the hostname, are reported as leaked.
+	If the certificate served without SNI does not match the hostname, clients without SNI support will receive a certificate error.
+
+Source: https://datatracker.ietf.org/doc/html/rfc6066#section-3
+*/
+func defaultCertificate(ctx context.Context, target Target, sniCertificate *x509.Certificate) AnalysisResult {
+	start := time.Now()
+	hostname := target.URL.Hostname()
+
+	probes := []struct {
+		name       string
+		serverName string
+	}{
+		{name: "noSNI", serverName: ""},
+		{name: "bogusSNI", serverName: bogusServerName()},
+	}
+
+	actualValue := map[string]any{
+		"sniCertificate": newCertificateDetails(sniCertificate, false),
+	}
+	leaked := make([]string, 0)
+	recommendations := make([]string, 0)
+	for _, probe := range probes {
+		cert, err := servedCertificate(ctx, target, probe.serverName)
+		if ctx.Err() != nil || errors.Is(err, tlsclient.ErrProxyConnectionFailed) {
+			return NewAnalysisResult(Unknown, nil, nil, nil, time.Since(start))
+		}
+		if err != nil {
+			// the server rejects the handshake - no certificate is revealed
+			actualValue[probe.name] = map[string]any{
+				"served": false,
+				"error":  err.Error(),
+			}
+			continue
+		}
+
+		matchesSNICertificate := cert.Equal(sniCertificate)
+		matchesHostname := cert.VerifyHostname(hostname) == nil
+		names := make([]string, 0)
+		if !matchesSNICertificate {
+			names = leakedNames(cert, sniCertificate, hostname)
+		}
+		actualValue[probe.name] = map[string]any{
+			"served":                true,
+			"certificate":           newCertificateDetails(cert, false),
+			"matchesSNICertificate": matchesSNICertificate,
+			"matchesHostname":       matchesHostname,
+			"leakedNames":           names,
+		}
+		for _, name := range names {
+			if !utils.Includes(leaked, name) {
+				leaked = append(leaked, name)
+			}
+		}
+		// a bogus server name is not expected to receive a matching certificate
+		if probe.serverName == "" && !matchesHostname {
+			recommendations = append(recommendations, DefaultCertificateMismatch)
+		}
+	}
+	actualValue["leakedNames"] = leaked
+
+	if len(leaked) > 0 {
+		return NewAnalysisResult(Failure, actualValue, []string{LeaksHostnames}, recommendations, time.Since(start))
+	}
+	return NewAnalysisResult(Success, actualValue, nil, recommendations, time.Since(start))
+}
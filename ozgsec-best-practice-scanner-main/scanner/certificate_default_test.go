@@ -0,0 +1,82 @@
+package scanner
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/tlsclient"
+)
+
+func TestDefaultCertificate(t *testing.T) {
+	hostCertificate := issueTestCertificate(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "example.com"},
+		DNSNames: []string{"example.com", "www.example.com"},
+	}, nil)
+	internalCertificate := issueTestCertificate(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "intranet.example.local"},
+		DNSNames: []string{"intranet.example.local", "www.example.com"},
+	}, nil)
+
+	table := []struct {
+		name                string
+		defaultCertificate  testCertificate
+		expectedDidPass     DidPass
+		expectedLeakedNames []string
+	}{
+		{
+			name:                "same certificate",
+			defaultCertificate:  hostCertificate,
+			expectedDidPass:     Success,
+			expectedLeakedNames: []string{},
+		},
+		{
+			name:                "internal default certificate",
+			defaultCertificate:  internalCertificate,
+			expectedDidPass:     Failure,
+			expectedLeakedNames: []string{"intranet.example.local"},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			server.TLS = &tls.Config{
+				// served without SNI
+				Certificates: []tls.Certificate{{Certificate: [][]byte{test.defaultCertificate.cert.Raw}, PrivateKey: test.defaultCertificate.key}},
+				GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+					cert := test.defaultCertificate
+					if hello.ServerName == "example.com" {
+						cert = hostCertificate
+					}
+					return &tls.Certificate{Certificate: [][]byte{cert.cert.Raw}, PrivateKey: cert.key}, nil
+				},
+			}
+			server.StartTLS()
+			defer server.Close()
+
+			serverURL, _ := url.Parse(server.URL)
+			target, _ := url.Parse("https://example.com:" + serverURL.Port())
+
+			actual := defaultCertificate(context.Background(), Target{URL: target, IPV4Address: net.ParseIP(serverURL.Hostname()), Options: TargetScanOptions{
+				TlsClient: tlsclient.NewDefaultClient(),
+			}}, hostCertificate.cert)
+
+			if test.expectedDidPass == Success && !actual.IsSuccess() || test.expectedDidPass == Failure && !actual.IsError() {
+				t.Fatalf("Expected %v, got %+v", *test.expectedDidPass, actual)
+			}
+			leaked := actual.ActualValue.(map[string]any)["leakedNames"].([]string)
+			if len(leaked) != len(test.expectedLeakedNames) || len(leaked) > 0 && leaked[0] != test.expectedLeakedNames[0] {
+				t.Errorf("Expected leaked names %v, got %v", test.expectedLeakedNames, leaked)
+			}
+		})
+	}
+}
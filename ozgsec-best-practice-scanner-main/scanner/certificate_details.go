@@ -0,0 +1,109 @@
+package scanner
+
+import (
+	"crypto/dsa" // nolint: staticcheck // dsa is needed for the key type switch
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"time"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+// CertificateDetails describes a single certificate of the served chain.
+// it contains the information, which would otherwise be looked up using openssl.
+type CertificateDetails struct {
+	Subject      string `json:"subject"`
+	Issuer       string `json:"issuer"`
+	SerialNumber string `json:"serialNumber"`
+	// the subject alternative names are prefixed with their type (e.g. DNS:example.com)
+	SubjectAltNames    []string `json:"subjectAltNames"`
+	NotBefore          string   `json:"notBefore"`
+	NotAfter           string   `json:"notAfter"`
+	KeyType            string   `json:"keyType"`
+	KeySize            int      `json:"keySize"`
+	SignatureAlgorithm string   `json:"signatureAlgorithm"`
+	// SHA-256 fingerprint of the DER encoded certificate
+	FingerprintSHA256 string `json:"fingerprintSha256"`
+	// SHA-256 fingerprint of the DER encoded subject public key info (used for key pinning and DANE)
+	SPKIFingerprintSHA256 string   `json:"spkiFingerprintSha256"`
+	PolicyOIDs            []string `json:"policyOids"`
+	IsCA                  bool     `json:"isCA"`
+	PEM                   string   `json:"pem,omitempty"`
+}
+
+func publicKeyDetails(cert *x509.Certificate) (string, int) {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return "RSA", key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return "ECDSA", key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return "Ed25519", 256
+	case *dsa.PublicKey:
+		return "DSA", key.P.BitLen()
+	default:
+		return cert.PublicKeyAlgorithm.String(), 0
+	}
+}
+
+func subjectAltNames(cert *x509.Certificate) []string {
+	sans := make([]string, 0, len(cert.DNSNames)+len(cert.IPAddresses)+len(cert.EmailAddresses)+len(cert.URIs))
+	for _, name := range cert.DNSNames {
+		sans = append(sans, "DNS:"+name)
+	}
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, "IP:"+ip.String())
+	}
+	for _, email := range cert.EmailAddresses {
+		sans = append(sans, "email:"+email)
+	}
+	for _, uri := range cert.URIs {
+		sans = append(sans, "URI:"+uri.String())
+	}
+	return sans
+}
+
+func newCertificateDetails(cert *x509.Certificate, includePEM bool) CertificateDetails {
+	keyType, keySize := publicKeyDetails(cert)
+	fingerprint := sha256.Sum256(cert.Raw)
+	spkiFingerprint := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+
+	details := CertificateDetails{
+		Subject:               cert.Subject.String(),
+		Issuer:                cert.Issuer.String(),
+		SerialNumber:          cert.SerialNumber.Text(16),
+		SubjectAltNames:       subjectAltNames(cert),
+		NotBefore:             cert.NotBefore.UTC().Format(time.RFC3339),
+		NotAfter:              cert.NotAfter.UTC().Format(time.RFC3339),
+		KeyType:               keyType,
+		KeySize:               keySize,
+		SignatureAlgorithm:    cert.SignatureAlgorithm.String(),
+		FingerprintSHA256:     hex.EncodeToString(fingerprint[:]),
+		SPKIFingerprintSHA256: hex.EncodeToString(spkiFingerprint[:]),
+		PolicyOIDs: utils.Map(cert.PolicyIdentifiers, func(oid asn1.ObjectIdentifier) string {
+			return oid.String()
+		}),
+		IsCA: cert.IsCA,
+	}
+	if includePEM {
+		details.PEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+	}
+	return details
+}
+
+// returns the details of every certificate in the served chain - starting with the leaf
+func certificateDetails(state *tls.ConnectionState, includePEM bool) []CertificateDetails {
+	if state == nil {
+		return []CertificateDetails{}
+	}
+	return utils.Map(state.PeerCertificates, func(cert *x509.Certificate) CertificateDetails {
+		return newCertificateDetails(cert, includePEM)
+	})
+}
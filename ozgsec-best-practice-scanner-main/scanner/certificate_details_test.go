@@ -0,0 +1,69 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"net"
+	"strings"
+	"testing"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+func TestCertificateDetails(t *testing.T) {
+	ca := newTestCA(t, "Test CA", nil)
+	leaf := issueTestCertificate(t, &x509.Certificate{
+		Subject:           pkix.Name{CommonName: "example.com"},
+		DNSNames:          []string{"example.com", "www.example.com"},
+		IPAddresses:       []net.IP{net.ParseIP("192.0.2.1")},
+		PolicyIdentifiers: []asn1.ObjectIdentifier{{2, 23, 140, 1, 2, 1}},
+	}, &ca)
+
+	state := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf.cert, ca.cert}}
+	details := certificateDetails(state, false)
+	if len(details) != 2 {
+		t.Fatalf("Expected 2 certificates, got %d", len(details))
+	}
+
+	fingerprint := sha256.Sum256(leaf.cert.Raw)
+	expected := CertificateDetails{
+		Subject:            "CN=example.com",
+		Issuer:             "CN=Test CA",
+		SerialNumber:       leaf.cert.SerialNumber.Text(16),
+		KeyType:            "ECDSA",
+		KeySize:            256,
+		SignatureAlgorithm: "ECDSA-SHA256",
+		FingerprintSHA256:  hex.EncodeToString(fingerprint[:]),
+	}
+	got := details[0]
+	if got.Subject != expected.Subject || got.Issuer != expected.Issuer || got.SerialNumber != expected.SerialNumber ||
+		got.KeyType != expected.KeyType || got.KeySize != expected.KeySize ||
+		got.SignatureAlgorithm != expected.SignatureAlgorithm || got.FingerprintSHA256 != expected.FingerprintSHA256 {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+	if !utils.IncludesSubset(got.SubjectAltNames, []string{"DNS:example.com", "DNS:www.example.com", "IP:192.0.2.1"}) {
+		t.Errorf("Expected all subject alternative names, got %v", got.SubjectAltNames)
+	}
+	if !utils.Includes(got.PolicyOIDs, "2.23.140.1.2.1") {
+		t.Errorf("Expected the policy oid to be reported, got %v", got.PolicyOIDs)
+	}
+	if got.PEM != "" {
+		t.Errorf("Expected no PEM, got %s", got.PEM)
+	}
+	if details[0].IsCA || !details[1].IsCA {
+		t.Errorf("Expected only the second certificate to be a CA")
+	}
+
+	withPEM := certificateDetails(state, true)
+	if !strings.HasPrefix(withPEM[0].PEM, "-----BEGIN CERTIFICATE-----") {
+		t.Errorf("Expected a PEM encoded certificate, got %s", withPEM[0].PEM)
+	}
+
+	if details := certificateDetails(nil, false); len(details) != 0 {
+		t.Errorf("Expected no certificates without tls connection state, got %v", details)
+	}
+}
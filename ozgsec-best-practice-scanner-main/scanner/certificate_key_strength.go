@@ -0,0 +1,218 @@
+package scanner
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+	cryptobyteasn1 "golang.org/x/crypto/cryptobyte/asn1"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+const (
+	KeyTypeNotAllowed   = "keyTypeNotAllowed"
+	RSAKeyTooShort      = "rsaKeyTooShort"
+	RSAExponentTooSmall = "rsaExponentTooSmall"
+	CurveNotAllowed     = "curveNotAllowed"
+	DSAKeyTooShort      = "dsaKeyTooShort"
+)
+
+const (
+	KeyStrengthPolicyMozillaIntermediate = "mozilla-intermediate"
+	// the year of the technical guideline can be appended (e.g. bsi-tr-02102-2024).
+	// without a year, the current year is used.
+	KeyStrengthPolicyBSITR02102 = "bsi-tr-02102"
+)
+
+// the named curves of the subject public key info (RFC5480 Section 2.1.1.1 and RFC5639 Section 4.1).
+// crypto/x509 is not able to parse certificates using brainpool curves - they are identified using the raw subject public key info.
+var namedCurves = map[string]string{
+	"1.2.840.10045.3.1.7":   "secp256r1",
+	"1.3.132.0.34":          "secp384r1",
+	"1.3.132.0.35":          "secp521r1",
+	"1.3.132.0.33":          "secp224r1",
+	"1.3.36.3.3.2.8.1.1.7":  "brainpoolP256r1",
+	"1.3.36.3.3.2.8.1.1.11": "brainpoolP384r1",
+	"1.3.36.3.3.2.8.1.1.13": "brainpoolP512r1",
+}
+
+// the key sizes of the curves, which crypto/x509 does not support
+var namedCurveBitSizes = map[string]int{
+	"brainpoolP256r1": 256,
+	"brainpoolP384r1": 384,
+	"brainpoolP512r1": 512,
+}
+
+// id-ecPublicKey (RFC5480 Section 2.1.1)
+var oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+
+// keyStrengthPolicy defines the requirements for the public key of a certificate.
+// a key type without requirements is not allowed.
+type keyStrengthPolicy struct {
+	Name              string   `json:"name"`
+	MinRSAModulusBits int      `json:"minRsaModulusBits,omitempty"`
+	MinRSAExponent    int      `json:"minRsaExponent,omitempty"`
+	AllowedCurves     []string `json:"allowedCurves,omitempty"`
+	AllowEd25519      bool     `json:"allowEd25519"`
+	MinDSAPBits       int      `json:"minDsaPBits,omitempty"`
+	MinDSAQBits       int      `json:"minDsaQBits,omitempty"`
+}
+
+// REF: https://wiki.mozilla.org/Security/Server_Side_TLS#Intermediate_compatibility_.28recommended.29
+var mozillaIntermediatePolicy = keyStrengthPolicy{
+	Name:              KeyStrengthPolicyMozillaIntermediate,
+	MinRSAModulusBits: 2048,
+	MinRSAExponent:    65537,
+	AllowedCurves:     []string{"secp256r1", "secp384r1"},
+}
+
+// BSI TR-02102-1 (key lengths of RSA, DSA and EC) and BSI TR-02102-2 (recommended domain parameters for TLS).
+// the minimum RSA and DSA modulus was raised from 2000 to 3000 bits in 2024.
+func bsiTR02102Policy(year int) keyStrengthPolicy {
+	minBits := 3000
+	if year < 2024 {
+		minBits = 2000
+	}
+	return keyStrengthPolicy{
+		Name:              fmt.Sprintf("%s-%d", KeyStrengthPolicyBSITR02102, year),
+		MinRSAModulusBits: minBits,
+		// the public exponent needs to be greater than 2^16
+		MinRSAExponent: 65537,
+		AllowedCurves:  []string{"brainpoolP256r1", "brainpoolP384r1", "brainpoolP512r1", "secp256r1", "secp384r1", "secp521r1"},
+		MinDSAPBits:    minBits,
+		MinDSAQBits:    250,
+	}
+}
+
+func parseKeyStrengthPolicy(name string) (keyStrengthPolicy, error) {
+	switch {
+	case name == KeyStrengthPolicyMozillaIntermediate:
+		return mozillaIntermediatePolicy, nil
+	case name == KeyStrengthPolicyBSITR02102:
+		return bsiTR02102Policy(time.Now().Year()), nil
+	case strings.HasPrefix(name, KeyStrengthPolicyBSITR02102+"-"):
+		year, err := strconv.Atoi(strings.TrimPrefix(name, KeyStrengthPolicyBSITR02102+"-"))
+		if err != nil {
+			return keyStrengthPolicy{}, fmt.Errorf("invalid year in key strength policy %s", name)
+		}
+		return bsiTR02102Policy(year), nil
+	default:
+		return keyStrengthPolicy{}, fmt.Errorf("unknown key strength policy %s", name)
+	}
+}
+
+// the key strength policy, which is used if the scan does not select one
+var defaultKeyStrengthPolicy = os.Getenv("KEY_STRENGTH_POLICY")
+
+// returns the selected policy.
+// if the name is empty or invalid, the default policy (BSI TR-02102 of the current year) is used.
+func selectKeyStrengthPolicy(name string) keyStrengthPolicy {
+	if name == "" {
+		name = defaultKeyStrengthPolicy
+	}
+	if name == "" {
+		return bsiTR02102Policy(time.Now().Year())
+	}
+	policy, err := parseKeyStrengthPolicy(name)
+	if err != nil {
+		slog.Warn("could not parse key strength policy - using BSI TR-02102 as fallback", "policy", name, "err", err)
+		return bsiTR02102Policy(time.Now().Year())
+	}
+	return policy
+}
+
+// returns the name of the named curve of an EC subject public key info
+func namedCurve(rawSubjectPublicKeyInfo []byte) (string, error) {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(rawSubjectPublicKeyInfo, &spki); err != nil {
+		return "", err
+	}
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(spki.Algorithm.Parameters.FullBytes, &oid); err != nil {
+		return "", err
+	}
+	if curve, ok := namedCurves[oid.String()]; ok {
+		return curve, nil
+	}
+	return oid.String(), nil
+}
+
+// returns the raw subject public key info of a DER encoded certificate (RFC5280 Section 4.1).
+// the certificate is not parsed using crypto/x509 - it rejects every public key it does not support (e.g. brainpool curves).
+func subjectPublicKeyInfo(rawCertificate []byte) ([]byte, error) {
+	input := cryptobyte.String(rawCertificate)
+	var certificate, tbsCertificate cryptobyte.String
+	if !input.ReadASN1(&certificate, cryptobyteasn1.SEQUENCE) ||
+		!certificate.ReadASN1(&tbsCertificate, cryptobyteasn1.SEQUENCE) {
+		return nil, errors.New("malformed certificate")
+	}
+	// version is optional and explicitly tagged
+	if !tbsCertificate.SkipOptionalASN1(cryptobyteasn1.Tag(0).Constructed().ContextSpecific()) ||
+		// serialNumber
+		!tbsCertificate.SkipASN1(cryptobyteasn1.INTEGER) ||
+		// signature, issuer, validity and subject
+		!tbsCertificate.SkipASN1(cryptobyteasn1.SEQUENCE) ||
+		!tbsCertificate.SkipASN1(cryptobyteasn1.SEQUENCE) ||
+		!tbsCertificate.SkipASN1(cryptobyteasn1.SEQUENCE) ||
+		!tbsCertificate.SkipASN1(cryptobyteasn1.SEQUENCE) {
+		return nil, errors.New("malformed tbs certificate")
+	}
+	var spki cryptobyte.String
+	if !tbsCertificate.ReadASN1Element(&spki, cryptobyteasn1.SEQUENCE) {
+		return nil, errors.New("malformed subject public key info")
+	}
+	return spki, nil
+}
+
+// evaluates the public key of a DER encoded certificate, which could not be parsed by crypto/x509.
+// a key supported by crypto/x509 is evaluated like the key of a parsed certificate - an EC key is evaluated using the named curve only.
+func isStrongRawPrivateKey(rawCertificate []byte, policy keyStrengthPolicy) AnalysisResult {
+	start := time.Now()
+	rawSubjectPublicKeyInfo, err := subjectPublicKeyInfo(rawCertificate)
+	if err != nil {
+		return NewAnalysisResult(Unknown, map[string]any{"policy": policy, "error": err.Error()}, nil, nil, time.Since(start))
+	}
+	if publicKey, err := x509.ParsePKIXPublicKey(rawSubjectPublicKeyInfo); err == nil {
+		return isStrongPrivateKey(&x509.Certificate{PublicKey: publicKey, RawSubjectPublicKeyInfo: rawSubjectPublicKeyInfo}, policy)
+	}
+
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(rawSubjectPublicKeyInfo, &spki); err != nil {
+		return NewAnalysisResult(Unknown, map[string]any{"policy": policy, "error": err.Error()}, nil, nil, time.Since(start))
+	}
+	actualValue := map[string]any{
+		"policy":  policy,
+		"keyType": spki.Algorithm.Algorithm.String(),
+		"keySize": 0,
+	}
+	if !spki.Algorithm.Algorithm.Equal(oidPublicKeyECDSA) {
+		return NewAnalysisResult(Failure, actualValue, []string{KeyTypeNotAllowed}, nil, time.Since(start))
+	}
+
+	curve, err := namedCurve(rawSubjectPublicKeyInfo)
+	if err != nil {
+		return NewAnalysisResult(Unknown, map[string]any{"policy": policy, "error": err.Error()}, nil, nil, time.Since(start))
+	}
+	actualValue["keyType"] = "ECDSA"
+	actualValue["keySize"] = namedCurveBitSizes[curve]
+	actualValue["curve"] = curve
+	if !utils.Includes(policy.AllowedCurves, curve) {
+		return NewAnalysisResult(Failure, actualValue, []string{CurveNotAllowed}, nil, time.Since(start))
+	}
+	return NewAnalysisResult(Success, actualValue, nil, nil, time.Since(start))
+}
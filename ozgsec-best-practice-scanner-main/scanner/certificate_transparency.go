@@ -0,0 +1,389 @@
+package scanner
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+	cryptobyteasn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// the signed certificate timestamp list extension of a certificate (RFC6962 Section 3.3)
+var sctListExtensionOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// the signed certificate timestamp list extension of an OCSP response (RFC6962 Section 3.3)
+var ocspSCTListExtensionOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 5}
+
+const (
+	SCTSourceEmbedded = "embedded"
+	SCTSourceTLS      = "tlsExtension"
+	SCTSourceOCSP     = "ocsp"
+)
+
+const (
+	NoSCT               = "noSignedCertificateTimestamps"
+	InsufficientCTLogs  = "insufficientCTLogs"
+	SCTInvalid          = "sctInvalid"
+	SCTInvalidSignature = "sctInvalidSignature"
+	SCTUnknownLog       = "sctUnknownLog"
+	SCTLogNotQualified  = "sctLogNotQualified"
+)
+
+// RFC5246 Section 7.4.1.4.1
+const (
+	sctHashAlgorithmSHA256     = 4
+	sctSignatureAlgorithmRSA   = 1
+	sctSignatureAlgorithmECDSA = 3
+)
+
+// RFC6962 Section 3.1
+const (
+	sctEntryTypeX509    = 0
+	sctEntryTypePrecert = 1
+)
+
+// path to a CT log list in the format of the Chrome (https://www.gstatic.com/ct/log_list/v3/log_list.json)
+// or Apple (https://valid.apple.com/ct/log_list/current_log_list.json) log list
+var ctLogListPath = os.Getenv("CT_LOG_LIST")
+
+// the minimum number of distinct logs, which need to provide a valid signed certificate timestamp
+var ctMinimumDistinctLogs = parseCTMinimumDistinctLogs(os.Getenv("CT_MINIMUM_DISTINCT_LOGS"))
+
+func parseCTMinimumDistinctLogs(value string) int {
+	if value == "" {
+		return 2
+	}
+	logs, err := strconv.Atoi(value)
+	if err != nil || logs < 1 {
+		slog.Warn("could not parse CT_MINIMUM_DISTINCT_LOGS - using 2 logs as fallback", "value", value)
+		return 2
+	}
+	return logs
+}
+
+type ctLogListFile struct {
+	Operators []struct {
+		Name      string         `json:"name"`
+		Logs      []ctLogListLog `json:"logs"`
+		TiledLogs []ctLogListLog `json:"tiled_logs"`
+	} `json:"operators"`
+}
+
+type ctLogListLog struct {
+	Description string `json:"description"`
+	Key         string `json:"key"`
+	// the key of the map is the state (e.g. usable, readonly or retired)
+	State map[string]struct {
+		Timestamp time.Time `json:"timestamp"`
+	} `json:"state"`
+	TemporalInterval *struct {
+		StartInclusive time.Time `json:"start_inclusive"`
+		EndExclusive   time.Time `json:"end_exclusive"`
+	} `json:"temporal_interval"`
+}
+
+type ctLog struct {
+	description    string
+	operator       string
+	key            crypto.PublicKey
+	state          string
+	stateTimestamp time.Time
+	// the log does only accept certificates, which expire inside the interval
+	notAfterStart time.Time
+	notAfterEnd   time.Time
+}
+
+// the key is the log id - the SHA-256 hash of the DER encoded public key of the log
+type ctLogList map[[sha256.Size]byte]ctLog
+
+func parseCTLogList(data []byte) (ctLogList, error) {
+	var file ctLogListFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	logs := make(ctLogList)
+	for _, operator := range file.Operators {
+		for _, log := range append(operator.Logs, operator.TiledLogs...) {
+			der, err := base64.StdEncoding.DecodeString(log.Key)
+			if err != nil {
+				return nil, fmt.Errorf("could not decode key of log %s: %w", log.Description, err)
+			}
+			key, err := x509.ParsePKIXPublicKey(der)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse key of log %s: %w", log.Description, err)
+			}
+			entry := ctLog{
+				description: log.Description,
+				operator:    operator.Name,
+				key:         key,
+			}
+			for state, value := range log.State {
+				entry.state = state
+				entry.stateTimestamp = value.Timestamp
+			}
+			if log.TemporalInterval != nil {
+				entry.notAfterStart = log.TemporalInterval.StartInclusive
+				entry.notAfterEnd = log.TemporalInterval.EndExclusive
+			}
+			logs[sha256.Sum256(der)] = entry
+		}
+	}
+	return logs, nil
+}
+
+func loadCTLogList(path string) (ctLogList, error) {
+	if path == "" {
+		return ctLogList{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ctLogList{}, err
+	}
+	return parseCTLogList(data)
+}
+
+// checks if the log was qualified for the certificate at the time the timestamp was issued.
+// pending and rejected logs are never qualified - retired logs only for timestamps before the retirement.
+func (l ctLog) isQualified(timestamp time.Time, cert *x509.Certificate) bool {
+	switch l.state {
+	case "qualified", "usable", "readonly":
+	case "retired":
+		if !timestamp.Before(l.stateTimestamp) {
+			return false
+		}
+	default:
+		return false
+	}
+	if !l.notAfterStart.IsZero() && (cert.NotAfter.Before(l.notAfterStart) || !cert.NotAfter.Before(l.notAfterEnd)) {
+		return false
+	}
+	return true
+}
+
+func (l ctLog) verifySignature(signed []byte, sct signedCertificateTimestamp) error {
+	if sct.hashAlgorithm != sctHashAlgorithmSHA256 {
+		return fmt.Errorf("unsupported hash algorithm %d", sct.hashAlgorithm)
+	}
+	digest := sha256.Sum256(signed)
+	switch key := l.key.(type) {
+	case *ecdsa.PublicKey:
+		if sct.signatureAlgorithm != sctSignatureAlgorithmECDSA || !ecdsa.VerifyASN1(key, digest[:], sct.signature) {
+			return errors.New("invalid ecdsa signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		if sct.signatureAlgorithm != sctSignatureAlgorithmRSA {
+			return errors.New("invalid rsa signature")
+		}
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sct.signature)
+	default:
+		return fmt.Errorf("unsupported log key type %T", l.key)
+	}
+}
+
+// RFC6962 Section 3.2
+type signedCertificateTimestamp struct {
+	version            uint8
+	logID              [sha256.Size]byte
+	timestamp          uint64
+	extensions         []byte
+	hashAlgorithm      uint8
+	signatureAlgorithm uint8
+	signature          []byte
+}
+
+func (s signedCertificateTimestamp) time() time.Time {
+	return time.UnixMilli(int64(s.timestamp)) // nolint: gosec // the timestamp is milliseconds since the epoch
+}
+
+func parseSCT(raw []byte) (signedCertificateTimestamp, error) {
+	var sct signedCertificateTimestamp
+	var logID, extensions, signature cryptobyte.String
+	input := cryptobyte.String(raw)
+	if !input.ReadUint8(&sct.version) ||
+		!input.ReadBytes((*[]byte)(&logID), sha256.Size) ||
+		!input.ReadUint64(&sct.timestamp) ||
+		!input.ReadUint16LengthPrefixed(&extensions) ||
+		!input.ReadUint8(&sct.hashAlgorithm) ||
+		!input.ReadUint8(&sct.signatureAlgorithm) ||
+		!input.ReadUint16LengthPrefixed(&signature) ||
+		!input.Empty() {
+		return sct, errors.New("malformed signed certificate timestamp")
+	}
+	// only v1 is defined
+	if sct.version != 0 {
+		return sct, fmt.Errorf("unsupported signed certificate timestamp version %d", sct.version)
+	}
+	copy(sct.logID[:], logID)
+	sct.extensions = extensions
+	sct.signature = signature
+	return sct, nil
+}
+
+// parses the value of a signed certificate timestamp list extension.
+// the TLS encoded list is wrapped inside an ASN.1 OCTET STRING.
+func parseSCTList(extensionValue []byte) ([][]byte, error) {
+	var list []byte
+	if rest, err := asn1.Unmarshal(extensionValue, &list); err != nil || len(rest) > 0 {
+		return nil, errors.New("malformed signed certificate timestamp list")
+	}
+	input := cryptobyte.String(list)
+	var entries cryptobyte.String
+	if !input.ReadUint16LengthPrefixed(&entries) || !input.Empty() {
+		return nil, errors.New("malformed signed certificate timestamp list")
+	}
+	scts := make([][]byte, 0)
+	for !entries.Empty() {
+		var sct cryptobyte.String
+		if !entries.ReadUint16LengthPrefixed(&sct) {
+			return nil, errors.New("malformed signed certificate timestamp list")
+		}
+		scts = append(scts, sct)
+	}
+	return scts, nil
+}
+
+// reconstructs the TBSCertificate of the precertificate, which was signed by the log.
+// this is the TBSCertificate of the final certificate without the signed certificate timestamp list extension (RFC6962 Section 3.2).
+func precertificateTBS(cert *x509.Certificate) ([]byte, error) {
+	input := cryptobyte.String(cert.RawTBSCertificate)
+	var tbs cryptobyte.String
+	if !input.ReadASN1(&tbs, cryptobyteasn1.SEQUENCE) {
+		return nil, errors.New("malformed tbs certificate")
+	}
+	extensionsTag := cryptobyteasn1.Tag(3).Constructed().ContextSpecific()
+
+	var b cryptobyte.Builder
+	b.AddASN1(cryptobyteasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		for !tbs.Empty() {
+			var element cryptobyte.String
+			var tag cryptobyteasn1.Tag
+			if !tbs.ReadAnyASN1Element(&element, &tag) {
+				b.SetError(errors.New("malformed tbs certificate"))
+				return
+			}
+			if tag != extensionsTag {
+				b.AddBytes(element)
+				continue
+			}
+			var explicit, extensions cryptobyte.String
+			if !element.ReadASN1(&explicit, extensionsTag) || !explicit.ReadASN1(&extensions, cryptobyteasn1.SEQUENCE) {
+				b.SetError(errors.New("malformed extensions"))
+				return
+			}
+			b.AddASN1(extensionsTag, func(b *cryptobyte.Builder) {
+				b.AddASN1(cryptobyteasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+					for !extensions.Empty() {
+						var extension, content cryptobyte.String
+						var oid asn1.ObjectIdentifier
+						if !extensions.ReadASN1Element(&extension, cryptobyteasn1.SEQUENCE) {
+							b.SetError(errors.New("malformed extension"))
+							return
+						}
+						inner := extension
+						if !inner.ReadASN1(&content, cryptobyteasn1.SEQUENCE) || !content.ReadASN1ObjectIdentifier(&oid) {
+							b.SetError(errors.New("malformed extension"))
+							return
+						}
+						if oid.Equal(sctListExtensionOID) {
+							continue
+						}
+						b.AddBytes(extension)
+					}
+				})
+			})
+		}
+	})
+	return b.Bytes()
+}
+
+// builds the data, which is signed by the log (RFC6962 Section 3.2).
+// embedded timestamps are issued for the precertificate - timestamps delivered using the tls extension or OCSP for the certificate itself.
+func sctSignedData(sct signedCertificateTimestamp, source string, cert, issuer *x509.Certificate) ([]byte, error) {
+	var b cryptobyte.Builder
+	b.AddUint8(sct.version)
+	// signature type: certificate_timestamp
+	b.AddUint8(0)
+	b.AddUint64(sct.timestamp)
+	if source == SCTSourceEmbedded {
+		if issuer == nil {
+			return nil, errors.New("the issuer is required to verify embedded signed certificate timestamps")
+		}
+		tbs, err := precertificateTBS(cert)
+		if err != nil {
+			return nil, err
+		}
+		issuerKeyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+		b.AddUint16(sctEntryTypePrecert)
+		b.AddBytes(issuerKeyHash[:])
+		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(tbs)
+		})
+	} else {
+		b.AddUint16(sctEntryTypeX509)
+		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(cert.Raw)
+		})
+	}
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(sct.extensions)
+	})
+	return b.Bytes()
+}
+
+type sctVerification struct {
+	Source    string `json:"source"`
+	LogID     string `json:"logId,omitempty"`
+	Log       string `json:"log,omitempty"`
+	Operator  string `json:"operator,omitempty"`
+	Timestamp string `json:"timestamp,omitempty"`
+	Valid     bool   `json:"valid"`
+	Error     string `json:"error,omitempty"`
+}
+
+func verifySCT(raw []byte, source string, cert, issuer *x509.Certificate, logs ctLogList) sctVerification {
+	res := sctVerification{Source: source}
+	sct, err := parseSCT(raw)
+	if err != nil {
+		res.Error = SCTInvalid
+		return res
+	}
+	res.LogID = base64.StdEncoding.EncodeToString(sct.logID[:])
+	res.Timestamp = sct.time().UTC().Format(time.RFC3339)
+
+	log, ok := logs[sct.logID]
+	if !ok {
+		res.Error = SCTUnknownLog
+		return res
+	}
+	res.Log = log.description
+	res.Operator = log.operator
+
+	if sct.time().After(time.Now()) || !log.isQualified(sct.time(), cert) {
+		res.Error = SCTLogNotQualified
+		return res
+	}
+	signed, err := sctSignedData(sct, source, cert, issuer)
+	if err != nil {
+		res.Error = SCTInvalid
+		return res
+	}
+	if err := log.verifySignature(signed, sct); err != nil {
+		res.Error = SCTInvalidSignature
+		return res
+	}
+	res.Valid = true
+	return res
+}
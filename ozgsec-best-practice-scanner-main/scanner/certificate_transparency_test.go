@@ -0,0 +1,242 @@
+package scanner
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+type testCTLog struct {
+	description string
+	key         *ecdsa.PrivateKey
+}
+
+func newTestCTLog(t *testing.T, description string) testCTLog {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testCTLog{description: description, key: key}
+}
+
+func (l testCTLog) logListEntry(t *testing.T) map[string]any {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&l.key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logID := sha256.Sum256(der)
+	return map[string]any{
+		"description": l.description,
+		"log_id":      base64.StdEncoding.EncodeToString(logID[:]),
+		"key":         base64.StdEncoding.EncodeToString(der),
+		"url":         "https://ct.example.com/" + l.description + "/",
+		"state": map[string]any{
+			"usable": map[string]any{"timestamp": "2024-01-01T00:00:00Z"},
+		},
+	}
+}
+
+// issues a signed certificate timestamp for the provided entry
+func (l testCTLog) sign(t *testing.T, entryType uint16, entry []byte) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&l.key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sct := signedCertificateTimestamp{
+		logID:              sha256.Sum256(der),
+		timestamp:          uint64(time.Now().Add(-1 * time.Hour).UnixMilli()),
+		hashAlgorithm:      sctHashAlgorithmSHA256,
+		signatureAlgorithm: sctSignatureAlgorithmECDSA,
+	}
+
+	var signed cryptobyte.Builder
+	signed.AddUint8(0)
+	signed.AddUint8(0)
+	signed.AddUint64(sct.timestamp)
+	signed.AddUint16(entryType)
+	signed.AddBytes(entry)
+	signed.AddUint16(0)
+	digest := sha256.Sum256(signed.BytesOrPanic())
+	sct.signature, err = ecdsa.SignASN1(rand.Reader, l.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b cryptobyte.Builder
+	b.AddUint8(sct.version)
+	b.AddBytes(sct.logID[:])
+	b.AddUint64(sct.timestamp)
+	b.AddUint16(0)
+	b.AddUint8(sct.hashAlgorithm)
+	b.AddUint8(sct.signatureAlgorithm)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(sct.signature)
+	})
+	return b.BytesOrPanic()
+}
+
+func newTestCTLogList(t *testing.T, logs ...testCTLog) ctLogList {
+	t.Helper()
+	data, err := json.Marshal(map[string]any{
+		"version": "1.0",
+		"operators": []map[string]any{{
+			"name":  "Test Operator",
+			"email": []string{"ct@example.com"},
+			"logs": utils.Map(logs, func(l testCTLog) map[string]any {
+				return l.logListEntry(t)
+			}),
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := parseCTLogList(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func sctListExtensionValue(t *testing.T, scts ...[]byte) []byte {
+	t.Helper()
+	var b cryptobyte.Builder
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		for _, sct := range scts {
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				b.AddBytes(sct)
+			})
+		}
+	})
+	value, err := asn1.Marshal(b.BytesOrPanic())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+// issues a certificate with embedded signed certificate timestamps.
+// the precertificate is the same certificate without the sct list extension.
+func issueTestCertificateWithSCTs(t *testing.T, issuer testCertificate, logs ...testCTLog) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-2 * time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	precertDER, err := x509.CreateCertificate(rand.Reader, template, issuer.cert, &key.PublicKey, issuer.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	precert, err := x509.ParseCertificate(precertDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuerKeyHash := sha256.Sum256(issuer.cert.RawSubjectPublicKeyInfo)
+	var entry cryptobyte.Builder
+	entry.AddBytes(issuerKeyHash[:])
+	entry.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(precert.RawTBSCertificate)
+	})
+	scts := utils.Map(logs, func(l testCTLog) []byte {
+		return l.sign(t, sctEntryTypePrecert, entry.BytesOrPanic())
+	})
+
+	template.ExtraExtensions = []pkix.Extension{{Id: sctListExtensionOID, Value: sctListExtensionValue(t, scts...)}}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer.cert, &key.PublicKey, issuer.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestCertificateTransparency(t *testing.T) {
+	ca := newTestCA(t, "Test CA", nil)
+	logA := newTestCTLog(t, "log-a")
+	logB := newTestCTLog(t, "log-b")
+	unknownLog := newTestCTLog(t, "unknown")
+	logList := newTestCTLogList(t, logA, logB)
+
+	leaf := issueTestCertificate(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "example.com"},
+		DNSNames: []string{"example.com"},
+	}, &ca)
+	x509Entry := func(l testCTLog) []byte {
+		var b cryptobyte.Builder
+		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(leaf.cert.Raw)
+		})
+		return l.sign(t, sctEntryTypeX509, b.BytesOrPanic())
+	}
+	forged := x509Entry(logA)
+	forged[len(forged)-1] ^= 0xff
+
+	table := []struct {
+		name             string
+		state            *tls.ConnectionState
+		logs             ctLogList
+		expected         DidPass
+		expectedError    string
+		expectedSCTError string
+		verifiedLogs     int
+	}{
+		{"embedded", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{issueTestCertificateWithSCTs(t, ca, logA, logB), ca.cert}}, logList, Success, "", "", 2},
+		{"embedded from a single log", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{issueTestCertificateWithSCTs(t, ca, logA, logA), ca.cert}}, logList, Failure, InsufficientCTLogs, "", 1},
+		{"tls extension", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf.cert, ca.cert}, SignedCertificateTimestamps: [][]byte{x509Entry(logA), x509Entry(logB)}}, logList, Success, "", "", 2},
+		{"invalid signature", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf.cert, ca.cert}, SignedCertificateTimestamps: [][]byte{forged, x509Entry(logB)}}, logList, Failure, InsufficientCTLogs, SCTInvalidSignature, 1},
+		{"unknown log", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf.cert, ca.cert}, SignedCertificateTimestamps: [][]byte{x509Entry(unknownLog), x509Entry(logB)}}, logList, Failure, InsufficientCTLogs, SCTUnknownLog, 1},
+		{"no scts", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf.cert, ca.cert}}, logList, Failure, NoSCT, "", 0},
+		{"no log list", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf.cert, ca.cert}, SignedCertificateTimestamps: [][]byte{x509Entry(logA)}}, ctLogList{}, Success, "", SCTUnknownLog, 0},
+		{"no log list and malformed scts", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf.cert, ca.cert}, SignedCertificateTimestamps: [][]byte{{0x00}}}, ctLogList{}, Failure, NoSCT, SCTInvalid, 0},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			analyzer := certificateAnalyzer{ctLogs: test.logs}
+			result := analyzer.certificateTransparency(context.Background(), Target{}, test.state)
+			if result.DidPass != test.expected {
+				t.Fatalf("Expected %v, got %v (%v)", test.expected, result.DidPass, result.ActualValue)
+			}
+			if test.expectedError != "" && !utils.Includes(result.Errors, test.expectedError) {
+				t.Errorf("Expected error %s, got %v", test.expectedError, result.Errors)
+			}
+			actualValue := result.ActualValue.(map[string]any)
+			if verifiedLogs := actualValue["verifiedLogs"].([]string); len(verifiedLogs) != test.verifiedLogs {
+				t.Errorf("Expected %d verified logs, got %v", test.verifiedLogs, verifiedLogs)
+			}
+			if test.expectedSCTError != "" && !utils.Some(actualValue["scts"].([]sctVerification), func(sct sctVerification) bool {
+				return sct.Error == test.expectedSCTError
+			}) {
+				t.Errorf("Expected sct error %s, got %v", test.expectedSCTError, actualValue["scts"])
+			}
+		})
+	}
+}
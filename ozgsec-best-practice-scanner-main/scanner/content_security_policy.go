@@ -0,0 +1,304 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/httpclient"
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+const (
+	CSPReportOnly            = "reportOnly"
+	CSPUnsafeInline          = "unsafeInline"
+	CSPUnsafeEval            = "unsafeEval"
+	CSPWildcardSource        = "wildcardSource"
+	CSPInsecureSource        = "insecureSource"
+	CSPDataScriptSource      = "dataScriptSource"
+	CSPMissingObjectSrcNone  = "missingObjectSrcNone"
+	CSPMissingBaseURI        = "missingBaseUri"
+	CSPMissingFrameAncestors = "missingFrameAncestors"
+	CSPMissingReporting      = "missingReporting"
+)
+
+const (
+	cspSourceHeader = "header"
+	cspSourceMeta   = "meta"
+
+	cspDispositionEnforce = "enforce"
+	cspDispositionReport  = "report"
+)
+
+// directives, which are ignored by the browser if the policy is delivered using a <meta> element
+var cspHeaderOnlyDirectives = []string{"frame-ancestors", "report-uri", "report-to", "sandbox"}
+
+// a single parsed policy (https://www.w3.org/TR/CSP3/#parse-serialized-policy)
+type contentSecurityPolicy struct {
+	Source      string              `json:"source"`
+	Disposition string              `json:"disposition"`
+	Directives  map[string][]string `json:"directives"`
+	// the reporting endpoints of the report-uri and report-to directives
+	ReportingEndpoints []string `json:"reportingEndpoints"`
+}
+
+// parses a serialized policy - duplicate and invalid directives are ignored like in the browser
+func parseContentSecurityPolicy(serialized, source, disposition string) contentSecurityPolicy {
+	policy := contentSecurityPolicy{
+		Source:             source,
+		Disposition:        disposition,
+		Directives:         make(map[string][]string),
+		ReportingEndpoints: make([]string, 0),
+	}
+	for _, token := range strings.Split(serialized, ";") {
+		fields := strings.Fields(token)
+		if len(fields) == 0 {
+			continue
+		}
+		name := strings.ToLower(fields[0])
+		if !isValidCSPDirectiveName(name) {
+			continue
+		}
+		if _, ok := policy.Directives[name]; ok {
+			continue
+		}
+		if source == cspSourceMeta && utils.Includes(cspHeaderOnlyDirectives, name) {
+			continue
+		}
+		policy.Directives[name] = fields[1:]
+	}
+	return policy
+}
+
+func isValidCSPDirectiveName(name string) bool {
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// parses every policy of the header values - a header value might contain multiple policies separated by a comma
+func parseContentSecurityPolicyHeader(values []string, disposition string) []contentSecurityPolicy {
+	policies := make([]contentSecurityPolicy, 0)
+	for _, value := range values {
+		for _, serialized := range strings.Split(value, ",") {
+			if strings.TrimSpace(serialized) == "" {
+				continue
+			}
+			policies = append(policies, parseContentSecurityPolicy(serialized, cspSourceHeader, disposition))
+		}
+	}
+	return policies
+}
+
+// returns the policies of the <meta http-equiv="Content-Security-Policy"> elements in the head of the document.
+// a report only policy is ignored by the browser, if it is delivered using a <meta> element.
+func parseContentSecurityPolicyMeta(body []byte) []contentSecurityPolicy {
+	policies := make([]contentSecurityPolicy, 0)
+	tkn := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		t := tkn.Next()
+		if t == html.ErrorToken {
+			return policies
+		}
+		if t != html.StartTagToken && t != html.SelfClosingTagToken {
+			continue
+		}
+		tknTag := tkn.Token()
+		if tknTag.Data == "body" {
+			return policies
+		}
+		if tknTag.Data != "meta" {
+			continue
+		}
+		httpEquiv, content := "", ""
+		for _, a := range tknTag.Attr {
+			switch a.Key {
+			case "http-equiv":
+				httpEquiv = a.Val
+			case "content":
+				content = a.Val
+			}
+		}
+		if strings.EqualFold(httpEquiv, "Content-Security-Policy") && strings.TrimSpace(content) != "" {
+			policies = append(policies, parseContentSecurityPolicy(content, cspSourceMeta, cspDispositionEnforce))
+		}
+	}
+}
+
+// returns the endpoints configured by the Reporting-Endpoints header (name="url") and the legacy Report-To header (JSON)
+func reportingEndpointGroups(header http.Header) map[string]string {
+	groups := make(map[string]string)
+	for _, value := range header.Values("Reporting-Endpoints") {
+		for _, member := range strings.Split(value, ",") {
+			name, endpoint, ok := strings.Cut(member, "=")
+			if !ok {
+				continue
+			}
+			groups[strings.TrimSpace(name)] = strings.Trim(strings.TrimSpace(endpoint), `"`)
+		}
+	}
+	for _, value := range header.Values("Report-To") {
+		var reportTo []struct {
+			Group     string `json:"group"`
+			Endpoints []struct {
+				URL string `json:"url"`
+			} `json:"endpoints"`
+		}
+		if err := json.Unmarshal([]byte("["+value+"]"), &reportTo); err != nil {
+			continue
+		}
+		for _, group := range reportTo {
+			name := group.Group
+			if name == "" {
+				name = "default"
+			}
+			if _, ok := groups[name]; !ok && len(group.Endpoints) > 0 {
+				groups[name] = group.Endpoints[0].URL
+			}
+		}
+	}
+	return groups
+}
+
+// resolves the report-uri and report-to directives - a report-to group without an endpoint is not reported
+func (p *contentSecurityPolicy) resolveReportingEndpoints(groups map[string]string) {
+	p.ReportingEndpoints = append(p.ReportingEndpoints, p.Directives["report-uri"]...)
+	for _, group := range p.Directives["report-to"] {
+		if endpoint, ok := groups[group]; ok && !utils.Includes(p.ReportingEndpoints, endpoint) {
+			p.ReportingEndpoints = append(p.ReportingEndpoints, endpoint)
+		}
+	}
+}
+
+// returns the source list of the directive or of default-src, if the directive is missing
+func (p contentSecurityPolicy) effectiveSources(directive string) ([]string, bool) {
+	if sources, ok := p.Directives[directive]; ok {
+		return sources, true
+	}
+	sources, ok := p.Directives["default-src"]
+	return sources, ok
+}
+
+func hasCSPSource(sources []string, source string) bool {
+	return utils.Some(sources, func(s string) bool {
+		return strings.EqualFold(s, source)
+	})
+}
+
+func hasCSPNonceOrHash(sources []string) bool {
+	return utils.Some(sources, func(s string) bool {
+		s = strings.ToLower(s)
+		return strings.HasPrefix(s, "'nonce-") || strings.HasPrefix(s, "'sha256-") || strings.HasPrefix(s, "'sha384-") || strings.HasPrefix(s, "'sha512-")
+	})
+}
+
+// returns the script sources, which are not ignored by the browser.
+// 'strict-dynamic' in combination with a nonce or a hash disables every host and scheme source.
+func (p contentSecurityPolicy) scriptSources() ([]string, bool) {
+	sources, ok := p.effectiveSources("script-src")
+	if !ok {
+		return nil, false
+	}
+	if hasCSPSource(sources, "'strict-dynamic'") && hasCSPNonceOrHash(sources) {
+		return utils.Filter(sources, func(s string) bool {
+			return strings.HasPrefix(s, "'")
+		}), true
+	}
+	return sources, true
+}
+
+// a source, which allows any host
+func isWildcardCSPSource(source string) bool {
+	source = strings.ToLower(source)
+	return source == "*" || source == "http:" || source == "https:" || strings.HasSuffix(source, "://*")
+}
+
+func isInsecureCSPSource(source string) bool {
+	source = strings.ToLower(source)
+	return source == "http:" || strings.HasPrefix(source, "http://")
+}
+
+func newContentSecurityPolicyValidator() validator[contentSecurityPolicy] {
+	return NewValidator(FnMap[contentSecurityPolicy]{
+		CSPUnsafeInline: func(p contentSecurityPolicy) bool {
+			sources, ok := p.scriptSources()
+			return ok && hasCSPSource(sources, "'unsafe-inline'") && !hasCSPNonceOrHash(sources)
+		},
+		CSPUnsafeEval: func(p contentSecurityPolicy) bool {
+			sources, ok := p.scriptSources()
+			return ok && hasCSPSource(sources, "'unsafe-eval'") && !hasCSPNonceOrHash(sources)
+		},
+		CSPWildcardSource: func(p contentSecurityPolicy) bool {
+			scriptSources, _ := p.scriptSources()
+			objectSources, _ := p.effectiveSources("object-src")
+			return utils.Some(scriptSources, isWildcardCSPSource) || utils.Some(objectSources, isWildcardCSPSource)
+		},
+		CSPInsecureSource: func(p contentSecurityPolicy) bool {
+			for _, sources := range p.Directives {
+				if utils.Some(sources, isInsecureCSPSource) {
+					return true
+				}
+			}
+			return false
+		},
+		CSPDataScriptSource: func(p contentSecurityPolicy) bool {
+			sources, ok := p.scriptSources()
+			return ok && hasCSPSource(sources, "data:")
+		},
+	}, FnMap[contentSecurityPolicy]{
+		MissingDefaultSrcWithSelf: func(p contentSecurityPolicy) bool {
+			sources := p.Directives["default-src"]
+			return !hasCSPSource(sources, "'self'") && !hasCSPSource(sources, "'none'")
+		},
+		MissingScriptSrc: func(p contentSecurityPolicy) bool {
+			_, ok := p.effectiveSources("script-src")
+			return !ok
+		},
+		MissingStyleSrc: func(p contentSecurityPolicy) bool {
+			_, ok := p.effectiveSources("style-src")
+			return !ok
+		},
+		MissingImgSrc: func(p contentSecurityPolicy) bool {
+			_, ok := p.effectiveSources("img-src")
+			return !ok
+		},
+		CSPMissingObjectSrcNone: func(p contentSecurityPolicy) bool {
+			sources, _ := p.effectiveSources("object-src")
+			return len(sources) != 1 || !strings.EqualFold(sources[0], "'none'")
+		},
+		CSPMissingBaseURI: func(p contentSecurityPolicy) bool {
+			_, ok := p.Directives["base-uri"]
+			return !ok
+		},
+		CSPMissingFrameAncestors: func(p contentSecurityPolicy) bool {
+			_, ok := p.Directives["frame-ancestors"]
+			return !ok
+		},
+		CSPMissingReporting: func(p contentSecurityPolicy) bool {
+			return len(p.ReportingEndpoints) == 0
+		},
+	})
+}
+
+// returns every policy of the response - the policies of the header, the report only header and the <meta> elements
+func contentSecurityPolicies(resp httpclient.Response) []contentSecurityPolicy {
+	header := resp.Response().Header
+	policies := append(
+		parseContentSecurityPolicyHeader(header.Values("Content-Security-Policy"), cspDispositionEnforce),
+		parseContentSecurityPolicyHeader(header.Values("Content-Security-Policy-Report-Only"), cspDispositionReport)...,
+	)
+	if body, err := resp.ResponseBody(); err == nil {
+		policies = append(policies, parseContentSecurityPolicyMeta(body)...)
+	}
+	groups := reportingEndpointGroups(header)
+	for i := range policies {
+		policies[i].resolveReportingEndpoints(groups)
+	}
+	return policies
+}
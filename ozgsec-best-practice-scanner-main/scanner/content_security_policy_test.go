@@ -0,0 +1,187 @@
+package scanner
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/httpclient"
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+func TestParseContentSecurityPolicy(t *testing.T) {
+	policy := parseContentSecurityPolicy("default-src 'self';  SCRIPT-SRC 'nonce-abc' 'strict-dynamic' https:; script-src *; in_valid x;;upgrade-insecure-requests", cspSourceHeader, cspDispositionEnforce)
+
+	expected := map[string][]string{
+		"default-src":               {"'self'"},
+		"script-src":                {"'nonce-abc'", "'strict-dynamic'", "https:"},
+		"upgrade-insecure-requests": {},
+	}
+	if len(policy.Directives) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, policy.Directives)
+	}
+	for name, values := range expected {
+		if actual, ok := policy.Directives[name]; !ok || utils.Join(actual, " ") != utils.Join(values, " ") {
+			t.Errorf("Expected %s to be %v, got %v", name, values, actual)
+		}
+	}
+	// 'strict-dynamic' disables the host and scheme sources
+	if sources, _ := policy.scriptSources(); utils.Some(sources, isWildcardCSPSource) {
+		t.Errorf("Expected https: to be ignored, got %v", sources)
+	}
+}
+
+func TestParseContentSecurityPolicyMeta(t *testing.T) {
+	body := []byte(`<html><head>
+<meta http-equiv="Content-Security-Policy" content="default-src 'self'; frame-ancestors 'none'; report-uri /csp">
+<meta http-equiv="Content-Security-Policy-Report-Only" content="default-src 'none'">
+</head><body><meta http-equiv="Content-Security-Policy" content="default-src *"></body></html>`)
+
+	policies := parseContentSecurityPolicyMeta(body)
+	if len(policies) != 1 {
+		t.Fatalf("Expected a single policy, got %+v", policies)
+	}
+	if policies[0].Source != cspSourceMeta || policies[0].Disposition != cspDispositionEnforce {
+		t.Errorf("Expected an enforced meta policy, got %+v", policies[0])
+	}
+	if _, ok := policies[0].Directives["frame-ancestors"]; ok || len(policies[0].Directives) != 1 {
+		t.Errorf("Expected the header only directives to be ignored, got %v", policies[0].Directives)
+	}
+}
+
+func TestReportingEndpointGroups(t *testing.T) {
+	header := http.Header{}
+	header.Set("Reporting-Endpoints", `csp="https://report.example.test/csp", default="https://report.example.test/"`)
+	header.Set("Report-To", `{"group":"legacy","max_age":10886400,"endpoints":[{"url":"https://legacy.example.test/"}]}`)
+
+	groups := reportingEndpointGroups(header)
+	expected := map[string]string{
+		"csp":     "https://report.example.test/csp",
+		"default": "https://report.example.test/",
+		"legacy":  "https://legacy.example.test/",
+	}
+	for name, endpoint := range expected {
+		if groups[name] != endpoint {
+			t.Errorf("Expected %s to be %s, got %s", name, endpoint, groups[name])
+		}
+	}
+
+	policy := parseContentSecurityPolicy("default-src 'self'; report-uri /csp-report; report-to csp unknown", cspSourceHeader, cspDispositionEnforce)
+	policy.resolveReportingEndpoints(groups)
+	if utils.Join(policy.ReportingEndpoints, " ") != "/csp-report https://report.example.test/csp" {
+		t.Errorf("Expected the report-uri and the csp group, got %v", policy.ReportingEndpoints)
+	}
+}
+
+func TestContentSecurityPolicy(t *testing.T) {
+	const strict = "default-src 'self'; script-src 'self'; style-src 'self'; img-src 'self'; object-src 'none'; base-uri 'self'; frame-ancestors 'none'; report-uri /csp"
+
+	table := []struct {
+		name                    string
+		header                  map[string][]string
+		body                    string
+		expectedDidPass         DidPass
+		expectedErrors          []string
+		expectedRecommendations []string
+		expectedPolicies        int
+	}{
+		{
+			name:            "missing",
+			header:          map[string][]string{},
+			expectedDidPass: Failure,
+			expectedErrors:  []string{MissingHeader},
+		},
+		{
+			name:             "strict",
+			header:           map[string][]string{"Content-Security-Policy": {strict}},
+			expectedDidPass:  Success,
+			expectedPolicies: 1,
+		},
+		{
+			name:             "report only",
+			header:           map[string][]string{"Content-Security-Policy-Report-Only": {strict}},
+			expectedDidPass:  Failure,
+			expectedErrors:   []string{CSPReportOnly},
+			expectedPolicies: 1,
+		},
+		{
+			name:             "unsafe sources",
+			header:           map[string][]string{"Content-Security-Policy": {"default-src 'self'; script-src 'self' 'unsafe-inline' 'unsafe-eval' data: *; object-src 'none'; img-src http://cdn.example.test; base-uri 'none'; frame-ancestors 'self'; report-uri /csp"}},
+			expectedDidPass:  Failure,
+			expectedErrors:   []string{CSPUnsafeInline, CSPUnsafeEval, CSPDataScriptSource, CSPWildcardSource, CSPInsecureSource},
+			expectedPolicies: 1,
+		},
+		{
+			name:             "unsafe-inline with nonce",
+			header:           map[string][]string{"Content-Security-Policy": {"default-src 'self'; script-src 'nonce-r4nd0m' 'unsafe-inline' 'strict-dynamic' https:; object-src 'none'; base-uri 'none'; frame-ancestors 'self'; report-uri /csp"}},
+			expectedDidPass:  Success,
+			expectedPolicies: 1,
+		},
+		{
+			name:                    "missing hardening directives",
+			header:                  map[string][]string{"Content-Security-Policy": {"script-src 'self' https://apis.example.test"}},
+			expectedDidPass:         Success,
+			expectedRecommendations: []string{MissingDefaultSrcWithSelf, MissingStyleSrc, MissingImgSrc, CSPMissingObjectSrcNone, CSPMissingBaseURI, CSPMissingFrameAncestors, CSPMissingReporting},
+			expectedPolicies:        1,
+		},
+		{
+			// the second policy restricts the scripts of the first one
+			name:             "multiple policies",
+			header:           map[string][]string{"Content-Security-Policy": {"default-src * 'unsafe-inline'", strict}},
+			expectedDidPass:  Success,
+			expectedPolicies: 2,
+		},
+		{
+			name:                    "multiple policies in a single header",
+			header:                  map[string][]string{"Content-Security-Policy": {"script-src 'unsafe-inline', script-src 'unsafe-inline' 'unsafe-eval'"}},
+			expectedDidPass:         Failure,
+			expectedErrors:          []string{CSPUnsafeInline},
+			expectedRecommendations: []string{MissingDefaultSrcWithSelf, MissingStyleSrc, MissingImgSrc, CSPMissingObjectSrcNone, CSPMissingBaseURI, CSPMissingFrameAncestors, CSPMissingReporting},
+			expectedPolicies:        2,
+		},
+		{
+			name:                    "meta element",
+			body:                    `<html><head><meta http-equiv="content-security-policy" content="` + strict + `"></head><body></body></html>`,
+			expectedDidPass:         Success,
+			expectedRecommendations: []string{CSPMissingFrameAncestors, CSPMissingReporting},
+			expectedPolicies:        1,
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, values := range test.header {
+					for _, v := range values {
+						w.Header().Add(k, v)
+					}
+				}
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(test.body)) // nolint // the test fails, if the response is missing
+			}))
+			defer server.Close()
+
+			target, _ := url.Parse(server.URL)
+			resp, err := httpclient.NewRedirectAwareHttpClient(nil).Get(context.Background(), target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual := headerAnalyzer{contentSecurityPolicyValidator: newContentSecurityPolicyValidator()}.contentSecurityPolicy(resp)
+
+			if test.expectedDidPass == Success && !actual.IsSuccess() || test.expectedDidPass == Failure && !actual.IsError() {
+				t.Fatalf("Expected %v, got %+v", *test.expectedDidPass, actual)
+			}
+			if len(actual.Errors) != len(test.expectedErrors) || !utils.IncludesSubset(actual.Errors, test.expectedErrors) {
+				t.Errorf("Expected errors %v, got %v", test.expectedErrors, actual.Errors)
+			}
+			if len(actual.Recommendations) != len(test.expectedRecommendations) || !utils.IncludesSubset(actual.Recommendations, test.expectedRecommendations) {
+				t.Errorf("Expected recommendations %v, got %v", test.expectedRecommendations, actual.Recommendations)
+			}
+			if policies := actual.ActualValue.(map[string]any)["policies"].([]contentSecurityPolicy); len(policies) != test.expectedPolicies {
+				t.Errorf("Expected %d policies, got %+v", test.expectedPolicies, policies)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/hex"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// TLSA certificate usages (RFC7218 Section 2.1)
+const (
+	tlsaUsagePKIXTA = 0
+	tlsaUsagePKIXEE = 1
+	tlsaUsageDANETA = 2
+	tlsaUsageDANEEE = 3
+)
+
+// tlsaMatch describes, if a TLSA record matches the certificates presented by the server
+type tlsaMatch struct {
+	Usage        uint8  `json:"usage"`
+	Selector     uint8  `json:"selector"`
+	MatchingType uint8  `json:"matchingType"`
+	Data         string `json:"certificateAssociationData"`
+	Matched      bool   `json:"matched"`
+	// the subject of the certificate, which matched the record
+	MatchedCertificate string `json:"matchedCertificate,omitempty"`
+	// the reason, why a matching certificate is not accepted (e.g. a failed PKIX validation)
+	Error string `json:"error,omitempty"`
+}
+
+// the DANE result of a single mx host and port
+type daneDetails struct {
+	DidPass DidPass     `json:"didPass"`
+	TLSA    []tlsaMatch `json:"tlsa"`
+}
+
+// returns the certificate association data of the certificate (RFC6698 Section 2.1)
+func tlsaAssociationData(cert *x509.Certificate, selector uint8, matchingType uint8) ([]byte, bool) {
+	var data []byte
+	switch selector {
+	case 0:
+		// the full certificate
+		data = cert.Raw
+	case 1:
+		// the DER encoded SubjectPublicKeyInfo
+		data = cert.RawSubjectPublicKeyInfo
+	default:
+		return nil, false
+	}
+
+	switch matchingType {
+	case 0:
+		return data, true
+	case 1:
+		hash := sha256.Sum256(data)
+		return hash[:], true
+	case 2:
+		hash := sha512.Sum512(data)
+		return hash[:], true
+	}
+	return nil, false
+}
+
+func certificateMatchesTLSA(cert *x509.Certificate, tlsa *dns.TLSA) bool {
+	data, ok := tlsaAssociationData(cert, tlsa.Selector, tlsa.MatchingType)
+	return ok && strings.EqualFold(hex.EncodeToString(data), tlsa.Certificate)
+}
+
+// matches the TLSA record against the certificates presented by the server (RFC6698 Section 2.1.1, RFC7671 Section 5).
+// the hostname is used for the name checks of every usage besides DANE-EE.
+// the roots are used for the PKIX validation - if nil, the system roots are used.
+func matchTLSA(certs []*x509.Certificate, hostname string, roots *x509.CertPool, tlsa *dns.TLSA) tlsaMatch {
+	match := tlsaMatch{
+		Usage:        tlsa.Usage,
+		Selector:     tlsa.Selector,
+		MatchingType: tlsa.MatchingType,
+		Data:         strings.ToLower(tlsa.Certificate),
+	}
+	if len(certs) == 0 {
+		match.Error = "no certificate presented"
+		return match
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	verifyOptions := x509.VerifyOptions{
+		DNSName:       strings.TrimSuffix(hostname, "."),
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+
+	switch tlsa.Usage {
+	case tlsaUsageDANEEE, tlsaUsagePKIXEE:
+		if !certificateMatchesTLSA(certs[0], tlsa) {
+			return match
+		}
+		match.MatchedCertificate = certs[0].Subject.String()
+		// DANE-EE does neither check the name nor the validity of the certificate (RFC7671 Section 5.1)
+		if tlsa.Usage == tlsaUsagePKIXEE {
+			if _, err := certs[0].Verify(verifyOptions); err != nil {
+				match.Error = err.Error()
+				return match
+			}
+		}
+		match.Matched = true
+	case tlsaUsageDANETA:
+		// the trust anchor needs to be part of the presented chain
+		for _, cert := range certs {
+			if !certificateMatchesTLSA(cert, tlsa) {
+				continue
+			}
+			match.MatchedCertificate = cert.Subject.String()
+			verifyOptions.Roots = x509.NewCertPool()
+			verifyOptions.Roots.AddCert(cert)
+			if _, err := certs[0].Verify(verifyOptions); err != nil {
+				match.Error = err.Error()
+				continue
+			}
+			match.Matched, match.Error = true, ""
+			break
+		}
+	case tlsaUsagePKIXTA:
+		// the trust anchor needs to be part of a valid PKIX path - it might be a root, which is not presented
+		chains, err := certs[0].Verify(verifyOptions)
+		if err != nil {
+			match.Error = err.Error()
+			return match
+		}
+		for _, chain := range chains {
+			for _, cert := range chain[1:] {
+				if certificateMatchesTLSA(cert, tlsa) {
+					match.Matched = true
+					match.MatchedCertificate = cert.Subject.String()
+					return match
+				}
+			}
+		}
+	default:
+		match.Error = "unknown certificate usage"
+	}
+	return match
+}
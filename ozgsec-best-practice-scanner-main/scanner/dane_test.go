@@ -0,0 +1,62 @@
+package scanner
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func testTLSA(t *testing.T, cert *x509.Certificate, usage, selector, matchingType uint8) *dns.TLSA {
+	t.Helper()
+	data, ok := tlsaAssociationData(cert, selector, matchingType)
+	if !ok {
+		t.Fatalf("invalid selector %d or matching type %d", selector, matchingType)
+	}
+	return &dns.TLSA{Usage: usage, Selector: selector, MatchingType: matchingType, Certificate: hex.EncodeToString(data)}
+}
+
+func TestMatchTLSA(t *testing.T) {
+	root := newTestCA(t, "Test Root", nil)
+	intermediate := newTestCA(t, "Test Intermediate", &root)
+	leaf := issueTestCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "mail.example.test"},
+		DNSNames:    []string{"mail.example.test"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, &intermediate)
+	chain := []*x509.Certificate{leaf.cert, intermediate.cert}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root.cert)
+
+	table := []struct {
+		name     string
+		tlsa     *dns.TLSA
+		hostname string
+		roots    *x509.CertPool
+		expected bool
+	}{
+		{"DANE-EE SPKI SHA-256", testTLSA(t, leaf.cert, tlsaUsageDANEEE, 1, 1), "mail.example.test.", nil, true},
+		{"DANE-EE full certificate SHA-512", testTLSA(t, leaf.cert, tlsaUsageDANEEE, 0, 2), "mail.example.test.", nil, true},
+		{"DANE-EE ignores the name", testTLSA(t, leaf.cert, tlsaUsageDANEEE, 1, 0), "other.example.test.", nil, true},
+		{"DANE-EE of another certificate", testTLSA(t, intermediate.cert, tlsaUsageDANEEE, 1, 1), "mail.example.test.", nil, false},
+		{"DANE-TA intermediate", testTLSA(t, intermediate.cert, tlsaUsageDANETA, 1, 1), "mail.example.test.", nil, true},
+		{"DANE-TA checks the name", testTLSA(t, intermediate.cert, tlsaUsageDANETA, 1, 1), "other.example.test.", nil, false},
+		{"DANE-TA root not presented", testTLSA(t, root.cert, tlsaUsageDANETA, 0, 1), "mail.example.test.", nil, false},
+		{"PKIX-EE", testTLSA(t, leaf.cert, tlsaUsagePKIXEE, 1, 1), "mail.example.test.", roots, true},
+		{"PKIX-EE untrusted", testTLSA(t, leaf.cert, tlsaUsagePKIXEE, 1, 1), "mail.example.test.", x509.NewCertPool(), false},
+		{"PKIX-TA root not presented", testTLSA(t, root.cert, tlsaUsagePKIXTA, 1, 1), "mail.example.test.", roots, true},
+		{"PKIX-TA untrusted", testTLSA(t, intermediate.cert, tlsaUsagePKIXTA, 1, 1), "mail.example.test.", x509.NewCertPool(), false},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			actual := matchTLSA(chain, test.hostname, test.roots, test.tlsa)
+			if actual.Matched != test.expected {
+				t.Errorf("Expected matched to be %v, got %+v", test.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package scanner
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/concurrency"
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+const (
+	DKIMSyntaxError        = "dkimSyntaxError"
+	DKIMUnsupportedKeyType = "dkimUnsupportedKeyType"
+	DKIMWeakKey            = "dkimWeakKey"
+	DKIMAllKeysRevoked     = "dkimAllKeysRevoked"
+
+	DKIMShortKey = "dkimShortKey"
+	DKIMTestMode = "dkimTestMode"
+)
+
+// RFC8301 Section 3.2 - verifiers must not accept shorter keys, signers should use at least 2048 bit
+const (
+	dkimMinRSAKeyLength         = 1024
+	dkimRecommendedRSAKeyLength = 2048
+)
+
+// DefaultDKIMSelectors are used, if no selectors are configured.
+// DKIM selectors can not be enumerated - these are the selectors of common mail providers and mail server defaults.
+var DefaultDKIMSelectors = []string{
+	// generic
+	"default", "dkim", "mail", "email", "smtp", "key1", "key2",
+	// microsoft 365
+	"selector1", "selector2",
+	// google workspace
+	"google",
+	// sendgrid, mailchimp and amazon ses
+	"s1", "s2", "k1", "k2", "k3",
+	// fastmail
+	"fm1", "fm2", "fm3",
+	// proton mail
+	"protonmail", "protonmail2", "protonmail3",
+	// zoho
+	"zmail",
+	// mailjet
+	"mailjet",
+}
+
+// dkimKey is a parsed DKIM key record (RFC6376 Section 3.6.1)
+type dkimKey struct {
+	Selector string `json:"selector"`
+	Record   string `json:"record"`
+	KeyType  string `json:"keyType"`
+	// the length of the key in bits
+	KeyLength int  `json:"keyLength"`
+	Revoked   bool `json:"revoked"`
+	TestMode  bool `json:"testMode"`
+}
+
+type dkimSelectorLookup struct {
+	selector string
+	records  []string
+	err      error
+}
+
+// returns the selectors, which should be looked up for the domain.
+// the selectors configured for the registrable domain of the domain are looked up first.
+func dkimSelectors(options TargetScanOptions, domain string) []string {
+	selectors := DefaultDKIMSelectors
+	if len(options.DKIMSelectors) > 0 {
+		selectors = options.DKIMSelectors
+	}
+	res := make([]string, 0, len(selectors))
+	for _, selector := range append(append([]string{}, options.DomainDKIMSelectors[RegistrableDomain(domain)]...), selectors...) {
+		selector = strings.ToLower(strings.TrimSpace(selector))
+		if selector != "" && !utils.Includes(res, selector) {
+			res = append(res, selector)
+		}
+	}
+	return res
+}
+
+// parses the tag list of a DKIM record (RFC6376 Section 3.2)
+func parseDKIMTags(record string) (map[string]string, bool) {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(record, ";") {
+		if strings.TrimSpace(tag) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(tag, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return tags, false
+		}
+		// duplicate tags make the record invalid
+		if _, exists := tags[name]; exists {
+			return tags, false
+		}
+		tags[name] = strings.TrimSpace(value)
+	}
+	return tags, true
+}
+
+// a TXT record at the selector is only treated as a DKIM record, if it has a version or a public key tag.
+// this avoids interpreting wildcard TXT records (e.g. SPF) as broken DKIM records.
+func isDKIMRecord(record string) bool {
+	tags, _ := parseDKIMTags(record)
+	_, hasKey := tags["p"]
+	return strings.HasPrefix(strings.TrimSpace(record), "v=DKIM1") || hasKey
+}
+
+// parses a DKIM record and returns the key together with the errors (as error ids)
+func parseDKIMRecord(selector string, record string) (dkimKey, []string) {
+	key := dkimKey{
+		Selector: selector,
+		Record:   record,
+		KeyType:  "rsa",
+	}
+
+	tags, ok := parseDKIMTags(record)
+	if !ok {
+		return key, []string{DKIMSyntaxError}
+	}
+	// the version is optional - if it is present, it needs to be the first tag
+	if version, hasVersion := tags["v"]; hasVersion && (version != "DKIM1" || !strings.HasPrefix(strings.TrimSpace(record), "v=")) {
+		return key, []string{DKIMSyntaxError}
+	}
+	if keyType, hasKeyType := tags["k"]; hasKeyType {
+		key.KeyType = strings.ToLower(keyType)
+	}
+	for _, flag := range strings.Split(tags["t"], ":") {
+		if strings.TrimSpace(flag) == "y" {
+			key.TestMode = true
+		}
+	}
+
+	publicKey, hasPublicKey := tags["p"]
+	if !hasPublicKey {
+		return key, []string{DKIMSyntaxError}
+	}
+	// the base64 value might contain whitespace
+	publicKey = strings.Join(strings.Fields(publicKey), "")
+	if publicKey == "" {
+		// an empty public key means, that the key was revoked (RFC6376 Section 3.6.1)
+		key.Revoked = true
+		return key, nil
+	}
+	der, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return key, []string{DKIMSyntaxError}
+	}
+
+	switch key.KeyType {
+	case "rsa":
+		parsed, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			// some providers publish the RSAPublicKey structure instead of the SubjectPublicKeyInfo
+			parsed, err = x509.ParsePKCS1PublicKey(der)
+		}
+		rsaKey, ok := parsed.(*rsa.PublicKey)
+		if err != nil || !ok {
+			return key, []string{DKIMSyntaxError}
+		}
+		key.KeyLength = rsaKey.N.BitLen()
+		if key.KeyLength < dkimMinRSAKeyLength {
+			return key, []string{DKIMWeakKey}
+		}
+	case "ed25519":
+		// the ed25519 public key is published without any encoding (RFC8463 Section 4.2)
+		if len(der) != 32 {
+			return key, []string{DKIMSyntaxError}
+		}
+		key.KeyLength = 256
+	default:
+		return key, []string{DKIMUnsupportedKeyType}
+	}
+	return key, nil
+}
+
+// returns the DKIM records published for the selector
+func (d domainAnalyzer) dkimRecords(ctx context.Context, selector string, domain string) ([]string, error) {
+	name := selector + "._domainkey." + domain
+	msg, err := d.exchange(ctx, name, dns.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Rcode != dns.RcodeSuccess && msg.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("dns lookup of %s failed: %s", name, dns.RcodeToString[msg.Rcode])
+	}
+	records := make([]string, 0)
+	for _, answer := range msg.Answer {
+		if txt, ok := answer.(*dns.TXT); ok && isDKIMRecord(txtRecordValue(txt)) {
+			records = append(records, txtRecordValue(txt))
+		}
+	}
+	return records, nil
+}
+
+/*
+REQUIRED: Every DKIM key found is valid and the RSA keys are at least 1024 bit long (RFC6376, RFC8301)
+REQUIRED: Not every key found is revoked (empty p tag) - a revoked key next to a valid one is the expected result of a key rotation
+
+	DKIM selectors can not be enumerated. The selectors configured for the domain and the configured selectors (or DefaultDKIMSelectors) are looked up at <selector>._domainkey.<domain>.
+	If no selector is found, the result is unknown.
+
+RECOMMENDED: RSA keys are at least 2048 bit long (RFC8301 Section 3.2)
+RECOMMENDED: The keys are not in test mode (t=y)
+
+Source: https://www.rfc-editor.org/rfc/rfc6376, https://www.rfc-editor.org/rfc/rfc8301
+*/
+func (d domainAnalyzer) dkim(ctx context.Context, target Target) AnalysisResult {
+	start := time.Now()
+	hostname := mailDomain(target)
+	selectors := dkimSelectors(target.Options, hostname)
+
+	lookups := concurrency.All(utils.Map(selectors, func(selector string) func() dkimSelectorLookup {
+		return func() dkimSelectorLookup {
+			records, err := d.dkimRecords(ctx, selector, hostname)
+			return dkimSelectorLookup{selector: selector, records: records, err: err}
+		}
+	})...)
+	if utils.Every(lookups, func(lookup dkimSelectorLookup) bool { return lookup.err != nil }) {
+		return NewAnalysisResult(Unknown, nil, nil, nil, time.Since(start))
+	}
+
+	keys := make([]dkimKey, 0)
+	errors := make([]string, 0)
+	recommendations := make([]string, 0)
+	addFinding := func(findings *[]string, id string) {
+		if !utils.Includes(*findings, id) {
+			*findings = append(*findings, id)
+		}
+	}
+	for _, lookup := range lookups {
+		for _, record := range lookup.records {
+			key, keyErrors := parseDKIMRecord(lookup.selector, record)
+			keys = append(keys, key)
+			for _, keyError := range keyErrors {
+				addFinding(&errors, keyError)
+			}
+			if key.KeyType == "rsa" && key.KeyLength >= dkimMinRSAKeyLength && key.KeyLength < dkimRecommendedRSAKeyLength {
+				addFinding(&recommendations, DKIMShortKey)
+			}
+			if key.TestMode {
+				addFinding(&recommendations, DKIMTestMode)
+			}
+		}
+	}
+
+	if len(keys) == 0 {
+		// no selector found - this does not mean, that the domain does not use DKIM
+		return NewAnalysisResult(Unknown, map[string]any{
+			"selectors": selectors,
+		}, nil, nil, time.Since(start))
+	}
+	if utils.Every(keys, func(key dkimKey) bool { return key.Revoked }) {
+		addFinding(&errors, DKIMAllKeysRevoked)
+	}
+
+	actualValue := map[string]any{
+		"dkim":      keys[0].Record,
+		"selectors": selectors,
+		"keys":      keys,
+	}
+	if len(errors) > 0 {
+		return NewAnalysisResult(Failure, actualValue, errors, recommendations, time.Since(start))
+	}
+	return NewAnalysisResult(Success, actualValue, nil, recommendations, time.Since(start))
+}
@@ -0,0 +1,213 @@
+package scanner
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"math/big"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+// returns the base64 encoded SubjectPublicKeyInfo of an rsa key with the given length
+func testDKIMRSAKey(t *testing.T, bits int) string {
+	t.Helper()
+	// the key does not need to be usable - a modulus with the right length is enough
+	n, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), uint(bits-1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.SetBit(n, bits-1, 1)
+	der, err := x509.MarshalPKIXPublicKey(&rsa.PublicKey{N: n, E: 65537})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+// a string of a TXT record is limited to 255 characters - longer keys need to be split
+func testDKIMRecord(record string) string {
+	parts := make([]string, 0)
+	for len(record) > 255 {
+		parts, record = append(parts, record[:255]), record[255:]
+	}
+	return strings.Join(append(parts, record), "|")
+}
+
+func TestParseDKIMRecord(t *testing.T) {
+	ed25519Key, _, _ := ed25519.GenerateKey(rand.Reader)
+	rsa2048 := testDKIMRSAKey(t, 2048)
+
+	table := []struct {
+		name           string
+		record         string
+		expected       dkimKey
+		expectedErrors []string
+	}{
+		{
+			name:     "rsa",
+			record:   "v=DKIM1; k=rsa; p=" + rsa2048,
+			expected: dkimKey{KeyType: "rsa", KeyLength: 2048},
+		},
+		{
+			name:     "without version and key type",
+			record:   "p=" + testDKIMRSAKey(t, 1024),
+			expected: dkimKey{KeyType: "rsa", KeyLength: 1024},
+		},
+		{
+			name:     "ed25519",
+			record:   "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(ed25519Key),
+			expected: dkimKey{KeyType: "ed25519", KeyLength: 256},
+		},
+		{
+			name:     "revoked",
+			record:   "v=DKIM1; k=rsa; p=",
+			expected: dkimKey{KeyType: "rsa", Revoked: true},
+		},
+		{
+			name:     "test mode",
+			record:   "v=DKIM1; t=y:s; p=" + rsa2048,
+			expected: dkimKey{KeyType: "rsa", KeyLength: 2048, TestMode: true},
+		},
+		{
+			name:           "weak key",
+			record:         "v=DKIM1; p=" + testDKIMRSAKey(t, 512),
+			expectedErrors: []string{DKIMWeakKey},
+		},
+		{
+			name:           "unsupported key type",
+			record:         "v=DKIM1; k=dsa; p=" + rsa2048,
+			expectedErrors: []string{DKIMUnsupportedKeyType},
+		},
+		{
+			name:           "invalid base64",
+			record:         "v=DKIM1; p=not-base64",
+			expectedErrors: []string{DKIMSyntaxError},
+		},
+		{
+			name:           "version not first",
+			record:         "k=rsa; v=DKIM1; p=" + rsa2048,
+			expectedErrors: []string{DKIMSyntaxError},
+		},
+		{
+			name:           "duplicate tag",
+			record:         "v=DKIM1; p=" + rsa2048 + "; p=" + rsa2048,
+			expectedErrors: []string{DKIMSyntaxError},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			actual, errors := parseDKIMRecord("selector1", test.record)
+			if len(errors) != len(test.expectedErrors) || !utils.IncludesSubset(errors, test.expectedErrors) {
+				t.Fatalf("Expected errors %v, got %v", test.expectedErrors, errors)
+			}
+			if len(errors) > 0 {
+				return
+			}
+			if actual.KeyType != test.expected.KeyType || actual.KeyLength != test.expected.KeyLength || actual.Revoked != test.expected.Revoked || actual.TestMode != test.expected.TestMode {
+				t.Errorf("Expected %+v, got %+v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestDKIM(t *testing.T) {
+	rsa1024 := testDKIMRSAKey(t, 1024)
+	rsa2048 := testDKIMRSAKey(t, 2048)
+
+	table := []struct {
+		name                    string
+		records                 map[string][]string
+		options                 TargetScanOptions
+		expectedDidPass         DidPass
+		expectedSelectors       []string
+		expectedErrors          []string
+		expectedRecommendations []string
+	}{
+		{
+			name:              "default selector",
+			records:           map[string][]string{"selector1._domainkey.example.test": {testDKIMRecord("v=DKIM1; k=rsa; p=" + rsa2048)}},
+			expectedDidPass:   Success,
+			expectedSelectors: []string{"selector1"},
+		},
+		{
+			name: "rotated key",
+			records: map[string][]string{
+				"selector1._domainkey.example.test": {"v=DKIM1; k=rsa; p="},
+				"selector2._domainkey.example.test": {testDKIMRecord("v=DKIM1; k=rsa; p=" + rsa2048)},
+			},
+			expectedDidPass:   Success,
+			expectedSelectors: []string{"selector1", "selector2"},
+		},
+		{
+			name: "domain selector",
+			records: map[string][]string{
+				"mail2024._domainkey.example.test": {testDKIMRecord("v=DKIM1; t=y; p=" + rsa1024)},
+			},
+			options: TargetScanOptions{
+				DKIMSelectors:       []string{"default"},
+				DomainDKIMSelectors: map[string][]string{"example.test": {"mail2024"}},
+			},
+			expectedDidPass:         Success,
+			expectedSelectors:       []string{"mail2024"},
+			expectedRecommendations: []string{DKIMShortKey, DKIMTestMode},
+		},
+		{
+			name:              "all keys revoked",
+			records:           map[string][]string{"s1._domainkey.example.test": {"v=DKIM1; p="}},
+			expectedDidPass:   Failure,
+			expectedSelectors: []string{"s1"},
+			expectedErrors:    []string{DKIMAllKeysRevoked},
+		},
+		{
+			name:            "wildcard txt record",
+			records:         map[string][]string{"selector1._domainkey.example.test": {"v=spf1 -all"}},
+			expectedDidPass: Unknown,
+		},
+		{
+			name:            "no selector found",
+			records:         map[string][]string{},
+			expectedDidPass: Unknown,
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			d := domainAnalyzer{
+				client:   new(dns.Client),
+				resolver: startTestResolver(t, testTXTRecords(t, test.records), nil),
+			}
+			target, _ := url.Parse("https://www.example.test")
+			actual := d.dkim(context.Background(), Target{URL: target, Options: test.options})
+
+			if test.expectedDidPass == Unknown {
+				if !actual.IsUnknown() {
+					t.Fatalf("Expected unknown, got %+v", actual)
+				}
+				return
+			}
+			if test.expectedDidPass == Success && !actual.IsSuccess() || test.expectedDidPass == Failure && !actual.IsError() {
+				t.Fatalf("Expected %v, got %+v", *test.expectedDidPass, actual)
+			}
+			selectors := utils.Map(actual.ActualValue.(map[string]any)["keys"].([]dkimKey), func(key dkimKey) string { return key.Selector })
+			if len(selectors) != len(test.expectedSelectors) || !utils.IncludesSubset(selectors, test.expectedSelectors) {
+				t.Errorf("Expected the selectors %v to be found, got %v", test.expectedSelectors, selectors)
+			}
+			if len(actual.Errors) != len(test.expectedErrors) || !utils.IncludesSubset(actual.Errors, test.expectedErrors) {
+				t.Errorf("Expected errors %v, got %v", test.expectedErrors, actual.Errors)
+			}
+			if len(actual.Recommendations) != len(test.expectedRecommendations) || !utils.IncludesSubset(actual.Recommendations, test.expectedRecommendations) {
+				t.Errorf("Expected recommendations %v, got %v", test.expectedRecommendations, actual.Recommendations)
+			}
+		})
+	}
+}
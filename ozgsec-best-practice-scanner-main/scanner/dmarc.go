@@ -0,0 +1,283 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+const (
+	DMARCMultipleRecords                = "dmarcMultipleRecords"
+	DMARCSyntaxError                    = "dmarcSyntaxError"
+	DMARCInvalidReportURI               = "dmarcInvalidReportURI"
+	DMARCExternalReportingNotAuthorized = "dmarcExternalReportingNotAuthorized"
+
+	DMARCAvoidSubdomainPolicyNone = "dmarcAvoidSubdomainPolicyNone"
+	DMARCPartialPercentage        = "dmarcPartialPercentage"
+	DMARCMissingAggregateReports  = "dmarcMissingAggregateReports"
+)
+
+var dmarcPolicies = []string{"none", "quarantine", "reject"}
+
+// dmarcPolicy is the parsed DMARC record (RFC7489 Section 6.3) - the defaults are applied
+type dmarcPolicy struct {
+	Policy          string   `json:"p"`
+	SubdomainPolicy string   `json:"sp"`
+	Percentage      int      `json:"pct"`
+	DKIMAlignment   string   `json:"adkim"`
+	SPFAlignment    string   `json:"aspf"`
+	AggregateURIs   []string `json:"rua"`
+	FailureURIs     []string `json:"ruf"`
+	FailureOptions  string   `json:"fo"`
+}
+
+type dmarcExternalReporting struct {
+	URI        string `json:"uri"`
+	Domain     string `json:"domain"`
+	Authorized bool   `json:"authorized"`
+}
+
+// parses a DMARC record and returns the policy together with the syntax errors (as error ids)
+func parseDMARCRecord(record string) (dmarcPolicy, []string) {
+	policy := dmarcPolicy{
+		Percentage:     100,
+		DKIMAlignment:  "r",
+		SPFAlignment:   "r",
+		AggregateURIs:  make([]string, 0),
+		FailureURIs:    make([]string, 0),
+		FailureOptions: "0",
+	}
+	errors := make([]string, 0)
+	addError := func(errorId string) {
+		if !utils.Includes(errors, errorId) {
+			errors = append(errors, errorId)
+		}
+	}
+
+	tags := strings.Split(record, ";")
+	// the version needs to be the first tag
+	if strings.ReplaceAll(strings.TrimSpace(tags[0]), " ", "") != "v=DMARC1" {
+		return policy, []string{DMARCSyntaxError}
+	}
+	for _, tag := range tags[1:] {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(tag, "=")
+		if !ok {
+			addError(DMARCSyntaxError)
+			continue
+		}
+		name, value = strings.ToLower(strings.TrimSpace(name)), strings.TrimSpace(value)
+
+		switch name {
+		case "p":
+			policy.Policy = strings.ToLower(value)
+			if !utils.Includes(dmarcPolicies, policy.Policy) {
+				addError(DMARCSyntaxError)
+			}
+		case "sp":
+			policy.SubdomainPolicy = strings.ToLower(value)
+			if !utils.Includes(dmarcPolicies, policy.SubdomainPolicy) {
+				addError(DMARCSyntaxError)
+			}
+		case "pct":
+			pct, err := strconv.Atoi(value)
+			if err != nil || pct < 0 || pct > 100 {
+				addError(DMARCSyntaxError)
+				continue
+			}
+			policy.Percentage = pct
+		case "adkim", "aspf":
+			value = strings.ToLower(value)
+			if value != "r" && value != "s" {
+				addError(DMARCSyntaxError)
+				continue
+			}
+			if name == "adkim" {
+				policy.DKIMAlignment = value
+			} else {
+				policy.SPFAlignment = value
+			}
+		case "rua", "ruf":
+			uris := utils.Map(strings.Split(value, ","), strings.TrimSpace)
+			for _, uri := range uris {
+				if _, err := dmarcReportDomain(uri); err != nil {
+					addError(DMARCInvalidReportURI)
+				}
+			}
+			if name == "rua" {
+				policy.AggregateURIs = uris
+			} else {
+				policy.FailureURIs = uris
+			}
+		case "fo":
+			policy.FailureOptions = value
+			for _, option := range strings.Split(value, ":") {
+				if !utils.Includes([]string{"0", "1", "d", "s"}, strings.TrimSpace(option)) {
+					addError(DMARCSyntaxError)
+				}
+			}
+		}
+		// other tags (e.g. rf and ri) are not evaluated - unknown tags must be ignored (RFC7489 Section 6.3)
+	}
+
+	if policy.Policy == "" {
+		// a record without a policy is only valid, if it contains a valid rua tag - it is treated as p=none (RFC7489 Section 6.6.3)
+		if len(policy.AggregateURIs) == 0 || utils.Includes(errors, DMARCInvalidReportURI) {
+			addError(DMARCSyntaxError)
+		}
+		policy.Policy = "none"
+	}
+	if policy.SubdomainPolicy == "" {
+		policy.SubdomainPolicy = policy.Policy
+	}
+	return policy, errors
+}
+
+// returns the domain of a mailto report uri (e.g. "mailto:dmarc@example.com!10m")
+func dmarcReportDomain(uri string) (string, error) {
+	address, found := strings.CutPrefix(strings.TrimSpace(uri), "mailto:")
+	if !found {
+		return "", fmt.Errorf("unsupported report uri %s", uri)
+	}
+	// remove the optional size limit
+	address, _, _ = strings.Cut(address, "!")
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return "", err
+	}
+	_, domain, _ := strings.Cut(parsed.Address, "@")
+	return strings.ToLower(domain), nil
+}
+
+// returns the DMARC records published for the domain
+func (d domainAnalyzer) dmarcRecords(ctx context.Context, domain string) ([]string, error) {
+	msg, err := d.exchange(ctx, "_dmarc."+domain, dns.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Rcode != dns.RcodeSuccess && msg.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("dns lookup of _dmarc.%s failed: %s", domain, dns.RcodeToString[msg.Rcode])
+	}
+	records := make([]string, 0)
+	for _, answer := range msg.Answer {
+		if txt, ok := answer.(*dns.TXT); ok && strings.HasPrefix(txtRecordValue(txt), "v=DMARC1") {
+			records = append(records, txtRecordValue(txt))
+		}
+	}
+	return records, nil
+}
+
+// checks, if the receiver of the reports authorized the domain to send reports to it (RFC7489 Section 7.1)
+func (d domainAnalyzer) dmarcExternalReporting(ctx context.Context, domain string, uris []string) ([]dmarcExternalReporting, error) {
+	res := make([]dmarcExternalReporting, 0)
+	for _, uri := range uris {
+		reportDomain, err := dmarcReportDomain(uri)
+		if err != nil || RegistrableDomain(reportDomain) == RegistrableDomain(domain) {
+			continue
+		}
+		// the authorization record is published at <domain>._report._dmarc.<report domain>
+		msg, err := d.exchange(ctx, domain+"._report._dmarc."+reportDomain, dns.TypeTXT)
+		if err != nil {
+			return nil, err
+		}
+		authorized := utils.Some(msg.Answer, func(rr dns.RR) bool {
+			txt, ok := rr.(*dns.TXT)
+			return ok && strings.HasPrefix(txtRecordValue(txt), "v=DMARC1")
+		})
+		res = append(res, dmarcExternalReporting{URI: uri, Domain: reportDomain, Authorized: authorized})
+	}
+	return res, nil
+}
+
+/*
+REQUIRED: The domain (or its organizational domain) publishes exactly one valid DMARC record (RFC7489)
+
+	The record is looked up at _dmarc.<hostname>. If there is none, the organizational domain (determined using the public suffix list) is used.
+	Every tag (p, sp, pct, adkim, aspf, rua, ruf and fo) is parsed. An invalid value is a syntax error.
+	Report uris pointing to another organizational domain need an authorization record of the receiver (<domain>._report._dmarc.<receiver>).
+
+RECOMMENDED: The policy applied to the hostname (sp, if the record of the organizational domain is used) is not "none".
+RECOMMENDED: The subdomain policy is not "none", the policy is applied to every message (pct=100) and aggregate reports are requested (rua).
+
+Source: https://www.rfc-editor.org/rfc/rfc7489
+*/
+func (d domainAnalyzer) dmarc(ctx context.Context, target Target) AnalysisResult {
+	start := time.Now()
+	domain := normalizeHostname(target.URL.Hostname())
+	if target.Options.MailDomain != "" {
+		domain = mailDomain(target)
+	}
+
+	records, err := d.dmarcRecords(ctx, domain)
+	if err != nil {
+		return NewAnalysisResult(Unknown, nil, nil, nil, time.Since(start))
+	}
+	fallback := false
+	if organizational := RegistrableDomain(domain); len(records) == 0 && organizational != domain {
+		fallback = true
+		domain = organizational
+		if records, err = d.dmarcRecords(ctx, domain); err != nil {
+			return NewAnalysisResult(Unknown, nil, nil, nil, time.Since(start))
+		}
+	}
+
+	if len(records) == 0 {
+		return NewAnalysisResult(Failure, nil, nil, nil, time.Since(start))
+	}
+	if len(records) > 1 {
+		return NewAnalysisResult(Failure, map[string]any{
+			"records": records,
+			"domain":  domain,
+		}, []string{DMARCMultipleRecords}, nil, time.Since(start))
+	}
+
+	policy, errors := parseDMARCRecord(records[0])
+	externalReporting, err := d.dmarcExternalReporting(ctx, domain, append(append([]string{}, policy.AggregateURIs...), policy.FailureURIs...))
+	if err != nil {
+		return NewAnalysisResult(Unknown, nil, nil, nil, time.Since(start))
+	}
+	if utils.Some(externalReporting, func(reporting dmarcExternalReporting) bool { return !reporting.Authorized }) {
+		errors = append(errors, DMARCExternalReportingNotAuthorized)
+	}
+
+	// the subdomain policy of the organizational domain applies to the hostname
+	effectivePolicy := policy.Policy
+	if fallback {
+		effectivePolicy = policy.SubdomainPolicy
+	}
+	recommendations := make([]string, 0)
+	if effectivePolicy == "none" {
+		recommendations = append(recommendations, DmarcAvoidPolicyNone)
+	} else if policy.SubdomainPolicy == "none" {
+		recommendations = append(recommendations, DMARCAvoidSubdomainPolicyNone)
+	}
+	if policy.Percentage < 100 {
+		recommendations = append(recommendations, DMARCPartialPercentage)
+	}
+	if len(policy.AggregateURIs) == 0 {
+		recommendations = append(recommendations, DMARCMissingAggregateReports)
+	}
+
+	actualValue := map[string]any{
+		"dmarc":                        records[0],
+		"domain":                       domain,
+		"organizationalDomainFallback": fallback,
+		"policy":                       policy,
+		"effectivePolicy":              effectivePolicy,
+		"externalReporting":            externalReporting,
+	}
+	if len(errors) > 0 {
+		return NewAnalysisResult(Failure, actualValue, errors, recommendations, time.Since(start))
+	}
+	return NewAnalysisResult(Success, actualValue, nil, recommendations, time.Since(start))
+}
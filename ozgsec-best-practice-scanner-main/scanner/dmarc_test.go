@@ -0,0 +1,142 @@
+package scanner
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+func TestParseDMARCRecord(t *testing.T) {
+	table := []struct {
+		record         string
+		expected       dmarcPolicy
+		expectedErrors []string
+	}{
+		{
+			record:         "v=DMARC1; p=reject; sp=quarantine; pct=50; adkim=s; aspf=s; rua=mailto:dmarc@example.com!10m,mailto:other@example.com; fo=1:d",
+			expected:       dmarcPolicy{Policy: "reject", SubdomainPolicy: "quarantine", Percentage: 50, DKIMAlignment: "s", SPFAlignment: "s", FailureOptions: "1:d"},
+			expectedErrors: []string{},
+		},
+		{
+			record:         "v=DMARC1;p=quarantine",
+			expected:       dmarcPolicy{Policy: "quarantine", SubdomainPolicy: "quarantine", Percentage: 100, DKIMAlignment: "r", SPFAlignment: "r", FailureOptions: "0"},
+			expectedErrors: []string{},
+		},
+		{
+			record:         "v=DMARC1; rua=mailto:dmarc@example.com",
+			expected:       dmarcPolicy{Policy: "none", SubdomainPolicy: "none", Percentage: 100, DKIMAlignment: "r", SPFAlignment: "r", FailureOptions: "0"},
+			expectedErrors: []string{},
+		},
+		{
+			record:         "v=DMARC1; p=block; pct=110",
+			expectedErrors: []string{DMARCSyntaxError},
+		},
+		{
+			record:         "v=DMARC1; p=reject; rua=https://example.com/dmarc",
+			expectedErrors: []string{DMARCInvalidReportURI},
+		},
+		{
+			record:         "p=reject; v=DMARC1",
+			expectedErrors: []string{DMARCSyntaxError},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.record, func(t *testing.T) {
+			actual, errors := parseDMARCRecord(test.record)
+			if len(errors) != len(test.expectedErrors) || !utils.IncludesSubset(errors, test.expectedErrors) {
+				t.Fatalf("Expected errors %v, got %v", test.expectedErrors, errors)
+			}
+			if len(errors) > 0 {
+				return
+			}
+			if actual.Policy != test.expected.Policy || actual.SubdomainPolicy != test.expected.SubdomainPolicy || actual.Percentage != test.expected.Percentage ||
+				actual.DKIMAlignment != test.expected.DKIMAlignment || actual.SPFAlignment != test.expected.SPFAlignment || actual.FailureOptions != test.expected.FailureOptions {
+				t.Errorf("Expected %+v, got %+v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestDMARC(t *testing.T) {
+	table := []struct {
+		name                    string
+		records                 map[string][]string
+		expectedDidPass         DidPass
+		expectedDomain          string
+		expectedErrors          []string
+		expectedRecommendations []string
+	}{
+		{
+			name:            "exact hostname",
+			records:         map[string][]string{"_dmarc.www.example.test": {"v=DMARC1; p=reject; rua=mailto:dmarc@example.test"}},
+			expectedDidPass: Success,
+			expectedDomain:  "www.example.test",
+		},
+		{
+			name:                    "organizational domain fallback",
+			records:                 map[string][]string{"_dmarc.example.test": {"v=DMARC1; p=reject; sp=none; rua=mailto:dmarc@example.test"}},
+			expectedDidPass:         Success,
+			expectedDomain:          "example.test",
+			expectedRecommendations: []string{DmarcAvoidPolicyNone},
+		},
+		{
+			name:                    "partial percentage",
+			records:                 map[string][]string{"_dmarc.example.test": {"v=DMARC1; p=quarantine; pct=10"}},
+			expectedDidPass:         Success,
+			expectedDomain:          "example.test",
+			expectedRecommendations: []string{DMARCPartialPercentage, DMARCMissingAggregateReports},
+		},
+		{
+			name:            "multiple records",
+			records:         map[string][]string{"_dmarc.example.test": {"v=DMARC1; p=reject", "v=DMARC1; p=none"}},
+			expectedDidPass: Failure,
+			expectedDomain:  "example.test",
+			expectedErrors:  []string{DMARCMultipleRecords},
+		},
+		{
+			name:            "unauthorized external reporting",
+			records:         map[string][]string{"_dmarc.example.test": {"v=DMARC1; p=reject; rua=mailto:dmarc@reports.example.net"}},
+			expectedDidPass: Failure,
+			expectedDomain:  "example.test",
+			expectedErrors:  []string{DMARCExternalReportingNotAuthorized},
+		},
+		{
+			name: "authorized external reporting",
+			records: map[string][]string{
+				"_dmarc.example.test":                             {"v=DMARC1; p=reject; rua=mailto:dmarc@reports.example.net"},
+				"example.test._report._dmarc.reports.example.net": {"v=DMARC1"},
+			},
+			expectedDidPass: Success,
+			expectedDomain:  "example.test",
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			d := domainAnalyzer{
+				client:   new(dns.Client),
+				resolver: startTestResolver(t, testTXTRecords(t, test.records), nil),
+			}
+			target, _ := url.Parse("https://www.example.test")
+			actual := d.dmarc(context.Background(), Target{URL: target})
+
+			if test.expectedDidPass == Success && !actual.IsSuccess() || test.expectedDidPass == Failure && !actual.IsError() {
+				t.Fatalf("Expected %v, got %+v", *test.expectedDidPass, actual)
+			}
+			if domain := actual.ActualValue.(map[string]any)["domain"]; domain != test.expectedDomain {
+				t.Errorf("Expected the record of %s to be used, got %v", test.expectedDomain, domain)
+			}
+			if len(actual.Errors) != len(test.expectedErrors) || !utils.IncludesSubset(actual.Errors, test.expectedErrors) {
+				t.Errorf("Expected errors %v, got %v", test.expectedErrors, actual.Errors)
+			}
+			if test.expectedDidPass == Success && (len(actual.Recommendations) != len(test.expectedRecommendations) || !utils.IncludesSubset(actual.Recommendations, test.expectedRecommendations)) {
+				t.Errorf("Expected recommendations %v, got %v", test.expectedRecommendations, actual.Recommendations)
+			}
+		})
+	}
+}
@@ -2,13 +2,8 @@ package scanner
 
 import (
 	"context"
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rsa"
-	"crypto/sha256"
-	"crypto/sha512"
 	"crypto/tls"
-	"encoding/hex"
+	"log/slog"
 	"net"
 	"net/smtp"
 	"strings"
@@ -22,6 +17,13 @@ import (
 
 type domainAnalyzer struct {
 	client *dns.Client
+	// the recursive resolver used for the lookups
+	resolver        string
+	dnssecValidator dnssecValidator
+	// the roots used for the PKIX validation of the TLSA usages PKIX-TA and PKIX-EE
+	trustStore trustStore
+	// the signatures of takeover-prone services used by the subdomainTakeover check
+	takeoverSignatures []takeoverSignature
 }
 
 const (
@@ -29,91 +31,37 @@ const (
 	DaneMissingStarttls  = "daneMissingStarttls"
 )
 
-func (d domainAnalyzer) dnssec(ctx context.Context, target Target) (bool, error) {
-	checkTypes := []uint16{dns.TypeA}
-	if target.SupportsIPV6() {
-		// check if the AAAA record is signed as well
-		checkTypes = append(checkTypes, dns.TypeAAAA)
-	}
-
-	for _, rType := range checkTypes {
-		m := new(dns.Msg)
-		m.SetQuestion(dns.Fqdn(target.URL.Hostname()), rType)
-		m.SetEdns0(4096, true)
-		msg, _, err := d.client.ExchangeContext(ctx, m, "8.8.8.8:53")
-
-		if err != nil {
-			return false, err
-		}
-
-		if msg.Rcode != dns.RcodeSuccess || !msg.AuthenticatedData || msg.CheckingDisabled {
-			return false, nil
-		}
-	}
-	return true, nil
-}
-
-var probableDKIMHostnames = []string{
-	"google._domainkey",
-	"default._domainkey",
-	"mail._domainkey",
+func (d domainAnalyzer) exchange(ctx context.Context, name string, qtype uint16) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	// TXT record sets (e.g. spf and several verification tokens) often exceed 512 bytes
+	m.SetEdns0(4096, false)
+	return exchangeWithTCPFallback(ctx, d.client, m, d.resolver)
 }
 
-func certificateMatchesTLSA(tlsConnectionState tls.ConnectionState, tlsa *dns.TLSA) bool {
-	if tlsa == nil {
-		return false
-	}
-	// the usage should be 2 or 3 - DANE-TA, or DANE-EE
-	if tlsa.Usage != 2 && tlsa.Usage != 3 {
-		return false
-	}
-
-	// check what needs to be validated.
-	var toValidate []byte
-	if tlsa.Selector == 0 {
-		// we are looking at the full certificate
-		toValidate = tlsConnectionState.PeerCertificates[0].Raw
-	} else {
-		// we are looking at the public key
-		key := tlsConnectionState.PeerCertificates[0].PublicKey
-		switch key := key.(type) {
-		case *rsa.PublicKey:
-			toValidate = key.N.Bytes()
-		case *ecdsa.PublicKey:
-			toValidate = elliptic.Marshal(key, key.X, key.Y) //nolint:all // todo: use the ecdh package instead of elliptic
-		}
-	}
-
-	// check the matching type
-	switch tlsa.MatchingType {
-	case 1:
-		// do a sha256 hash
-		hash := sha256.Sum256(toValidate)
-		// encode to hex
-		return strings.EqualFold(hex.EncodeToString(hash[:]), tlsa.Certificate)
-	case 2:
-		// do a sha512 hash
-		hash := sha512.Sum512(toValidate)
-		return strings.EqualFold(hex.EncodeToString(hash[:]), tlsa.Certificate)
-	default:
-		// do a full match
-		return strings.EqualFold(hex.EncodeToString(toValidate), tlsa.Certificate)
+// sends the query using the client and repeats it using tcp, if the response is truncated
+func exchangeWithTCPFallback(ctx context.Context, client *dns.Client, m *dns.Msg, resolver string) (*dns.Msg, error) {
+	msg, _, err := client.ExchangeContext(ctx, m, resolver)
+	if err == nil && msg.Truncated {
+		tcpClient := dns.Client{Net: "tcp", Timeout: client.Timeout}
+		msg, _, err = tcpClient.ExchangeContext(ctx, m, resolver)
 	}
+	return msg, err
 }
 
-// returns (starttls, dane)
-func (d domainAnalyzer) verifyStartTLSAndDane(ctx context.Context, mx string, port string) (DidPass, DidPass) {
+// returns (starttls, dane, the match details of every TLSA record)
+func (d domainAnalyzer) verifyStartTLSAndDane(ctx context.Context, mx string, port string) (DidPass, DidPass, []tlsaMatch) {
 	var dialer net.Dialer
 	conn, err := dialer.DialContext(ctx, "tcp", mx+":"+port)
 
 	if err != nil {
-		return Unknown, Unknown
+		return Unknown, Unknown, nil
 	}
 
 	c, err := smtp.NewClient(conn, mx)
 
 	if err != nil {
-		return Unknown, Unknown
+		return Unknown, Unknown, nil
 	}
 	defer c.Close()
 
@@ -125,33 +73,28 @@ func (d domainAnalyzer) verifyStartTLSAndDane(ctx context.Context, mx string, po
 	tlsConnectionState, ok := c.TLSConnectionState()
 	// this port was not able to upgrade the connection to an encrypted one
 	if err != nil || !ok {
-		return Failure, Failure
-	} else {
-		// starttls is already passed - lets check if dane is enabled as well.
-		tlsaQ := new(dns.Msg)
-		tlsaQ.SetQuestion(dns.Fqdn("_"+port+"._tcp."+mx), dns.TypeTLSA)
-		// do the dns query
-		tlsaMsg, _, err := d.client.ExchangeContext(ctx, tlsaQ, "8.8.8.8:53")
-		if err != nil {
-			return Success, Unknown
-		}
-		if tlsaMsg.Rcode != dns.RcodeSuccess {
-			return Success, Unknown
-		}
+		return Failure, Failure, nil
+	}
 
-		if !ok {
-			return Failure, Unknown
-		}
-		// check if the tlsa record is valid
-		for _, answer := range tlsaMsg.Answer {
-			if answer.Header().Rrtype == dns.TypeTLSA {
-				if certificateMatchesTLSA(tlsConnectionState, answer.(*dns.TLSA)) {
-					return Success, Success
-				}
+	// starttls is already passed - lets check if dane is enabled as well.
+	tlsaMsg, err := d.exchange(ctx, "_"+port+"._tcp."+mx, dns.TypeTLSA)
+	if err != nil || tlsaMsg.Rcode != dns.RcodeSuccess {
+		return Success, Unknown, nil
+	}
+
+	// a single matching record is enough (RFC7671 Section 5)
+	dane := Failure
+	matches := make([]tlsaMatch, 0)
+	for _, answer := range tlsaMsg.Answer {
+		if tlsa, ok := answer.(*dns.TLSA); ok {
+			match := matchTLSA(tlsConnectionState.PeerCertificates, mx, d.trustStore.roots, tlsa)
+			if match.Matched {
+				dane = Success
 			}
+			matches = append(matches, match)
 		}
-		return Success, Failure
 	}
+	return Success, dane, matches
 }
 
 // do the starttls and dane check in a single function to avoid another starttls connection
@@ -159,7 +102,7 @@ func (d domainAnalyzer) starttlsAndDane(ctx context.Context, target Target) map[
 	start := time.Now()
 	// get the mx record of the target
 	m := new(dns.Msg)
-	hostname := strings.Replace(dns.Fqdn(target.URL.Hostname()), "www.", "", -1)
+	hostname := dns.Fqdn(mailDomain(target))
 	m.SetQuestion(hostname, dns.TypeMX)
 	msg, _, err := d.client.ExchangeContext(ctx, m, "8.8.8.8:53")
 	if err != nil {
@@ -193,6 +136,7 @@ func (d domainAnalyzer) starttlsAndDane(ctx context.Context, target Target) map[
 	}
 
 	portMap := map[string]map[AnalysisRuleId]DidPass{}
+	tlsaMap := map[string][]tlsaMatch{}
 	var wg sync.WaitGroup
 	wg.Add(len(mxRecords) * 2)
 	mut := sync.Mutex{}
@@ -202,12 +146,13 @@ func (d domainAnalyzer) starttlsAndDane(ctx context.Context, target Target) map[
 		for _, port := range []string{"25", "587"} {
 			go func(mxServer, port string) {
 				defer wg.Done()
-				starttls, dane := d.verifyStartTLSAndDane(ctx, mxServer, port)
+				starttls, dane, matches := d.verifyStartTLSAndDane(ctx, mxServer, port)
 				mut.Lock()
 				portMap[mxServer+":"+port] = map[AnalysisRuleId]DidPass{
 					STARTTLS: starttls,
 					DANE:     dane,
 				}
+				tlsaMap[mxServer+":"+port] = matches
 				mut.Unlock()
 			}(mxServer, port)
 		}
@@ -219,13 +164,16 @@ func (d domainAnalyzer) starttlsAndDane(ctx context.Context, target Target) map[
 	var starttls DidPass = Unknown
 	var dane DidPass = Unknown
 
-	daneActualValue := map[string]DidPass{}
+	daneActualValue := map[string]daneDetails{}
 	starttlsActualValue := map[string]DidPass{}
 
 	for _, mxServer := range mxRecords {
 		for _, port := range []string{"25", "587"} {
 			starttlsActualValue[mxServer+":"+port] = portMap[mxServer+":"+port][STARTTLS]
-			daneActualValue[mxServer+":"+port] = portMap[mxServer+":"+port][DANE]
+			daneActualValue[mxServer+":"+port] = daneDetails{
+				DidPass: portMap[mxServer+":"+port][DANE],
+				TLSA:    tlsaMap[mxServer+":"+port],
+			}
 			if portMap[mxServer+":"+port][STARTTLS] == Failure {
 				starttls = Failure
 			}
@@ -247,185 +195,50 @@ func (d domainAnalyzer) starttlsAndDane(ctx context.Context, target Target) map[
 	}
 }
 
-func (d domainAnalyzer) dmarc(ctx context.Context, target Target) AnalysisResult {
-	start := time.Now()
-	// fetch the txt dns records.
-	m := new(dns.Msg)
-	m.SetQuestion(dns.Fqdn("_dmarc."+target.URL.Hostname()), dns.TypeTXT)
-	msg, _, err := d.client.ExchangeContext(ctx, m, "8.8.8.8:53")
-
-	if err != nil {
-		return NewAnalysisResult(Unknown, nil, nil, nil, time.Since(start))
-	}
-
-	// check if the dmarc record exists
-	if msg.Rcode != dns.RcodeSuccess {
-		return NewAnalysisResult(Failure, nil, nil, nil, time.Since(start))
-	}
-
-	// check if the dmarc record is valid
-	for _, answer := range msg.Answer {
-		if answer.Header().Rrtype == dns.TypeTXT {
-			if strings.HasPrefix(answer.(*dns.TXT).Txt[0], "v=DMARC1") {
-				// check if the policy contains none.
-				if strings.Contains(answer.(*dns.TXT).Txt[0], "p=none") {
-					return NewAnalysisResult(Success, map[string]string{
-						"dmarc": answer.(*dns.TXT).Txt[0],
-					}, nil, []string{DmarcAvoidPolicyNone}, time.Since(start))
-				}
-				return NewAnalysisResult(Success, map[string]string{
-					"dmarc": answer.(*dns.TXT).Txt[0],
-				}, nil, nil, time.Since(start))
-			}
-		}
-	}
-	return NewAnalysisResult(Failure, nil, nil, nil, time.Since(start))
-}
-
-func (d domainAnalyzer) dkim(ctx context.Context, target Target) AnalysisResult {
-	start := time.Now()
-dkimHostnameLoop:
-	for _, probableDKIMHostname := range probableDKIMHostnames {
-		// fetch the txt dns records.
-		m := new(dns.Msg)
-		hostname := strings.Replace(target.URL.Hostname(), "www.", "", -1)
-		m.SetQuestion(dns.Fqdn(probableDKIMHostname+"."+hostname), dns.TypeTXT)
-		msg, _, err := d.client.ExchangeContext(ctx, m, "8.8.8.8:53")
-		if err != nil {
-			return NewAnalysisResult(Unknown, nil, nil, nil, time.Since(start))
-		}
-
-		// check if the dkim record exists
-		if msg.Rcode != dns.RcodeSuccess {
-			continue dkimHostnameLoop
-		}
-
-		// check if the dkim record is valid
-		for _, answer := range msg.Answer {
-			if answer.Header().Rrtype == dns.TypeTXT {
-				if strings.HasPrefix(answer.(*dns.TXT).Txt[0], "v=DKIM1") {
-					return NewAnalysisResult(Success, map[string]string{
-						"dkim": answer.(*dns.TXT).Txt[0],
-					}, nil, nil, time.Since(start))
-				}
-			}
+// returns the hostname and its parent domains up to the registrable domain (e.g. a.b.example.co.uk, b.example.co.uk, example.co.uk)
+func getAllSubdomainsFromTarget(target Target) []string {
+	hostname := normalizeHostname(target.URL.Hostname())
+	domain := RegistrableDomain(hostname)
+	parts := strings.Split(hostname, ".")
+
+	subs := make([]string, 0, len(parts))
+	for i := range parts {
+		sub := utils.Join(parts[i:], ".")
+		subs = append(subs, sub)
+		if sub == domain {
+			break
 		}
-		return NewAnalysisResult(Failure, nil, nil, nil, time.Since(start))
 	}
-	return NewAnalysisResult(Unknown, nil, nil, nil, time.Since(start))
+	return subs
 }
 
-func (d domainAnalyzer) spf(ctx context.Context, target Target) AnalysisResult {
-	start := time.Now()
-	// fetch the txt dns records.
-	m := new(dns.Msg)
-	hostname := strings.Replace(target.URL.Hostname(), "www.", "", -1)
-	m.SetQuestion(dns.Fqdn(hostname), dns.TypeTXT)
-	msg, _, err := d.client.ExchangeContext(ctx, m, "8.8.8.8:53")
+func NewDomainAnalyzer() analyzer[any] {
+	c := new(dns.Client)
+	trustStore, err := newTrustStore(trustStoreCABundle)
 	if err != nil {
-		return NewAnalysisResult(Unknown, nil, nil, nil, time.Since(start))
-	}
-
-	// check if the spf record exists
-	if msg.Rcode != dns.RcodeSuccess {
-		return NewAnalysisResult(Failure, nil, nil, nil, time.Since(start))
+		slog.Error("could not load custom ca bundle - using the system roots only", "path", trustStoreCABundle, "err", err)
 	}
-
-	// check if the spf record is valid
-	for _, answer := range msg.Answer {
-		if answer.Header().Rrtype == dns.TypeTXT {
-			if strings.HasPrefix(answer.(*dns.TXT).Txt[0], "v=spf1") {
-				return NewAnalysisResult(Success, map[string]string{
-					"spf": answer.(*dns.TXT).Txt[0],
-				}, nil, nil, time.Since(start))
-			}
-		}
-	}
-	return NewAnalysisResult(Failure, nil, nil, nil, time.Since(start))
-}
-
-/**
- *
- * @requirements
- * REQUIRED: The "CAA" records are present.
- * REQUIRED: The "CAA" flag is set to 0 (not critical).
- * REQUIRED: The "CAA" "issue" (value not ";") and/ or "issuewild" properties are present.
- * REQUIRED: If the "CAA" "iodef" property is present (mailto: or https://), it is valid.
- *
- * Base Format: CAA <flags> <tag> <value>
- * Example: CAA 0 issue "letsencrypt.org"
- * Example: CAA 0 issue "ca1.example.net; account=230123"
- * Example: CAA 0 issuewild "letsencrypt.org"
- * Example: CAA 0 iodef "mailto:opensource@neuland-homeland.de"
- * Example: CAA 0 iodef "https://iodef.example.com/"
- * Bad Example: CAA 0 issue ";"
- * Bad Example: CAA 1 issue "letsencrypt.org"
- * Malformed Example: CAA 0 issue "%%%%%"
- *
- */
-func (d domainAnalyzer) validateCaa(ctx context.Context, subdomain string) (bool, error) {
-	m := new(dns.Msg)
-	m.SetQuestion(dns.Fqdn(subdomain), dns.TypeCAA)
-	msg, _, err := d.client.ExchangeContext(ctx, m, "8.8.8.8:53")
+	takeoverSignatures, err := loadTakeoverSignatures(takeoverSignaturesPath)
 	if err != nil {
-		return false, err
+		slog.Error("could not load takeover signatures - using the default signatures", "path", takeoverSignaturesPath, "err", err)
 	}
-	if msg.Rcode != dns.RcodeSuccess {
-		return false, nil
-	}
-
-	caaExists := false
-	iodefValid := true
-	for _, answer := range msg.Answer {
-		if answer.Header().Rrtype == dns.TypeCAA {
-			caaExists = true
-			if answer.(*dns.CAA).Tag == "iodef" && iodefValid {
-				iodefValid = validateIoDefProperty(answer.(*dns.CAA).Value)
-			}
-		}
-	}
-
-	return caaExists && iodefValid, nil
-}
-
-func validateIoDefProperty(value string) bool {
-	return strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "mailto:") || strings.HasPrefix(value, "https://")
-}
-
-func (d domainAnalyzer) caa(ctx context.Context, target Target) (bool, error) {
-	subs := getAllSubdomainsFromTarget(target)
-	for _, sub := range subs {
-		exist, err := d.validateCaa(ctx, sub)
-		if err != nil {
-			return false, err
-		}
-		if exist {
-			return true, nil
-		}
-	}
-	return false, nil
-}
-
-func getAllSubdomainsFromTarget(target Target) []string {
-	parts := strings.Split(target.URL.Hostname(), ".")
-
-	subs := make([]string, len(parts)-1)
-	for i := 0; i < len(parts)-1; i++ {
-		subs[i] = utils.Join(parts[i:], ".")
-	}
-	return subs
-}
-
-func NewDomainAnalyzer() analyzer[any] {
-	c := new(dns.Client)
 	return &domainAnalyzer{
-		client: c,
+		client:             c,
+		resolver:           "8.8.8.8:53",
+		dnssecValidator:    newDNSSECValidator(c, "8.8.8.8:53"),
+		trustStore:         trustStore,
+		takeoverSignatures: takeoverSignatures,
 	}
 }
 
 func (d *domainAnalyzer) Analyze(ctx context.Context, target Target, _ any) (map[AnalysisRuleId]AnalysisResult, error) {
 	// check if we can use a cached value
-	cachedValue, err := target.Options.CachingLayer.Get(ctx, target.URL.Hostname())
+	// the mail domain changes the results of the mail checks - therefore it is part of the key
+	cacheKey := target.URL.Hostname()
+	if target.Options.MailDomain != "" {
+		cacheKey += "/" + mailDomain(target)
+	}
+	cachedValue, err := target.Options.CachingLayer.Get(ctx, cacheKey)
 	if err == nil {
 		cache, err := getFromCache(cachedValue, d.GetAnalysisRuleIds())
 		if err == nil {
@@ -453,14 +266,31 @@ func (d *domainAnalyzer) Analyze(ctx context.Context, target Target, _ any) (map
 			return d.dmarc(ctx, target)
 		}),
 		maybeDoCheckFactory(DNSSec, target.Options, func() AnalysisResult {
-			start := time.Now()
-			didPass := interpret(d.dnssec(ctx, target))
-			return NewAnalysisResult(didPass, nil, nil, nil, time.Since(start))
+			return d.dnssec(ctx, target)
 		}),
 		maybeDoCheckFactory(CAA, target.Options, func() AnalysisResult {
-			start := time.Now()
-			didPass := interpret(d.caa(ctx, target))
-			return NewAnalysisResult(didPass, nil, nil, nil, time.Since(start))
+			return d.caa(ctx, target)
+		}),
+		maybeDoCheckFactory(MTASTS, target.Options, func() AnalysisResult {
+			return d.mtaSTS(ctx, target)
+		}),
+		maybeDoCheckFactory(TLSRPT, target.Options, func() AnalysisResult {
+			return d.tlsRPT(ctx, target)
+		}),
+		maybeDoCheckFactory(MXHygiene, target.Options, func() AnalysisResult {
+			return d.mxHygiene(ctx, target)
+		}),
+		maybeDoCheckFactory(Nameservers, target.Options, func() AnalysisResult {
+			return d.nameservers(ctx, target)
+		}),
+		maybeDoCheckFactory(SubdomainTakeover, target.Options, func() AnalysisResult {
+			return d.subdomainTakeover(ctx, target)
+		}),
+		maybeDoCheckFactory(HTTPSRecord, target.Options, func() AnalysisResult {
+			return d.httpsRecord(ctx, target)
+		}),
+		maybeDoCheckFactory(NameserverProbes, target.Options, func() AnalysisResult {
+			return d.nameserverProbes(ctx, target)
 		}),
 	)
 
@@ -483,13 +313,22 @@ func (d *domainAnalyzer) Analyze(ctx context.Context, target Target, _ any) (map
 		DANE:     startTlsDaneRes[DANE],
 		DNSSec:   res[3],
 		CAA:      res[4],
+		MTASTS:   res[5],
+		TLSRPT:   res[6],
+
+		MXHygiene:        res[7],
+		Nameservers:      res[8],
+		NameserverProbes: res[11],
+
+		SubdomainTakeover: res[9],
+		HTTPSRecord:       res[10],
 	}
 
 	// cache the result
-	target.Options.CachingLayer.Set(ctx, target.URL.Hostname(), m, 1*time.Hour) // nolint // just swallow the error
+	target.Options.CachingLayer.Set(ctx, cacheKey, m, 1*time.Hour) // nolint // just swallow the error
 	return m, nil
 }
 
 func (d *domainAnalyzer) GetAnalysisRuleIds() []AnalysisRuleId {
-	return []AnalysisRuleId{DNSSec, CAA, SPF, DKIM, DMARC, STARTTLS, DANE}
+	return []AnalysisRuleId{DNSSec, CAA, SPF, DKIM, DMARC, STARTTLS, DANE, MTASTS, TLSRPT, MXHygiene, Nameservers, NameserverProbes, SubdomainTakeover, HTTPSRecord}
 }
@@ -8,6 +8,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/miekg/dns"
+
 	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/cache"
 )
 
@@ -81,3 +83,50 @@ func TestIodefPropertyValidation(t *testing.T) {
 		})
 	}
 }
+
+// the udp response is truncated - the query is repeated using tcp
+func TestExchangeTruncated(t *testing.T) {
+	records := make([]dns.RR, 0)
+	for i := 0; i < 10; i++ {
+		records = append(records, mustNewRR(t, fmt.Sprintf("example.test. 3600 IN TXT \"verification-token-%d-%064d\"", i, i)))
+	}
+	handler := func(truncate bool) dns.HandlerFunc {
+		return func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+			if opt := r.IsEdns0(); opt == nil || opt.UDPSize() < 4096 {
+				m.Rcode = dns.RcodeFormatError
+			}
+			if truncate {
+				m.Truncated = true
+			} else {
+				m.Answer = records
+			}
+			w.WriteMsg(m) // nolint // the test fails, if the response is missing
+		}
+	}
+
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", packetConn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	udpServer := &dns.Server{PacketConn: packetConn, Handler: handler(true)}
+	tcpServer := &dns.Server{Listener: listener, Handler: handler(false)}
+	go udpServer.ActivateAndServe() // nolint // the server is shut down after the test
+	go tcpServer.ActivateAndServe() // nolint // the server is shut down after the test
+	defer udpServer.Shutdown()      // nolint // the test is over anyway
+	defer tcpServer.Shutdown()      // nolint // the test is over anyway
+
+	d := domainAnalyzer{client: new(dns.Client), resolver: packetConn.LocalAddr().String()}
+	msg, err := d.exchange(context.Background(), "example.test", dns.TypeTXT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Rcode != dns.RcodeSuccess || msg.Truncated || len(msg.Answer) != len(records) {
+		t.Errorf("Expected the %d records of the tcp response, got %v", len(records), msg)
+	}
+}
@@ -0,0 +1,458 @@
+package scanner
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+// the chain of trust is validated by the scanner itself - starting at the root trust anchor.
+// the records are fetched from a recursive resolver with the checking disabled (CD) bit set.
+// this way the records are returned, even if the resolver considers them bogus, and the reason can be reported.
+
+const (
+	DNSSECUnsigned            = "dnssecUnsigned"
+	DNSSECMissingDS           = "dnssecMissingDS"
+	DNSSECNoMatchingKey       = "dnssecNoMatchingKey"
+	DNSSECMissingSignature    = "dnssecMissingSignature"
+	DNSSECInvalidSignature    = "dnssecInvalidSignature"
+	DNSSECSignatureExpired    = "dnssecSignatureExpired"
+	DNSSECDeprecatedAlgorithm = "dnssecDeprecatedAlgorithm"
+	DNSSECZoneWalking         = "dnssecZoneWalking"
+)
+
+const (
+	dnssecRecordSecure   = "secure"
+	dnssecRecordAbsent   = "absent"
+	dnssecRecordInsecure = "insecure"
+	// the record is signed by a zone outside of the validated chain (e.g. the target of a CNAME)
+	dnssecRecordUnverified = "unverified"
+)
+
+// the DS records of the root key signing keys (KSK-2017 and KSK-2024)
+// REF: https://data.iana.org/root-anchors/root-anchors.xml
+var rootTrustAnchors = utils.Map([]string{
+	". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+	". IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}, func(anchor string) *dns.DS {
+	rr, err := dns.NewRR(anchor)
+	if err != nil {
+		panic(err)
+	}
+	return rr.(*dns.DS)
+})
+
+// algorithms, which must not be used for signing anymore (RFC8624 Section 3.1)
+var deprecatedDNSSECAlgorithms = []uint8{
+	dns.RSAMD5,
+	dns.DSA,
+	dns.RSASHA1,
+	dns.DSANSEC3SHA1,
+	dns.RSASHA1NSEC3SHA1,
+	dns.ECCGOST,
+}
+
+// dnssecZone is a zone of the validated chain of trust
+type dnssecZone struct {
+	Zone       string   `json:"zone"`
+	KeyTags    []uint16 `json:"keyTags"`
+	Algorithms []string `json:"algorithms"`
+}
+
+// dnssecChainBreak describes, where and why the chain of trust breaks
+type dnssecChainBreak struct {
+	Zone   string `json:"zone"`
+	Reason string `json:"reason"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type dnssecValidation struct {
+	chain      []dnssecZone
+	chainBreak *dnssecChainBreak
+	// the validation status by record type
+	records              map[string]string
+	errors               []string
+	deprecatedAlgorithms []string
+	denialOfExistence    map[string]any
+}
+
+func (v *dnssecValidation) addError(errorId string) {
+	if !utils.Includes(v.errors, errorId) {
+		v.errors = append(v.errors, errorId)
+	}
+}
+
+type dnssecValidator struct {
+	client       *dns.Client
+	resolver     string
+	trustAnchors []*dns.DS
+}
+
+func newDNSSECValidator(client *dns.Client, resolver string) dnssecValidator {
+	return dnssecValidator{
+		client:       client,
+		resolver:     resolver,
+		trustAnchors: rootTrustAnchors,
+	}
+}
+
+func (v dnssecValidator) query(ctx context.Context, name string, qtype uint16) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	m.SetEdns0(4096, true)
+	// the validation is done by the scanner
+	m.CheckingDisabled = true
+	// DNSKEY responses might exceed the udp payload size
+	return exchangeWithTCPFallback(ctx, v.client, m, v.resolver)
+}
+
+// returns the records of the type owned by the name and the signatures covering them
+func rrsetWithSignatures(rrs []dns.RR, name string, qtype uint16) ([]dns.RR, []*dns.RRSIG) {
+	rrset := make([]dns.RR, 0)
+	signatures := make([]*dns.RRSIG, 0)
+	for _, rr := range rrs {
+		if !strings.EqualFold(rr.Header().Name, name) {
+			continue
+		}
+		if rr.Header().Rrtype == qtype {
+			rrset = append(rrset, rr)
+		} else if signature, ok := rr.(*dns.RRSIG); ok && signature.TypeCovered == qtype {
+			signatures = append(signatures, signature)
+		}
+	}
+	return rrset, signatures
+}
+
+func dnskeys(rrset []dns.RR) []*dns.DNSKEY {
+	keys := make([]*dns.DNSKEY, 0, len(rrset))
+	for _, rr := range rrset {
+		if key, ok := rr.(*dns.DNSKEY); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// verifies the rrset using one of the keys and returns the error id, if no valid signature was found
+func verifyRRSet(rrset []dns.RR, signatures []*dns.RRSIG, keys []*dns.DNSKEY, now time.Time) (string, error) {
+	if len(signatures) == 0 {
+		return DNSSECMissingSignature, errors.New("the records are not signed")
+	}
+
+	errorId, err := DNSSECNoMatchingKey, fmt.Errorf("no signature was made by a key of the zone")
+	for _, signature := range signatures {
+		for _, key := range keys {
+			if key.KeyTag() != signature.KeyTag || key.Algorithm != signature.Algorithm || !strings.EqualFold(key.Hdr.Name, signature.SignerName) {
+				continue
+			}
+			if verifyErr := signature.Verify(key, rrset); verifyErr != nil {
+				if errorId != DNSSECSignatureExpired {
+					errorId, err = DNSSECInvalidSignature, fmt.Errorf("signature of key %d: %w", key.KeyTag(), verifyErr)
+				}
+				continue
+			}
+			if !signature.ValidityPeriod(now) {
+				errorId, err = DNSSECSignatureExpired, fmt.Errorf("signature of key %d is only valid from %s to %s", key.KeyTag(), dns.TimeToString(signature.Inception), dns.TimeToString(signature.Expiration))
+				continue
+			}
+			return "", nil
+		}
+	}
+	return errorId, err
+}
+
+// returns the keys, which match one of the DS records
+func keysMatchingDS(keys []*dns.DNSKEY, dsRecords []*dns.DS) []*dns.DNSKEY {
+	return utils.Filter(keys, func(key *dns.DNSKEY) bool {
+		return utils.Some(dsRecords, func(ds *dns.DS) bool {
+			if key.KeyTag() != ds.KeyTag || key.Algorithm != ds.Algorithm {
+				return false
+			}
+			digest := key.ToDS(ds.DigestType)
+			return digest != nil && strings.EqualFold(digest.Digest, ds.Digest)
+		})
+	})
+}
+
+// validates the DNSKEY rrset of the zone using the DS records (delegated by the parent zone or the trust anchors)
+func (v dnssecValidator) validateZone(ctx context.Context, zone string, dsRecords []*dns.DS, validation *dnssecValidation) ([]*dns.DNSKEY, error) {
+	msg, err := v.query(ctx, zone, dns.TypeDNSKEY)
+	if err != nil {
+		return nil, err
+	}
+	rrset, signatures := rrsetWithSignatures(msg.Answer, zone, dns.TypeDNSKEY)
+	keys := dnskeys(rrset)
+	if len(keys) == 0 {
+		validation.chainBreak = &dnssecChainBreak{Zone: zone, Reason: DNSSECUnsigned, Detail: "the DS record exists, but the zone does not publish a DNSKEY"}
+		return nil, nil
+	}
+
+	keySigningKeys := keysMatchingDS(keys, dsRecords)
+	if len(keySigningKeys) == 0 {
+		validation.chainBreak = &dnssecChainBreak{Zone: zone, Reason: DNSSECNoMatchingKey, Detail: "no DNSKEY matches the DS records of the parent zone"}
+		return nil, nil
+	}
+	if errorId, err := verifyRRSet(rrset, signatures, keySigningKeys, time.Now()); errorId != "" {
+		validation.chainBreak = &dnssecChainBreak{Zone: zone, Reason: errorId, Detail: "DNSKEY: " + err.Error()}
+		return nil, nil
+	}
+
+	algorithms := make([]string, 0)
+	for _, key := range keys {
+		algorithm := dns.AlgorithmToString[key.Algorithm]
+		if !utils.Includes(algorithms, algorithm) {
+			algorithms = append(algorithms, algorithm)
+		}
+		if utils.Includes(deprecatedDNSSECAlgorithms, key.Algorithm) && !utils.Includes(validation.deprecatedAlgorithms, algorithm+" ("+zone+")") {
+			validation.deprecatedAlgorithms = append(validation.deprecatedAlgorithms, algorithm+" ("+zone+")")
+		}
+	}
+	validation.chain = append(validation.chain, dnssecZone{
+		Zone:       zone,
+		KeyTags:    utils.Map(keys, func(key *dns.DNSKEY) uint16 { return key.KeyTag() }),
+		Algorithms: algorithms,
+	})
+	return keys, nil
+}
+
+// follows the chain of trust from the root down to the zone of the hostname.
+// returns the keys of every validated zone.
+func (v dnssecValidator) validateChain(ctx context.Context, hostname string, validation *dnssecValidation) (map[string][]*dns.DNSKEY, string, error) {
+	zoneKeys := make(map[string][]*dns.DNSKEY)
+	keys, err := v.validateZone(ctx, ".", v.trustAnchors, validation)
+	if err != nil || keys == nil {
+		return zoneKeys, ".", err
+	}
+	zone := "."
+	zoneKeys[zone] = keys
+
+	labels := dns.SplitDomainName(hostname)
+	for i := len(labels) - 1; i >= 0; i-- {
+		name := dns.Fqdn(strings.Join(labels[i:], "."))
+		msg, err := v.query(ctx, name, dns.TypeDS)
+		if err != nil {
+			return zoneKeys, zone, err
+		}
+
+		rrset, signatures := rrsetWithSignatures(msg.Answer, name, dns.TypeDS)
+		if len(rrset) == 0 {
+			// either the name is no zone cut - or the delegation is insecure
+			soa, err := v.query(ctx, name, dns.TypeSOA)
+			if err != nil {
+				return zoneKeys, zone, err
+			}
+			if soaRecords, _ := rrsetWithSignatures(soa.Answer, name, dns.TypeSOA); len(soaRecords) > 0 {
+				validation.chainBreak = &dnssecChainBreak{Zone: name, Reason: DNSSECMissingDS, Detail: "the parent zone " + zone + " does not delegate securely to the zone"}
+				return zoneKeys, zone, nil
+			}
+			continue
+		}
+
+		// the DS records are signed by the parent zone
+		if errorId, err := verifyRRSet(rrset, signatures, keys, time.Now()); errorId != "" {
+			validation.chainBreak = &dnssecChainBreak{Zone: name, Reason: errorId, Detail: "DS: " + err.Error()}
+			return zoneKeys, zone, nil
+		}
+		dsRecords := utils.Map(rrset, func(rr dns.RR) *dns.DS { return rr.(*dns.DS) })
+		for _, ds := range dsRecords {
+			// the SHA-1 digest must not be used anymore (RFC8624 Section 3.3)
+			if ds.DigestType == dns.SHA1 && !utils.Includes(validation.deprecatedAlgorithms, "DS SHA-1 ("+name+")") {
+				validation.deprecatedAlgorithms = append(validation.deprecatedAlgorithms, "DS SHA-1 ("+name+")")
+			}
+		}
+
+		keys, err = v.validateZone(ctx, name, dsRecords, validation)
+		if err != nil || keys == nil {
+			return zoneKeys, zone, err
+		}
+		zone = name
+		zoneKeys[zone] = keys
+	}
+	return zoneKeys, zone, nil
+}
+
+// checks, which kind of authenticated denial of existence the zone uses.
+// NSEC allows to enumerate every name of the zone (zone walking).
+func (v dnssecValidator) denialOfExistence(ctx context.Context, zone string) (map[string]any, error) {
+	msg, err := v.query(ctx, zone, dns.TypeNSEC3PARAM)
+	if err != nil {
+		return nil, err
+	}
+	if rrset, _ := rrsetWithSignatures(msg.Answer, zone, dns.TypeNSEC3PARAM); len(rrset) > 0 {
+		param := rrset[0].(*dns.NSEC3PARAM)
+		return map[string]any{
+			"type":       "nsec3",
+			"iterations": param.Iterations,
+			"saltLength": param.SaltLength,
+		}, nil
+	}
+
+	// the NSEC record of a random name reveals the next existing name of the zone
+	random := make([]byte, 8)
+	rand.Read(random) // nolint // the name just needs to be unlikely to exist
+	msg, err = v.query(ctx, hex.EncodeToString(random)+"."+zone, dns.TypeA)
+	if err != nil {
+		return nil, err
+	}
+	for _, rr := range msg.Ns {
+		switch rr.(type) {
+		case *dns.NSEC:
+			return map[string]any{"type": "nsec"}, nil
+		case *dns.NSEC3:
+			return map[string]any{"type": "nsec3"}, nil
+		}
+	}
+	return map[string]any{"type": "unknown"}, nil
+}
+
+// validates the records of the type and returns their status
+func (v dnssecValidator) validateRecords(ctx context.Context, name string, qtype uint16, zoneKeys map[string][]*dns.DNSKEY, validation *dnssecValidation) (string, error) {
+	msg, err := v.query(ctx, name, qtype)
+	if err != nil {
+		return "", err
+	}
+
+	sections := msg.Answer
+	if len(msg.Answer) == 0 {
+		// the authority section contains the signed NSEC or NSEC3 records proving the absence
+		sections = msg.Ns
+	}
+
+	status := dnssecRecordSecure
+	if len(msg.Answer) == 0 {
+		status = dnssecRecordAbsent
+		if !utils.Some(msg.Ns, func(rr dns.RR) bool {
+			return rr.Header().Rrtype == dns.TypeNSEC || rr.Header().Rrtype == dns.TypeNSEC3
+		}) {
+			validation.addError(DNSSECMissingSignature)
+			return DNSSECMissingSignature, nil
+		}
+	}
+	checked := make(map[string]bool)
+	for _, rr := range sections {
+		header := rr.Header()
+		if header.Rrtype == dns.TypeRRSIG || header.Rrtype == dns.TypeSOA && len(msg.Answer) == 0 {
+			continue
+		}
+		key := strings.ToLower(header.Name) + "/" + dns.TypeToString[header.Rrtype]
+		if checked[key] {
+			continue
+		}
+		checked[key] = true
+
+		rrset, signatures := rrsetWithSignatures(sections, header.Name, header.Rrtype)
+		if len(signatures) == 0 {
+			validation.addError(DNSSECMissingSignature)
+			return DNSSECMissingSignature, nil
+		}
+		keys, ok := zoneKeys[strings.ToLower(signatures[0].SignerName)]
+		if !ok {
+			status = dnssecRecordUnverified
+			continue
+		}
+		if errorId, _ := verifyRRSet(rrset, signatures, keys, time.Now()); errorId != "" {
+			validation.addError(errorId)
+			return errorId, nil
+		}
+	}
+	return status, nil
+}
+
+// validates the chain of trust and the A, AAAA, MX, TLSA and CAA records of the hostname
+func (v dnssecValidator) validate(ctx context.Context, hostname string, port string) (dnssecValidation, error) {
+	hostname = strings.ToLower(dns.Fqdn(hostname))
+	validation := dnssecValidation{
+		chain:                make([]dnssecZone, 0),
+		records:              make(map[string]string),
+		errors:               make([]string, 0),
+		deprecatedAlgorithms: make([]string, 0),
+	}
+
+	queries := []struct {
+		name  string
+		qtype uint16
+	}{
+		{name: hostname, qtype: dns.TypeA},
+		{name: hostname, qtype: dns.TypeAAAA},
+		{name: hostname, qtype: dns.TypeMX},
+		{name: "_" + port + "._tcp." + hostname, qtype: dns.TypeTLSA},
+		{name: hostname, qtype: dns.TypeCAA},
+	}
+
+	zoneKeys, zone, err := v.validateChain(ctx, hostname, &validation)
+	if err != nil {
+		return validation, err
+	}
+	if validation.chainBreak != nil {
+		validation.addError(validation.chainBreak.Reason)
+		for _, query := range queries {
+			validation.records[dns.TypeToString[query.qtype]] = dnssecRecordInsecure
+		}
+		return validation, nil
+	}
+
+	if validation.denialOfExistence, err = v.denialOfExistence(ctx, zone); err != nil {
+		return validation, err
+	}
+	for _, query := range queries {
+		status, err := v.validateRecords(ctx, query.name, query.qtype, zoneKeys, &validation)
+		if err != nil {
+			return validation, err
+		}
+		validation.records[dns.TypeToString[query.qtype]] = status
+	}
+	return validation, nil
+}
+
+/*
+REQUIRED: The chain of trust is valid from the root trust anchor down to the records of the domain
+
+	The DNSKEY, DS and RRSIG records of every zone from the root down to the zone of the hostname are validated.
+	The signatures of the A, AAAA, MX, TLSA and CAA records (or of the records proving their absence) are validated using the keys of the zone.
+	The zone, where the chain breaks, and the reason (e.g. a missing DS record or an expired signature) are reported.
+
+RECOMMENDED: Deprecated algorithms (e.g. RSASHA1 or RSASHA1-NSEC3-SHA1) and SHA-1 DS digests are not used (RFC8624)
+RECOMMENDED: NSEC3 is used instead of NSEC - NSEC allows to enumerate the names of the zone (zone walking)
+
+Source: https://www.rfc-editor.org/rfc/rfc9364 and https://www.rfc-editor.org/rfc/rfc4035#section-5
+*/
+func (d domainAnalyzer) dnssec(ctx context.Context, target Target) AnalysisResult {
+	start := time.Now()
+	port := target.URL.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	validation, err := d.dnssecValidator.validate(ctx, target.URL.Hostname(), port)
+	if err != nil {
+		return NewAnalysisResult(Unknown, map[string]any{"error": err.Error()}, nil, nil, time.Since(start))
+	}
+
+	actualValue := map[string]any{
+		"chain":                validation.chain,
+		"chainBreak":           validation.chainBreak,
+		"records":              validation.records,
+		"deprecatedAlgorithms": validation.deprecatedAlgorithms,
+		"denialOfExistence":    validation.denialOfExistence,
+	}
+	recommendations := make([]string, 0)
+	if len(validation.deprecatedAlgorithms) > 0 {
+		recommendations = append(recommendations, DNSSECDeprecatedAlgorithm)
+	}
+	if validation.denialOfExistence != nil && validation.denialOfExistence["type"] == "nsec" {
+		recommendations = append(recommendations, DNSSECZoneWalking)
+	}
+
+	if len(validation.errors) > 0 {
+		return NewAnalysisResult(Failure, actualValue, validation.errors, recommendations, time.Since(start))
+	}
+	return NewAnalysisResult(Success, actualValue, nil, recommendations, time.Since(start))
+}
@@ -0,0 +1,152 @@
+package scanner
+
+import (
+	"context"
+	"crypto"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+type testDNSSECZone struct {
+	key        *dns.DNSKEY
+	privateKey crypto.Signer
+}
+
+func newTestDNSSECZone(t *testing.T, name string) testDNSSECZone {
+	t.Helper()
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: name, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	privateKey, err := key.Generate(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testDNSSECZone{key: key, privateKey: privateKey.(crypto.Signer)}
+}
+
+// returns the rrset together with its signature
+func (z testDNSSECZone) sign(t *testing.T, expiration time.Time, rrset ...dns.RR) []dns.RR {
+	t.Helper()
+	signature := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Name: rrset[0].Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: 3600},
+		KeyTag:     z.key.KeyTag(),
+		SignerName: z.key.Hdr.Name,
+		Algorithm:  z.key.Algorithm,
+		Inception:  uint32(expiration.Add(-48 * time.Hour).Unix()),
+		Expiration: uint32(expiration.Unix()),
+	}
+	if err := signature.Sign(z.privateKey, rrset); err != nil {
+		t.Fatal(err)
+	}
+	return append(rrset, signature)
+}
+
+func mustNewRR(t *testing.T, s string) dns.RR {
+	t.Helper()
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rr
+}
+
+// starts a resolver, which answers with the provided records.
+// every other query is answered with the (signed) denial of existence.
+func startTestResolver(t *testing.T, records map[string][]dns.RR, denial []dns.RR) string {
+	t.Helper()
+	return startTestResolverWithRcodes(t, records, denial, nil)
+}
+
+// like startTestResolver - the queries for the names of rcodes (fqdn) are answered with the provided rcode
+func startTestResolverWithRcodes(t *testing.T, records map[string][]dns.RR, denial []dns.RR, rcodes map[string]int) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{PacketConn: conn, NotifyStartedFunc: func() { close(started) }, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		question := r.Question[0]
+		m.Rcode = rcodes[strings.ToLower(question.Name)]
+		if answer, ok := records[strings.ToLower(question.Name)+"/"+dns.TypeToString[question.Qtype]]; ok {
+			m.Answer = answer
+		} else {
+			m.Ns = denial
+		}
+		w.WriteMsg(m) // nolint // the test fails, if the response is missing
+	})}
+	go server.ActivateAndServe() // nolint // the server is shut down after the test
+	<-started
+	t.Cleanup(func() { server.Shutdown() }) // nolint // the test is over anyway
+	return conn.LocalAddr().String()
+}
+
+func TestDNSSEC(t *testing.T) {
+	root := newTestDNSSECZone(t, ".")
+	zone := newTestDNSSECZone(t, "test.")
+	valid := time.Now().Add(24 * time.Hour)
+	expired := time.Now().Add(-24 * time.Hour)
+
+	table := []struct {
+		name               string
+		aExpiration        time.Time
+		withoutDS          bool
+		expectedDidPass    DidPass
+		expectedErrors     []string
+		expectedChainBreak string
+	}{
+		{name: "valid chain", aExpiration: valid, expectedDidPass: Success, expectedErrors: []string{}},
+		{name: "expired signature", aExpiration: expired, expectedDidPass: Failure, expectedErrors: []string{DNSSECSignatureExpired}},
+		{name: "missing ds", aExpiration: valid, withoutDS: true, expectedDidPass: Failure, expectedErrors: []string{DNSSECMissingDS}, expectedChainBreak: "test."},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			records := map[string][]dns.RR{
+				"./DNSKEY":     root.sign(t, valid, root.key),
+				"test./DNSKEY": zone.sign(t, valid, zone.key),
+				"test./SOA":    zone.sign(t, valid, mustNewRR(t, "test. 3600 IN SOA ns.test. hostmaster.test. 1 7200 3600 1209600 3600")),
+				"www.test./A":  zone.sign(t, test.aExpiration, mustNewRR(t, "www.test. 3600 IN A 192.0.2.1")),
+			}
+			if !test.withoutDS {
+				records["test./DS"] = root.sign(t, valid, zone.key.ToDS(dns.SHA256))
+			}
+			denial := zone.sign(t, valid, mustNewRR(t, "test. 3600 IN NSEC www.test. SOA RRSIG NSEC DNSKEY"))
+
+			d := domainAnalyzer{dnssecValidator: dnssecValidator{
+				client:       new(dns.Client),
+				resolver:     startTestResolver(t, records, denial),
+				trustAnchors: []*dns.DS{root.key.ToDS(dns.SHA256)},
+			}}
+			target, _ := url.Parse("https://www.test")
+			actual := d.dnssec(context.Background(), Target{URL: target})
+
+			if test.expectedDidPass == Success && !actual.IsSuccess() || test.expectedDidPass == Failure && !actual.IsError() {
+				t.Fatalf("Expected %v, got %+v", *test.expectedDidPass, actual)
+			}
+			if len(actual.Errors) != len(test.expectedErrors) || !utils.IncludesSubset(actual.Errors, test.expectedErrors) {
+				t.Errorf("Expected errors %v, got %v", test.expectedErrors, actual.Errors)
+			}
+			chainBreak := actual.ActualValue.(map[string]any)["chainBreak"].(*dnssecChainBreak)
+			if test.expectedChainBreak == "" && chainBreak != nil || test.expectedChainBreak != "" && (chainBreak == nil || chainBreak.Zone != test.expectedChainBreak) {
+				t.Errorf("Expected the chain to break at %q, got %+v", test.expectedChainBreak, chainBreak)
+			}
+			// the zone uses NSEC
+			if test.expectedDidPass == Success && !utils.Includes(actual.Recommendations, DNSSECZoneWalking) {
+				t.Errorf("Expected the recommendation %s, got %v", DNSSECZoneWalking, actual.Recommendations)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package scanner
 
-import "time"
+import (
+	"time"
+)
 
 func errorMessage(err any) string {
 	switch e := err.(type) {
@@ -22,3 +24,24 @@ func buildAnalysisError(err any, rules []AnalysisRuleId) map[AnalysisRuleId]Anal
 	}
 	return m
 }
+
+// marks the enabled checks, which could not be done, because the server requires a client certificate.
+// the CertificateRequest (including the acceptable CAs) is added to their actual value.
+func applyClientAuthRequired(res map[AnalysisRuleId]AnalysisResult, options TargetScanOptions, request *ClientCertificateRequest) {
+	if request == nil {
+		return
+	}
+	for rule, result := range res {
+		if result.DidPass != nil || !options.EnabledChecks[rule] {
+			continue
+		}
+		actualValue := map[string]any{}
+		if value, ok := result.ActualValue.(map[string]any); ok {
+			for k, v := range value {
+				actualValue[k] = v
+			}
+		}
+		actualValue["clientCertificateRequest"] = request
+		res[rule] = NewAnalysisResult(Unknown, actualValue, append(append([]string{}, result.Errors...), ClientAuthRequired), result.Recommendations, result.Duration)
+	}
+}
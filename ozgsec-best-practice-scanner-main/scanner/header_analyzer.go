@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/httpclient"
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
 )
 
 type headerAnalyzer struct {
@@ -14,7 +15,7 @@ type headerAnalyzer struct {
 	xssProtectionValidator         validator[string]
 	hstsPreloadedValidator         validator[string]
 	xContentTypeOptionsValidator   validator[string]
-	contentSecurityPolicyValidator validator[string]
+	contentSecurityPolicyValidator validator[contentSecurityPolicy]
 }
 
 const (
@@ -84,27 +85,6 @@ func newXContentTypeOptionsValidator() validator[string] {
 	}, FnMap[string]{})
 }
 
-func newContentSecurityPolicyValidator() validator[string] {
-	return NewValidator(FnMap[string]{
-		MissingHeader: func(val string) bool {
-			return val == ""
-		},
-	}, FnMap[string]{
-		MissingDefaultSrcWithSelf: func(val string) bool {
-			return !strings.Contains(val, "default-src 'self'")
-		},
-		MissingScriptSrc: func(val string) bool {
-			return !strings.Contains(val, "script-src")
-		},
-		MissingStyleSrc: func(val string) bool {
-			return !strings.Contains(val, "style-src")
-		},
-		MissingImgSrc: func(val string) bool {
-			return !strings.Contains(val, "img-src")
-		},
-	})
-}
-
 func newHstsPreloadedValidator() validator[string] {
 	return NewValidator(FnMap[string]{
 		MissingPreload: func(val string) bool {
@@ -177,11 +157,25 @@ func (i headerAnalyzer) xContentTypeOptions(resp httpclient.Response) AnalysisRe
 func (i headerAnalyzer) contentSecurityPolicy(resp httpclient.Response) AnalysisResult {
 	start := time.Now()
 	header := resp.Response().Header.Get("Content-Security-Policy")
-	didPass, errors, recommendations := i.contentSecurityPolicyValidator.Validate(header)
-
-	return NewAnalysisResult(didPass, map[string]any{
+	policies := contentSecurityPolicies(resp)
+	actualValue := map[string]any{
 		"Content-Security-Policy": header,
-	}, errors, recommendations, time.Since(start))
+		"policies":                policies,
+	}
+
+	// a resource needs to be allowed by every enforced policy - therefore only the findings of every enforced policy are reported
+	enforced := utils.Filter(policies, func(p contentSecurityPolicy) bool {
+		return p.Disposition == cspDispositionEnforce
+	})
+	if len(enforced) == 0 {
+		if len(policies) > 0 {
+			return NewAnalysisResult(Failure, actualValue, []string{CSPReportOnly}, nil, time.Since(start))
+		}
+		return NewAnalysisResult(Failure, actualValue, []string{MissingHeader}, nil, time.Since(start))
+	}
+	didPass, errors, recommendations := i.contentSecurityPolicyValidator.validateAll(enforced)
+
+	return NewAnalysisResult(didPass, actualValue, errors, recommendations, time.Since(start))
 }
 
 func (i headerAnalyzer) Analyze(ctx context.Context, target Target, resp httpclient.Response) (map[AnalysisRuleId]AnalysisResult, error) {
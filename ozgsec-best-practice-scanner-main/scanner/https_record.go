@@ -0,0 +1,360 @@
+package scanner
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"golang.org/x/crypto/cryptobyte"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+const (
+	HTTPSRecordInvalidECH      = "httpsRecordInvalidEch"
+	HTTPSRecordALPNMismatch    = "httpsRecordAlpnMismatch"
+	HTTPSRecordPortMismatch    = "httpsRecordPortMismatch"
+	HTTPSRecordHintMismatch    = "httpsRecordHintMismatch"
+	HTTPSRecordECHWithoutTLS13 = "httpsRecordEchWithoutTls13"
+)
+
+const (
+	// the maximum number of AliasMode records, which are followed
+	maxHTTPSAliasChainLength = 4
+	// the ECHConfig version of draft-ietf-tls-esni-18 and later
+	echConfigVersion = 0xfe0d
+)
+
+// the parsed ECHConfig (draft-ietf-tls-esni Section 4)
+type echConfig struct {
+	ConfigID          uint8                         `json:"configId"`
+	KEMID             uint16                        `json:"kemId"`
+	CipherSuites      []echHPKESymmetricCipherSuite `json:"cipherSuites"`
+	MaximumNameLength uint8                         `json:"maximumNameLength"`
+	PublicName        string                        `json:"publicName"`
+}
+
+type echHPKESymmetricCipherSuite struct {
+	KDFID  uint16 `json:"kdfId"`
+	AEADID uint16 `json:"aeadId"`
+}
+
+// a ServiceMode record (RFC9460 Section 2.4.3)
+type httpsServiceRecord struct {
+	Name     string `json:"name"`
+	Priority uint16 `json:"priority"`
+	// the target name - the owner name, if the record contains "."
+	Target        string      `json:"target"`
+	ALPN          []string    `json:"alpn"`
+	NoDefaultALPN bool        `json:"noDefaultAlpn"`
+	Port          uint16      `json:"port,omitempty"`
+	IPv4Hint      []string    `json:"ipv4hint"`
+	IPv6Hint      []string    `json:"ipv6hint"`
+	ECH           []echConfig `json:"ech,omitempty"`
+	// true, if the record points to the scanned host and was compared with the observed tls connection
+	Verified bool `json:"verified"`
+}
+
+type httpsRecordEvaluation struct {
+	// the queried name - "_<port>._https.<host>" for ports other than 443 (RFC9460 Section 9.1)
+	Name string `json:"name"`
+	// the targets of the followed AliasMode records
+	Aliases []string             `json:"aliases"`
+	Records []httpsServiceRecord `json:"records"`
+	// the application protocols, which were offered to the server, and if the server selected them - added after the scan
+	NegotiatedALPN map[string]bool `json:"negotiatedAlpn,omitempty"`
+	// the Alt-Svc header of the http response - used to verify h3
+	AltSvc string `json:"altSvc,omitempty"`
+}
+
+// parses an ECHConfigList (draft-ietf-tls-esni Section 4).
+// configs with an unknown version are skipped - an error is returned, if the list is malformed or no config is supported.
+func parseECHConfigList(data []byte) ([]echConfig, error) {
+	s := cryptobyte.String(data)
+	var list cryptobyte.String
+	if !s.ReadUint16LengthPrefixed(&list) || !s.Empty() || list.Empty() {
+		return nil, fmt.Errorf("malformed ECHConfigList")
+	}
+	configs := make([]echConfig, 0)
+	for !list.Empty() {
+		var version uint16
+		var contents cryptobyte.String
+		if !list.ReadUint16(&version) || !list.ReadUint16LengthPrefixed(&contents) {
+			return nil, fmt.Errorf("malformed ECHConfig")
+		}
+		if version != echConfigVersion {
+			continue
+		}
+		var config echConfig
+		var publicKey, cipherSuites, publicName, extensions cryptobyte.String
+		if !contents.ReadUint8(&config.ConfigID) ||
+			!contents.ReadUint16(&config.KEMID) ||
+			!contents.ReadUint16LengthPrefixed(&publicKey) || publicKey.Empty() ||
+			!contents.ReadUint16LengthPrefixed(&cipherSuites) || len(cipherSuites) < 4 || len(cipherSuites)%4 != 0 ||
+			!contents.ReadUint8(&config.MaximumNameLength) ||
+			!contents.ReadUint8LengthPrefixed(&publicName) || publicName.Empty() ||
+			!contents.ReadUint16LengthPrefixed(&extensions) || !contents.Empty() {
+			return nil, fmt.Errorf("malformed ECHConfigContents")
+		}
+		for !cipherSuites.Empty() {
+			var suite echHPKESymmetricCipherSuite
+			cipherSuites.ReadUint16(&suite.KDFID)
+			cipherSuites.ReadUint16(&suite.AEADID)
+			config.CipherSuites = append(config.CipherSuites, suite)
+		}
+		config.PublicName = string(publicName)
+		if _, ok := dns.IsDomainName(config.PublicName); !ok || net.ParseIP(config.PublicName) != nil {
+			return nil, fmt.Errorf("invalid public name %q", config.PublicName)
+		}
+		configs = append(configs, config)
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("no supported ECHConfig version")
+	}
+	return configs, nil
+}
+
+// returns the name, at which the HTTPS records of the target are published (RFC9460 Section 9.1)
+func httpsRecordName(target Target) string {
+	hostname := normalizeHostname(target.URL.Hostname())
+	if port := target.URL.Port(); port != "" && port != "443" {
+		return "_" + port + "._https." + hostname
+	}
+	return hostname
+}
+
+func parseHTTPSServiceRecord(rr *dns.HTTPS) (httpsServiceRecord, error) {
+	record := httpsServiceRecord{
+		Name:     normalizeHostname(rr.Hdr.Name),
+		Priority: rr.Priority,
+		Target:   normalizeHostname(rr.Target),
+		ALPN:     make([]string, 0),
+		IPv4Hint: make([]string, 0),
+		IPv6Hint: make([]string, 0),
+	}
+	if record.Target == "" {
+		record.Target = record.Name
+	}
+	for _, value := range rr.Value {
+		switch v := value.(type) {
+		case *dns.SVCBAlpn:
+			record.ALPN = v.Alpn
+		case *dns.SVCBNoDefaultAlpn:
+			record.NoDefaultALPN = true
+		case *dns.SVCBPort:
+			record.Port = v.Port
+		case *dns.SVCBIPv4Hint:
+			record.IPv4Hint = utils.Map(v.Hint, net.IP.String)
+		case *dns.SVCBIPv6Hint:
+			record.IPv6Hint = utils.Map(v.Hint, net.IP.String)
+		case *dns.SVCBECHConfig:
+			configs, err := parseECHConfigList(v.ECH)
+			if err != nil {
+				return record, err
+			}
+			record.ECH = configs
+		}
+	}
+	return record, nil
+}
+
+// returns the HTTPS records of the name - AliasMode records are followed (RFC9460 Section 2.4.2)
+func (d domainAnalyzer) httpsRecords(ctx context.Context, name string) ([]string, []*dns.HTTPS, error) {
+	aliases := make([]string, 0)
+	for len(aliases) <= maxHTTPSAliasChainLength {
+		msg, err := d.exchange(ctx, name, dns.TypeHTTPS)
+		if err != nil {
+			return nil, nil, err
+		}
+		if msg.Rcode != dns.RcodeSuccess && msg.Rcode != dns.RcodeNameError {
+			return nil, nil, fmt.Errorf("dns lookup of %s failed: %s", name, dns.RcodeToString[msg.Rcode])
+		}
+		records := make([]*dns.HTTPS, 0)
+		var alias *dns.HTTPS
+		for _, answer := range msg.Answer {
+			if rr, ok := answer.(*dns.HTTPS); ok {
+				if rr.Priority == 0 {
+					alias = rr
+				} else {
+					records = append(records, rr)
+				}
+			}
+		}
+		if alias == nil {
+			return aliases, records, nil
+		}
+		// ServiceMode records are ignored in the presence of an AliasMode record (RFC9460 Section 2.4.2).
+		// the target "." indicates, that the service is not available.
+		target := normalizeHostname(alias.Target)
+		if target == "" || utils.Includes(aliases, target) {
+			return aliases, nil, nil
+		}
+		aliases = append(aliases, target)
+		name = target
+	}
+	return aliases, nil, nil
+}
+
+/*
+REQUIRED: The hostname publishes an HTTPS record (RFC9460) - the check is informational.
+REQUIRED: The "ech" parameter contains a valid ECHConfigList with at least one supported config.
+REQUIRED: The parameters of the records, which point to the scanned host, match the observed connection (see applyHTTPSRecordObservations):
+
+	alpn: every listed protocol (and http/1.1 unless no-default-alpn is set) is selected by the server - h3 needs to be announced using Alt-Svc
+	port: the port matches the port of the scanned URL
+	ipv4hint/ ipv6hint: every hint is an A or AAAA record of the host
+	ech: the server supports TLS 1.3 - the acceptance of ECH itself is not verified
+
+	Example: www.example.com. HTTPS 1 . alpn="h2,h3" ipv4hint=192.0.2.1 ech=AEX+DQBB...
+
+Source: https://www.rfc-editor.org/rfc/rfc9460
+*/
+func (d domainAnalyzer) httpsRecord(ctx context.Context, target Target) AnalysisResult {
+	start := time.Now()
+	name := httpsRecordName(target)
+	aliases, records, err := d.httpsRecords(ctx, name)
+	if err != nil {
+		return NewAnalysisResult(Unknown, nil, nil, nil, time.Since(start))
+	}
+	if len(records) == 0 {
+		return NewAnalysisResult(Failure, nil, nil, nil, time.Since(start))
+	}
+
+	evaluation := httpsRecordEvaluation{
+		Name:    name,
+		Aliases: aliases,
+		Records: make([]httpsServiceRecord, 0),
+	}
+	errors := make([]string, 0)
+	for _, rr := range records {
+		record, err := parseHTTPSServiceRecord(rr)
+		if err != nil && !utils.Includes(errors, HTTPSRecordInvalidECH) {
+			errors = append(errors, HTTPSRecordInvalidECH)
+		}
+		evaluation.Records = append(evaluation.Records, record)
+	}
+	if len(errors) > 0 {
+		return NewAnalysisResult(Failure, evaluation, errors, nil, time.Since(start))
+	}
+	return NewAnalysisResult(Success, evaluation, nil, nil, time.Since(start))
+}
+
+// returns true, if the server selects the application protocol (RFC7301)
+func negotiatesALPN(ctx context.Context, target Target, protocol string) (bool, error) {
+	conn, _, err := tlsHandshake(ctx, target, &tls.Config{
+		ServerName:         target.URL.Hostname(),
+		NextProtos:         []string{protocol},
+		InsecureSkipVerify: insecureSkipVerify, // nolint // we are just interested in the tls stack - not if the certificate is valid
+	})
+	if err != nil {
+		// a server, which does not support any offered protocol, aborts the handshake (RFC7301 Section 3.2)
+		if strings.Contains(err.Error(), "no application protocol") {
+			return false, nil
+		}
+		return false, err
+	}
+	defer conn.Close()
+	negotiated := conn.(*tls.Conn).ConnectionState().NegotiatedProtocol
+	// a server without ALPN support speaks http/1.1
+	return negotiated == protocol || (negotiated == "" && protocol == "http/1.1"), nil
+}
+
+// returns true, if the Alt-Svc header announces the protocol (RFC7838 Section 3)
+func altSvcAnnounces(altSvc string, protocol string) bool {
+	return utils.Some(strings.Split(altSvc, ","), func(service string) bool {
+		id, _, _ := strings.Cut(strings.TrimSpace(service), "=")
+		return id == protocol
+	})
+}
+
+// compares the HTTPS records with the connection observed by the tls and http analyzers.
+// the HTTPS record check is done by the domain analyzer, which does not have access to the connection.
+func applyHTTPSRecordObservations(ctx context.Context, res map[AnalysisRuleId]AnalysisResult, target Target, state *tls.ConnectionState, resp *http.Response) {
+	result, ok := res[HTTPSRecord]
+	if !ok || result.DidPass == Unknown || result.ActualValue == nil {
+		return
+	}
+	// the actual value might be restored from the cache - it is converted using its json representation
+	var evaluation httpsRecordEvaluation
+	b, err := json.Marshal(result.ActualValue)
+	if err != nil || json.Unmarshal(b, &evaluation) != nil {
+		return
+	}
+
+	hostname := normalizeHostname(target.URL.Hostname())
+	port := target.URL.Port()
+	if port == "" {
+		port = "443"
+	}
+	if resp != nil {
+		evaluation.AltSvc = resp.Header.Get("Alt-Svc")
+	}
+	evaluation.NegotiatedALPN = make(map[string]bool)
+	addresses := utils.Map(target.IPs, net.IP.String)
+
+	errors := make([]string, 0)
+	addError := func(errorId string) {
+		if !utils.Includes(errors, errorId) {
+			errors = append(errors, errorId)
+		}
+	}
+	for i, record := range evaluation.Records {
+		// records of other hosts are not verified - the scanner did not connect to them
+		if record.Target != hostname || state == nil {
+			continue
+		}
+		evaluation.Records[i].Verified = true
+
+		if record.Port != 0 && fmt.Sprint(record.Port) != port {
+			addError(HTTPSRecordPortMismatch)
+		}
+		hints := append(append([]string{}, record.IPv4Hint...), record.IPv6Hint...)
+		if len(addresses) > 0 && !utils.IncludesSubset(addresses, hints) {
+			addError(HTTPSRecordHintMismatch)
+		}
+		if len(record.ECH) > 0 && state.Version != tls.VersionTLS13 {
+			addError(HTTPSRecordECHWithoutTLS13)
+		}
+
+		protocols := append([]string{}, record.ALPN...)
+		if !record.NoDefaultALPN && !utils.Includes(protocols, "http/1.1") {
+			protocols = append(protocols, "http/1.1")
+		}
+		for _, protocol := range protocols {
+			negotiated, ok := evaluation.NegotiatedALPN[protocol]
+			if !ok {
+				switch protocol {
+				case "h3":
+					// the scanner does not speak QUIC
+					if resp == nil {
+						continue
+					}
+					negotiated = altSvcAnnounces(evaluation.AltSvc, protocol)
+				case "http/1.1", "h2":
+					if negotiated, err = negotiatesALPN(ctx, target, protocol); err != nil {
+						continue
+					}
+				default:
+					continue
+				}
+				evaluation.NegotiatedALPN[protocol] = negotiated
+			}
+			if !negotiated {
+				addError(HTTPSRecordALPNMismatch)
+			}
+		}
+	}
+
+	result.ActualValue = evaluation
+	if len(errors) > 0 {
+		result.DidPass = Failure
+		result.Errors = append(result.Errors, errors...)
+	}
+	res[HTTPSRecord] = result
+}
@@ -0,0 +1,255 @@
+package scanner
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/miekg/dns"
+	"golang.org/x/crypto/cryptobyte"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/tlsclient"
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+// builds an ECHConfigList containing a single config with the version and the public name
+func testECHConfigList(version uint16, publicName string) []byte {
+	b := cryptobyte.NewBuilder(nil)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint16(version)
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddUint8(1)       // config id
+			b.AddUint16(0x0020) // DHKEM(X25519, HKDF-SHA256)
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				b.AddBytes(make([]byte, 32))
+			})
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				b.AddUint16(0x0001) // HKDF-SHA256
+				b.AddUint16(0x0001) // AES-128-GCM
+			})
+			b.AddUint8(0)
+			b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+				b.AddBytes([]byte(publicName))
+			})
+			b.AddUint16(0) // extensions
+		})
+	})
+	return b.BytesOrPanic()
+}
+
+func TestParseECHConfigList(t *testing.T) {
+	valid := testECHConfigList(echConfigVersion, "public.example.test")
+	table := []struct {
+		name               string
+		data               []byte
+		expectedPublicName string
+		valid              bool
+	}{
+		{"valid", valid, "public.example.test", true},
+		{"unsupported version", testECHConfigList(0xfe0a, "public.example.test"), "", false},
+		{"ip as public name", testECHConfigList(echConfigVersion, "192.0.2.1"), "", false},
+		{"truncated", valid[:len(valid)-3], "", false},
+		{"empty", []byte{0, 0}, "", false},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			configs, err := parseECHConfigList(test.data)
+			if (err == nil) != test.valid {
+				t.Fatalf("Expected valid to be %v, got %v", test.valid, err)
+			}
+			if test.valid && (len(configs) != 1 || configs[0].PublicName != test.expectedPublicName || len(configs[0].CipherSuites) != 1) {
+				t.Errorf("Expected a single config for %s, got %+v", test.expectedPublicName, configs)
+			}
+		})
+	}
+}
+
+func TestHTTPSRecord(t *testing.T) {
+	ech := base64.StdEncoding.EncodeToString(testECHConfigList(echConfigVersion, "public.example.test"))
+
+	table := []struct {
+		name            string
+		records         map[string][]dns.RR
+		expectedDidPass DidPass
+		expectedErrors  []string
+		expectedRecords int
+		expectedAliases []string
+	}{
+		{
+			name:            "no record",
+			records:         map[string][]dns.RR{},
+			expectedDidPass: Failure,
+		},
+		{
+			name:            "service mode",
+			records:         testRecords(t, `www.example.test. 3600 IN HTTPS 1 . alpn="h2,h3" ipv4hint=192.0.2.1 ech=`+ech),
+			expectedDidPass: Success,
+			expectedRecords: 1,
+		},
+		{
+			name: "alias mode",
+			records: testRecords(t,
+				"www.example.test. 3600 IN HTTPS 0 cdn.example.net.",
+				`cdn.example.net. 3600 IN HTTPS 1 . alpn="h2"`,
+				`cdn.example.net. 3600 IN HTTPS 2 backup.example.net. alpn="h2"`,
+			),
+			expectedDidPass: Success,
+			expectedRecords: 2,
+			expectedAliases: []string{"cdn.example.net"},
+		},
+		{
+			name:            "service not available",
+			records:         testRecords(t, "www.example.test. 3600 IN HTTPS 0 ."),
+			expectedDidPass: Failure,
+		},
+		{
+			name:            "invalid ech",
+			records:         testRecords(t, `www.example.test. 3600 IN HTTPS 1 . alpn="h2" ech=AAEA`),
+			expectedDidPass: Failure,
+			expectedErrors:  []string{HTTPSRecordInvalidECH},
+			expectedRecords: 1,
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			d := domainAnalyzer{
+				client:   new(dns.Client),
+				resolver: startTestResolver(t, test.records, nil),
+			}
+			target, _ := url.Parse("https://www.example.test")
+			actual := d.httpsRecord(context.Background(), Target{URL: target})
+
+			if test.expectedDidPass == Success && !actual.IsSuccess() || test.expectedDidPass == Failure && !actual.IsError() {
+				t.Fatalf("Expected %v, got %+v", *test.expectedDidPass, actual)
+			}
+			if len(actual.Errors) != len(test.expectedErrors) || !utils.IncludesSubset(actual.Errors, test.expectedErrors) {
+				t.Errorf("Expected errors %v, got %v", test.expectedErrors, actual.Errors)
+			}
+			if test.expectedRecords == 0 {
+				return
+			}
+			evaluation := actual.ActualValue.(httpsRecordEvaluation)
+			if len(evaluation.Records) != test.expectedRecords {
+				t.Errorf("Expected %d records, got %+v", test.expectedRecords, evaluation.Records)
+			}
+			if len(evaluation.Aliases) != len(test.expectedAliases) || !utils.IncludesSubset(evaluation.Aliases, test.expectedAliases) {
+				t.Errorf("Expected aliases %v, got %v", test.expectedAliases, evaluation.Aliases)
+			}
+		})
+	}
+}
+
+func TestApplyHTTPSRecordObservations(t *testing.T) {
+	insecureSkipVerify = true
+	ech := []echConfig{{PublicName: "public.example.test"}}
+
+	table := []struct {
+		name             string
+		record           httpsServiceRecord
+		http2            bool
+		tlsVersion       uint16
+		altSvc           string
+		expectedDidPass  DidPass
+		expectedErrors   []string
+		expectedVerified bool
+	}{
+		{
+			name:             "matching record",
+			record:           httpsServiceRecord{ALPN: []string{"h2"}, IPv4Hint: []string{"127.0.0.1"}, ECH: ech},
+			http2:            true,
+			tlsVersion:       tls.VersionTLS13,
+			expectedDidPass:  Success,
+			expectedVerified: true,
+		},
+		{
+			name:             "h2 not supported",
+			record:           httpsServiceRecord{ALPN: []string{"h2"}},
+			tlsVersion:       tls.VersionTLS13,
+			expectedDidPass:  Failure,
+			expectedErrors:   []string{HTTPSRecordALPNMismatch},
+			expectedVerified: true,
+		},
+		{
+			name:             "h3 announced",
+			record:           httpsServiceRecord{ALPN: []string{"h3"}},
+			tlsVersion:       tls.VersionTLS13,
+			altSvc:           `h3=":443"; ma=86400`,
+			expectedDidPass:  Success,
+			expectedVerified: true,
+		},
+		{
+			name:             "h3 not announced",
+			record:           httpsServiceRecord{ALPN: []string{"h3"}},
+			tlsVersion:       tls.VersionTLS13,
+			expectedDidPass:  Failure,
+			expectedErrors:   []string{HTTPSRecordALPNMismatch},
+			expectedVerified: true,
+		},
+		{
+			name:             "port and hint mismatch",
+			record:           httpsServiceRecord{Port: 1, IPv4Hint: []string{"192.0.2.1"}},
+			tlsVersion:       tls.VersionTLS13,
+			expectedDidPass:  Failure,
+			expectedErrors:   []string{HTTPSRecordPortMismatch, HTTPSRecordHintMismatch},
+			expectedVerified: true,
+		},
+		{
+			name:             "ech without tls 1.3",
+			record:           httpsServiceRecord{ECH: ech},
+			tlsVersion:       tls.VersionTLS12,
+			expectedDidPass:  Failure,
+			expectedErrors:   []string{HTTPSRecordECHWithoutTLS13},
+			expectedVerified: true,
+		},
+		{
+			name:            "record of another host",
+			record:          httpsServiceRecord{Target: "cdn.example.net", Port: 1, ECH: ech},
+			tlsVersion:      tls.VersionTLS12,
+			expectedDidPass: Success,
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			server.EnableHTTP2 = test.http2
+			server.StartTLS()
+			defer server.Close()
+
+			u, _ := url.Parse(server.URL)
+			target := Target{URL: u, IPs: []net.IP{net.ParseIP("127.0.0.1")}, IPV4Address: net.ParseIP("127.0.0.1"), Options: TargetScanOptions{
+				TlsClient: tlsclient.NewDefaultClient(),
+			}}
+			record := test.record
+			if record.Target == "" {
+				record.Target = u.Hostname()
+			}
+			res := map[AnalysisRuleId]AnalysisResult{
+				HTTPSRecord: NewAnalysisResult(Success, httpsRecordEvaluation{Records: []httpsServiceRecord{record}}, nil, nil, 0),
+			}
+			resp := &http.Response{Header: http.Header{}}
+			if test.altSvc != "" {
+				resp.Header.Set("Alt-Svc", test.altSvc)
+			}
+			applyHTTPSRecordObservations(context.Background(), res, target, &tls.ConnectionState{Version: test.tlsVersion}, resp)
+
+			actual := res[HTTPSRecord]
+			if test.expectedDidPass == Success && !actual.IsSuccess() || test.expectedDidPass == Failure && !actual.IsError() {
+				t.Fatalf("Expected %v, got %+v", *test.expectedDidPass, actual)
+			}
+			if len(actual.Errors) != len(test.expectedErrors) || !utils.IncludesSubset(actual.Errors, test.expectedErrors) {
+				t.Errorf("Expected errors %v, got %v", test.expectedErrors, actual.Errors)
+			}
+			if verified := actual.ActualValue.(httpsRecordEvaluation).Records[0].Verified; verified != test.expectedVerified {
+				t.Errorf("Expected verified to be %v, got %v", test.expectedVerified, verified)
+			}
+		})
+	}
+}
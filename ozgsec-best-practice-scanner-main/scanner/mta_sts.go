@@ -0,0 +1,241 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+const (
+	MTASTSMultipleRecords          = "mtaStsMultipleRecords"
+	MTASTSSyntaxError              = "mtaStsSyntaxError"
+	MTASTSPolicyNotFound           = "mtaStsPolicyNotFound"
+	MTASTSPolicyRedirect           = "mtaStsPolicyRedirect"
+	MTASTSPolicyInvalidContentType = "mtaStsPolicyInvalidContentType"
+	MTASTSPolicySyntaxError        = "mtaStsPolicySyntaxError"
+	MTASTSModeNone                 = "mtaStsModeNone"
+	MTASTSMXNotCovered             = "mtaStsMxNotCovered"
+
+	MTASTSTestingMode = "mtaStsTestingMode"
+	MTASTSShortMaxAge = "mtaStsShortMaxAge"
+)
+
+// RFC8461 Section 3.2
+const (
+	mtaSTSMaxAge            = 31557600
+	mtaSTSRecommendedMaxAge = 7 * 24 * 60 * 60
+	// the policy is a small text file - everything above is not read
+	mtaSTSMaxPolicySize = 64 * 1024
+)
+
+var mtaSTSIdPattern = regexp.MustCompile(`^[a-zA-Z0-9]{1,32}$`)
+
+// mtaSTSPolicy is the parsed policy file (RFC8461 Section 3.2)
+type mtaSTSPolicy struct {
+	Version string   `json:"version"`
+	Mode    string   `json:"mode"`
+	MaxAge  int      `json:"maxAge"`
+	MX      []string `json:"mx"`
+}
+
+// parses the "_mta-sts" TXT record and returns the policy id (RFC8461 Section 3.1)
+func parseMTASTSRecord(record string) (string, bool) {
+	fields := utils.Map(strings.Split(record, ";"), strings.TrimSpace)
+	if fields[0] != "v=STSv1" {
+		return "", false
+	}
+	id := ""
+	for _, field := range fields[1:] {
+		name, value, _ := strings.Cut(field, "=")
+		if name == "id" {
+			id = value
+		}
+	}
+	return id, mtaSTSIdPattern.MatchString(id)
+}
+
+// parses the policy file. every line is a "key: value" pair - unknown keys are ignored.
+func parseMTASTSPolicy(body string) (mtaSTSPolicy, bool) {
+	policy := mtaSTSPolicy{MX: make([]string, 0)}
+	hasMaxAge := false
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return policy, false
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "version":
+			policy.Version = value
+		case "mode":
+			policy.Mode = value
+		case "max_age":
+			maxAge, err := strconv.Atoi(value)
+			if err != nil || maxAge < 0 || maxAge > mtaSTSMaxAge {
+				return policy, false
+			}
+			policy.MaxAge = maxAge
+			hasMaxAge = true
+		case "mx":
+			policy.MX = append(policy.MX, strings.ToLower(value))
+		}
+	}
+
+	if policy.Version != "STSv1" || !hasMaxAge || !utils.Includes([]string{"enforce", "testing", "none"}, policy.Mode) {
+		return policy, false
+	}
+	// a policy with the mode none does not need any mx patterns
+	return policy, policy.Mode == "none" || len(policy.MX) > 0
+}
+
+// checks, if the mx host matches the pattern of the policy. a wildcard only matches the leftmost label (RFC8461 Section 4.1).
+func mtaSTSPatternMatches(pattern string, host string) bool {
+	pattern = strings.TrimSuffix(strings.ToLower(pattern), ".")
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if suffix, isWildcard := strings.CutPrefix(pattern, "*."); isWildcard {
+		label, rest, ok := strings.Cut(host, ".")
+		return ok && label != "" && rest == suffix
+	}
+	return pattern == host
+}
+
+// returns the mx hosts of the domain - a null mx (".") is not returned
+func (d domainAnalyzer) mxHosts(ctx context.Context, domain string) ([]string, error) {
+	msg, err := d.exchange(ctx, domain, dns.TypeMX)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Rcode != dns.RcodeSuccess && msg.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("dns lookup of %s failed: %s", domain, dns.RcodeToString[msg.Rcode])
+	}
+	hosts := make([]string, 0)
+	for _, answer := range msg.Answer {
+		if mx, ok := answer.(*dns.MX); ok && mx.Mx != "." {
+			hosts = append(hosts, strings.TrimSuffix(strings.ToLower(mx.Mx), "."))
+		}
+	}
+	return hosts, nil
+}
+
+// fetches the policy file. redirects must not be followed (RFC8461 Section 3.3).
+func fetchMTASTSPolicy(ctx context.Context, target Target, domain string) (string, []string) {
+	policyURL := &url.URL{Scheme: "https", Host: "mta-sts." + domain, Path: "/.well-known/mta-sts.txt"}
+	res, err := target.Options.HttpClient.Get(ctx, policyURL)
+	if err != nil || res.Response() == nil {
+		// this includes invalid certificates of the policy host
+		return "", []string{MTASTSPolicyNotFound}
+	}
+	resp := res.Response()
+	defer resp.Body.Close()
+	if len(res.ResponseChain()) > 1 || resp.Request.URL.String() != policyURL.String() {
+		return "", []string{MTASTSPolicyRedirect}
+	}
+	if resp.StatusCode != 200 {
+		return "", []string{MTASTSPolicyNotFound}
+	}
+	if !strings.HasPrefix(strings.ToLower(resp.Header.Get("Content-Type")), "text/plain") {
+		return "", []string{MTASTSPolicyInvalidContentType}
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, mtaSTSMaxPolicySize))
+	if err != nil {
+		return "", []string{MTASTSPolicyNotFound}
+	}
+	return string(body), nil
+}
+
+/*
+REQUIRED: The domain publishes exactly one valid "_mta-sts" TXT record (RFC8461 Section 3.1)
+REQUIRED: The policy is served at https://mta-sts.<domain>/.well-known/mta-sts.txt with a valid certificate, without redirects and with the content type text/plain
+REQUIRED: The policy is valid and its mode is not "none"
+REQUIRED: Every MX record of the domain matches an mx pattern of the policy
+
+RECOMMENDED: The mode is "enforce" - "testing" only reports failures
+RECOMMENDED: The max_age is at least one week (RFC8461 Section 3.2)
+
+Source: https://www.rfc-editor.org/rfc/rfc8461
+*/
+func (d domainAnalyzer) mtaSTS(ctx context.Context, target Target) AnalysisResult {
+	start := time.Now()
+	domain := mailDomain(target)
+
+	msg, err := d.exchange(ctx, "_mta-sts."+domain, dns.TypeTXT)
+	if err != nil {
+		return NewAnalysisResult(Unknown, nil, nil, nil, time.Since(start))
+	}
+	records := make([]string, 0)
+	for _, answer := range msg.Answer {
+		if txt, ok := answer.(*dns.TXT); ok && strings.HasPrefix(txtRecordValue(txt), "v=STSv1") {
+			records = append(records, txtRecordValue(txt))
+		}
+	}
+	if len(records) == 0 {
+		return NewAnalysisResult(Failure, nil, nil, nil, time.Since(start))
+	}
+	if len(records) > 1 {
+		return NewAnalysisResult(Failure, map[string]any{
+			"records": records,
+		}, []string{MTASTSMultipleRecords}, nil, time.Since(start))
+	}
+
+	actualValue := map[string]any{
+		"record": records[0],
+	}
+	id, ok := parseMTASTSRecord(records[0])
+	if !ok {
+		return NewAnalysisResult(Failure, actualValue, []string{MTASTSSyntaxError}, nil, time.Since(start))
+	}
+	actualValue["id"] = id
+
+	body, errors := fetchMTASTSPolicy(ctx, target, domain)
+	if len(errors) > 0 {
+		return NewAnalysisResult(Failure, actualValue, errors, nil, time.Since(start))
+	}
+	policy, ok := parseMTASTSPolicy(body)
+	if !ok {
+		return NewAnalysisResult(Failure, actualValue, []string{MTASTSPolicySyntaxError}, nil, time.Since(start))
+	}
+	actualValue["policy"] = policy
+
+	mxHosts, err := d.mxHosts(ctx, domain)
+	if err != nil {
+		return NewAnalysisResult(Unknown, actualValue, nil, nil, time.Since(start))
+	}
+	uncovered := utils.Filter(mxHosts, func(host string) bool {
+		return !utils.Some(policy.MX, func(pattern string) bool { return mtaSTSPatternMatches(pattern, host) })
+	})
+	actualValue["mx"] = mxHosts
+	actualValue["uncoveredMx"] = uncovered
+
+	errors = make([]string, 0)
+	recommendations := make([]string, 0)
+	switch policy.Mode {
+	case "none":
+		errors = append(errors, MTASTSModeNone)
+	case "testing":
+		recommendations = append(recommendations, MTASTSTestingMode)
+	}
+	if policy.Mode != "none" && len(uncovered) > 0 {
+		errors = append(errors, MTASTSMXNotCovered)
+	}
+	if policy.MaxAge < mtaSTSRecommendedMaxAge {
+		recommendations = append(recommendations, MTASTSShortMaxAge)
+	}
+
+	if len(errors) > 0 {
+		return NewAnalysisResult(Failure, actualValue, errors, recommendations, time.Since(start))
+	}
+	return NewAnalysisResult(Success, actualValue, nil, recommendations, time.Since(start))
+}
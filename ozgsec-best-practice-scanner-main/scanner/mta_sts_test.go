@@ -0,0 +1,161 @@
+package scanner
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/httpclient"
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+func TestMTASTSPatternMatches(t *testing.T) {
+	table := []struct {
+		pattern  string
+		host     string
+		expected bool
+	}{
+		{"mail.example.test", "mail.example.test.", true},
+		{"*.example.test", "mx1.example.test", true},
+		{"*.example.test", "a.mx1.example.test", false},
+		{"*.example.test", "example.test", false},
+		{"mail.example.test", "mx.example.test", false},
+	}
+
+	for _, test := range table {
+		if actual := mtaSTSPatternMatches(test.pattern, test.host); actual != test.expected {
+			t.Errorf("Expected %s matching %s to be %v", test.pattern, test.host, test.expected)
+		}
+	}
+}
+
+func TestMTASTS(t *testing.T) {
+	table := []struct {
+		name                    string
+		record                  string
+		policy                  string
+		contentType             string
+		redirect                bool
+		expectedDidPass         DidPass
+		expectedErrors          []string
+		expectedRecommendations []string
+	}{
+		{
+			name:            "enforce",
+			record:          "v=STSv1; id=20240101T000000;",
+			policy:          "version: STSv1\r\nmode: enforce\r\nmx: mail.example.test\r\nmx: *.mx.example.test\r\nmax_age: 604800\r\n",
+			expectedDidPass: Success,
+		},
+		{
+			name:                    "testing",
+			record:                  "v=STSv1; id=1",
+			policy:                  "version: STSv1\nmode: testing\nmx: mail.example.test\nmx: *.mx.example.test\nmax_age: 86400\n",
+			expectedDidPass:         Success,
+			expectedRecommendations: []string{MTASTSTestingMode, MTASTSShortMaxAge},
+		},
+		{
+			name:            "mx not covered",
+			record:          "v=STSv1; id=1",
+			policy:          "version: STSv1\nmode: enforce\nmx: mail.example.test\nmax_age: 604800\n",
+			expectedDidPass: Failure,
+			expectedErrors:  []string{MTASTSMXNotCovered},
+		},
+		{
+			name:            "mode none",
+			record:          "v=STSv1; id=1",
+			policy:          "version: STSv1\nmode: none\nmax_age: 604800\n",
+			expectedDidPass: Failure,
+			expectedErrors:  []string{MTASTSModeNone},
+		},
+		{
+			name:            "invalid id",
+			record:          "v=STSv1; id=not-valid",
+			expectedDidPass: Failure,
+			expectedErrors:  []string{MTASTSSyntaxError},
+		},
+		{
+			name:            "invalid policy",
+			record:          "v=STSv1; id=1",
+			policy:          "version: STSv1\nmode: enforce\nmx: mail.example.test\n",
+			expectedDidPass: Failure,
+			expectedErrors:  []string{MTASTSPolicySyntaxError},
+		},
+		{
+			name:            "wrong content type",
+			record:          "v=STSv1; id=1",
+			policy:          "version: STSv1\nmode: enforce\nmx: mail.example.test\nmax_age: 604800\n",
+			contentType:     "text/html",
+			expectedDidPass: Failure,
+			expectedErrors:  []string{MTASTSPolicyInvalidContentType},
+		},
+		{
+			name:            "redirect",
+			record:          "v=STSv1; id=1",
+			redirect:        true,
+			expectedDidPass: Failure,
+			expectedErrors:  []string{MTASTSPolicyRedirect},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Host != "mta-sts.example.test" || r.URL.Path != "/.well-known/mta-sts.txt" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				if test.redirect {
+					http.Redirect(w, r, "https://mta-sts.example.test/policy.txt", http.StatusMovedPermanently)
+					return
+				}
+				contentType := test.contentType
+				if contentType == "" {
+					contentType = "text/plain; charset=utf-8"
+				}
+				w.Header().Set("Content-Type", contentType)
+				w.Write([]byte(test.policy)) // nolint // the test fails, if the response is missing
+			}))
+			defer server.Close()
+
+			records := testTXTRecords(t, map[string][]string{"_mta-sts.example.test": {test.record}})
+			for _, mx := range []string{"mail.example.test.", "a.mx.example.test."} {
+				records["example.test./MX"] = append(records["example.test./MX"], &dns.MX{
+					Hdr: dns.RR_Header{Name: "example.test.", Rrtype: dns.TypeMX, Class: dns.ClassINET, Ttl: 3600},
+					Mx:  mx,
+				})
+			}
+			d := domainAnalyzer{
+				client:   new(dns.Client),
+				resolver: startTestResolver(t, records, nil),
+			}
+			target, _ := url.Parse("https://www.example.test")
+			actual := d.mtaSTS(context.Background(), Target{URL: target, Options: TargetScanOptions{
+				HttpClient: httpclient.NewRedirectAwareHttpClient(&http.Transport{
+					// every connection is sent to the test server
+					DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+						return new(net.Dialer).DialContext(ctx, network, server.Listener.Addr().String())
+					},
+					TLSClientConfig: &tls.Config{
+						InsecureSkipVerify: true, // nolint
+					},
+				}),
+			}})
+
+			if test.expectedDidPass == Success && !actual.IsSuccess() || test.expectedDidPass == Failure && !actual.IsError() {
+				t.Fatalf("Expected %v, got %+v", *test.expectedDidPass, actual)
+			}
+			if len(actual.Errors) != len(test.expectedErrors) || !utils.IncludesSubset(actual.Errors, test.expectedErrors) {
+				t.Errorf("Expected errors %v, got %v", test.expectedErrors, actual.Errors)
+			}
+			if len(actual.Recommendations) != len(test.expectedRecommendations) || !utils.IncludesSubset(actual.Recommendations, test.expectedRecommendations) {
+				t.Errorf("Expected recommendations %v, got %v", test.expectedRecommendations, actual.Recommendations)
+			}
+		})
+	}
+}
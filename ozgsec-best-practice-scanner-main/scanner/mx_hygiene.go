@@ -0,0 +1,263 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/concurrency"
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+const (
+	MXNullMXWithOtherRecords = "mxNullMxWithOtherRecords"
+	MXIPLiteral              = "mxIpLiteral"
+	MXPointsToCNAME          = "mxPointsToCname"
+	MXMissingAddress         = "mxMissingAddress"
+	MXMissingReverseDNS      = "mxMissingReverseDns"
+	MXReverseDNSMismatch     = "mxReverseDnsMismatch"
+
+	MXBannerMismatch = "mxBannerMismatch"
+)
+
+const smtpBannerTimeout = 5 * time.Second
+
+type mxHost struct {
+	Host       string `json:"host"`
+	Preference uint16 `json:"preference"`
+	// the target of the CNAME record, if the mx host is an alias
+	CNAME string   `json:"cname,omitempty"`
+	IPs   []string `json:"ips"`
+	// the PTR names of every ip
+	ReverseDNS map[string][]string `json:"reverseDns"`
+	// the hostname announced in the SMTP greeting - empty, if the server was not reachable
+	BannerHostname  string   `json:"bannerHostname,omitempty"`
+	Errors          []string `json:"errors"`
+	Recommendations []string `json:"recommendations"`
+}
+
+func normalizeHostname(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
+
+// returns the A and AAAA records of the host and the CNAME target, if the host is an alias
+func (d domainAnalyzer) addresses(ctx context.Context, host string) ([]net.IP, string, error) {
+	ips := make([]net.IP, 0)
+	cname := ""
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		msg, err := d.exchange(ctx, host, qtype)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, answer := range msg.Answer {
+			switch rr := answer.(type) {
+			case *dns.A:
+				ips = append(ips, rr.A)
+			case *dns.AAAA:
+				ips = append(ips, rr.AAAA)
+			case *dns.CNAME:
+				if normalizeHostname(rr.Hdr.Name) == normalizeHostname(host) {
+					cname = normalizeHostname(rr.Target)
+				}
+			}
+		}
+	}
+	return ips, cname, nil
+}
+
+// returns the PTR names of the ip
+func (d domainAnalyzer) reverseDNS(ctx context.Context, ip net.IP) ([]string, error) {
+	reverse, err := dns.ReverseAddr(ip.String())
+	if err != nil {
+		return nil, err
+	}
+	msg, err := d.exchange(ctx, reverse, dns.TypePTR)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	for _, answer := range msg.Answer {
+		if ptr, ok := answer.(*dns.PTR); ok {
+			names = append(names, normalizeHostname(ptr.Ptr))
+		}
+	}
+	return names, nil
+}
+
+// checks, if one of the PTR names resolves back to the ip (forward-confirmed reverse DNS)
+func (d domainAnalyzer) forwardConfirmed(ctx context.Context, ip net.IP, names []string) (bool, error) {
+	for _, name := range names {
+		ips, _, err := d.addresses(ctx, name)
+		if err != nil {
+			return false, err
+		}
+		if utils.Some(ips, ip.Equal) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// reads the SMTP greeting and returns the announced hostname (RFC5321 Section 4.2)
+func smtpBanner(ctx context.Context, address string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, smtpBannerTimeout)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline) // nolint // the read fails anyway, if the deadline could not be set
+
+	text := textproto.NewConn(conn)
+	_, greeting, err := text.ReadResponse(220)
+	if err != nil {
+		return "", err
+	}
+	text.PrintfLine("QUIT") // nolint // the connection is closed anyway
+	fields := strings.Fields(greeting)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty smtp greeting")
+	}
+	return normalizeHostname(fields[0]), nil
+}
+
+func (d domainAnalyzer) checkMXHost(ctx context.Context, mx *dns.MX) mxHost {
+	host := mxHost{
+		Host:            normalizeHostname(mx.Mx),
+		Preference:      mx.Preference,
+		IPs:             make([]string, 0),
+		ReverseDNS:      make(map[string][]string),
+		Errors:          make([]string, 0),
+		Recommendations: make([]string, 0),
+	}
+	// the mx record needs to contain a hostname (RFC5321 Section 5.1)
+	if net.ParseIP(strings.Trim(host.Host, "[]")) != nil {
+		host.Errors = append(host.Errors, MXIPLiteral)
+		return host
+	}
+
+	ips, cname, err := d.addresses(ctx, host.Host)
+	if err != nil {
+		return host
+	}
+	// the mx host must not be an alias (RFC2181 Section 10.3)
+	if cname != "" {
+		host.CNAME = cname
+		host.Errors = append(host.Errors, MXPointsToCNAME)
+	}
+	if len(ips) == 0 {
+		host.Errors = append(host.Errors, MXMissingAddress)
+		return host
+	}
+
+	validNames := []string{host.Host}
+	for _, ip := range ips {
+		host.IPs = append(host.IPs, ip.String())
+		names, err := d.reverseDNS(ctx, ip)
+		if err != nil {
+			continue
+		}
+		host.ReverseDNS[ip.String()] = names
+		if len(names) == 0 {
+			if !utils.Includes(host.Errors, MXMissingReverseDNS) {
+				host.Errors = append(host.Errors, MXMissingReverseDNS)
+			}
+			continue
+		}
+		confirmed, err := d.forwardConfirmed(ctx, ip, names)
+		if err == nil && !confirmed && !utils.Includes(host.Errors, MXReverseDNSMismatch) {
+			host.Errors = append(host.Errors, MXReverseDNSMismatch)
+		}
+		validNames = append(validNames, names...)
+	}
+
+	// the greeting should contain the hostname of the server - either the mx host or the reverse dns name
+	banner, err := smtpBanner(ctx, net.JoinHostPort(ips[0].String(), "25"))
+	if err == nil {
+		host.BannerHostname = banner
+		if !utils.Includes(validNames, banner) {
+			host.Recommendations = append(host.Recommendations, MXBannerMismatch)
+		}
+	}
+	return host
+}
+
+/*
+REQUIRED: The MX records point to hostnames with A or AAAA records - not to IP literals or CNAMEs (RFC5321 Section 5.1, RFC2181 Section 10.3)
+REQUIRED: Every IP of the MX hosts has a forward-confirmed reverse DNS name (PTR)
+REQUIRED: A null MX (RFC7505) is the only MX record of the domain
+
+	A null MX ("0 .") is a valid configuration of a domain, which does not accept mail.
+
+RECOMMENDED: The hostname of the SMTP greeting matches the MX host or its reverse DNS name
+
+Source: https://www.rfc-editor.org/rfc/rfc5321, https://www.rfc-editor.org/rfc/rfc7505
+*/
+func (d domainAnalyzer) mxHygiene(ctx context.Context, target Target) AnalysisResult {
+	start := time.Now()
+	domain := mailDomain(target)
+
+	msg, err := d.exchange(ctx, domain, dns.TypeMX)
+	if err != nil || (msg.Rcode != dns.RcodeSuccess && msg.Rcode != dns.RcodeNameError) {
+		return NewAnalysisResult(Unknown, nil, nil, nil, time.Since(start))
+	}
+	mxRecords := make([]*dns.MX, 0)
+	for _, answer := range msg.Answer {
+		if mx, ok := answer.(*dns.MX); ok {
+			mxRecords = append(mxRecords, mx)
+		}
+	}
+	if len(mxRecords) == 0 {
+		// the domain does not receive mail using mx records
+		return NewAnalysisResult(Unknown, nil, nil, nil, time.Since(start))
+	}
+
+	if utils.Some(mxRecords, func(mx *dns.MX) bool { return mx.Mx == "." }) {
+		if len(mxRecords) > 1 {
+			return NewAnalysisResult(Failure, map[string]any{
+				"nullMx": true,
+			}, []string{MXNullMXWithOtherRecords}, nil, time.Since(start))
+		}
+		return NewAnalysisResult(Success, map[string]any{
+			"nullMx": true,
+		}, nil, nil, time.Since(start))
+	}
+
+	hosts := concurrency.All(utils.Map(mxRecords, func(mx *dns.MX) func() mxHost {
+		return func() mxHost {
+			return d.checkMXHost(ctx, mx)
+		}
+	})...)
+
+	errors := make([]string, 0)
+	recommendations := make([]string, 0)
+	for _, host := range hosts {
+		for _, hostError := range host.Errors {
+			if !utils.Includes(errors, hostError) {
+				errors = append(errors, hostError)
+			}
+		}
+		for _, recommendation := range host.Recommendations {
+			if !utils.Includes(recommendations, recommendation) {
+				recommendations = append(recommendations, recommendation)
+			}
+		}
+	}
+
+	actualValue := map[string]any{
+		"nullMx": false,
+		"hosts":  hosts,
+	}
+	if len(errors) > 0 {
+		return NewAnalysisResult(Failure, actualValue, errors, recommendations, time.Since(start))
+	}
+	return NewAnalysisResult(Success, actualValue, nil, recommendations, time.Since(start))
+}
@@ -0,0 +1,137 @@
+package scanner
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+// builds the records of the test resolver from their presentation format
+func testRecords(t *testing.T, records ...string) map[string][]dns.RR {
+	t.Helper()
+	res := make(map[string][]dns.RR)
+	for _, record := range records {
+		rr := mustNewRR(t, record)
+		key := dns.Fqdn(rr.Header().Name) + "/" + dns.TypeToString[rr.Header().Rrtype]
+		res[key] = append(res[key], rr)
+	}
+	return res
+}
+
+func TestSMTPBanner(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("220-Mail.Example.Test ESMTP\r\n220 ready\r\n")) // nolint // the test fails, if the greeting is missing
+	}()
+
+	banner, err := smtpBanner(context.Background(), listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if banner != "mail.example.test" {
+		t.Errorf("Expected mail.example.test, got %s", banner)
+	}
+}
+
+func TestMXHygiene(t *testing.T) {
+	valid := []string{
+		"mail.example.test. 3600 IN A 127.0.0.1",
+		"1.0.0.127.in-addr.arpa. 3600 IN PTR mail.example.test.",
+	}
+
+	table := []struct {
+		name            string
+		records         map[string][]dns.RR
+		expectedDidPass DidPass
+		expectedErrors  []string
+	}{
+		{
+			name:            "valid",
+			records:         testRecords(t, append(valid, "example.test. 3600 IN MX 10 mail.example.test.")...),
+			expectedDidPass: Success,
+		},
+		{
+			name:            "null mx",
+			records:         testRecords(t, "example.test. 3600 IN MX 0 ."),
+			expectedDidPass: Success,
+		},
+		{
+			name:            "null mx with other records",
+			records:         testRecords(t, append(valid, "example.test. 3600 IN MX 0 .", "example.test. 3600 IN MX 10 mail.example.test.")...),
+			expectedDidPass: Failure,
+			expectedErrors:  []string{MXNullMXWithOtherRecords},
+		},
+		{
+			name:            "ip literal",
+			records:         testRecords(t, append(valid, "example.test. 3600 IN MX 10 mail.example.test.", "example.test. 3600 IN MX 20 192.0.2.1.")...),
+			expectedDidPass: Failure,
+			expectedErrors:  []string{MXIPLiteral},
+		},
+		{
+			name:            "missing address",
+			records:         testRecords(t, "example.test. 3600 IN MX 10 missing.example.test."),
+			expectedDidPass: Failure,
+			expectedErrors:  []string{MXMissingAddress},
+		},
+		{
+			name:            "missing reverse dns",
+			records:         testRecords(t, "example.test. 3600 IN MX 10 mail.example.test.", "mail.example.test. 3600 IN A 127.0.0.1"),
+			expectedDidPass: Failure,
+			expectedErrors:  []string{MXMissingReverseDNS},
+		},
+		{
+			name: "reverse dns mismatch",
+			records: testRecords(t,
+				"example.test. 3600 IN MX 10 mail.example.test.",
+				"mail.example.test. 3600 IN A 127.0.0.1",
+				"1.0.0.127.in-addr.arpa. 3600 IN PTR other.example.test.",
+				"other.example.test. 3600 IN A 127.0.0.2",
+			),
+			expectedDidPass: Failure,
+			expectedErrors:  []string{MXReverseDNSMismatch},
+		},
+		{
+			name: "cname",
+			records: utils.Merge(testRecords(t, append(valid, "example.test. 3600 IN MX 10 alias.example.test.")...), map[string][]dns.RR{
+				"alias.example.test./A": {
+					mustNewRR(t, "alias.example.test. 3600 IN CNAME mail.example.test."),
+					mustNewRR(t, "mail.example.test. 3600 IN A 127.0.0.1"),
+				},
+			}),
+			expectedDidPass: Failure,
+			expectedErrors:  []string{MXPointsToCNAME},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			d := domainAnalyzer{
+				client:   new(dns.Client),
+				resolver: startTestResolver(t, test.records, nil),
+			}
+			target, _ := url.Parse("https://www.example.test")
+			actual := d.mxHygiene(context.Background(), Target{URL: target})
+
+			if test.expectedDidPass == Success && !actual.IsSuccess() || test.expectedDidPass == Failure && !actual.IsError() {
+				t.Fatalf("Expected %v, got %+v", *test.expectedDidPass, actual)
+			}
+			if len(actual.Errors) != len(test.expectedErrors) || !utils.IncludesSubset(actual.Errors, test.expectedErrors) {
+				t.Errorf("Expected errors %v, got %v", test.expectedErrors, actual.Errors)
+			}
+		})
+	}
+}
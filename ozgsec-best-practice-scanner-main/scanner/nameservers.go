@@ -0,0 +1,351 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/concurrency"
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+const (
+	NSLameDelegation          = "nsLameDelegation"
+	NSSerialMismatch          = "nsSerialMismatch"
+	NSOpenRecursion           = "nsOpenRecursion"
+	NSZoneTransferAllowed     = "nsZoneTransferAllowed"
+	NSTooFewNameservers       = "nsTooFewNameservers"
+	NSMissingNetworkDiversity = "nsMissingNetworkDiversity"
+)
+
+const (
+	nameserverTimeout = 5 * time.Second
+	// a zone needs to be served by at least two nameservers (RFC1034 Section 4.1, RFC2182 Section 5)
+	minNameservers = 2
+)
+
+// names, which are used to probe for open recursion - the first name outside of the scanned zone is used
+var recursionProbeNames = []string{"www.iana.org.", "www.example.com."}
+
+type nameserverAddress struct {
+	IP  string `json:"ip"`
+	ASN string `json:"asn,omitempty"`
+	// true, if the nameserver answered authoritatively for the zone
+	Authoritative bool    `json:"authoritative"`
+	Serial        *uint32 `json:"serial,omitempty"`
+	// true, if the scanner could not connect to the address at all (e.g. missing IPv6 connectivity of the scanner)
+	Unreachable bool `json:"unreachable"`
+	// the reason, why the nameserver is considered lame
+	Error string `json:"error,omitempty"`
+}
+
+type nameserverHost struct {
+	Host      string              `json:"host"`
+	Addresses []nameserverAddress `json:"addresses"`
+}
+
+// the result of the active probes of a single nameserver address
+type nameserverProbe struct {
+	Host          string `json:"host"`
+	IP            string `json:"ip"`
+	OpenRecursion bool   `json:"openRecursion"`
+	ZoneTransfer  bool   `json:"zoneTransfer"`
+}
+
+// returns the zone, which contains the hostname, and its NS records.
+// the zone cut is found by climbing the dns tree until a NS record set is found.
+func (d domainAnalyzer) zoneNameservers(ctx context.Context, target Target) (string, []string, error) {
+	for _, domain := range getAllSubdomainsFromTarget(target) {
+		msg, err := d.exchange(ctx, domain, dns.TypeNS)
+		if err != nil {
+			return "", nil, err
+		}
+		hosts := make([]string, 0)
+		for _, answer := range msg.Answer {
+			// a NS record of an alias target does not describe a zone cut at the domain
+			if ns, ok := answer.(*dns.NS); ok && normalizeHostname(ns.Hdr.Name) == normalizeHostname(domain) {
+				hosts = append(hosts, normalizeHostname(ns.Ns))
+			}
+		}
+		if len(hosts) > 0 {
+			return normalizeHostname(domain), hosts, nil
+		}
+	}
+	return "", nil, nil
+}
+
+// returns the autonomous system number, which announces the ip, using the team cymru ip to asn mapping
+func (d domainAnalyzer) asn(ctx context.Context, ip net.IP) string {
+	reverse, err := dns.ReverseAddr(ip.String())
+	if err != nil {
+		return ""
+	}
+	name := strings.TrimSuffix(reverse, "in-addr.arpa.") + "origin.asn.cymru.com."
+	if ip.To4() == nil {
+		name = strings.TrimSuffix(reverse, "ip6.arpa.") + "origin6.asn.cymru.com."
+	}
+	msg, err := d.exchange(ctx, name, dns.TypeTXT)
+	if err != nil {
+		return ""
+	}
+	for _, answer := range msg.Answer {
+		// Format: "<asn> | <prefix> | <country> | <registry> | <allocation date>"
+		if txt, ok := answer.(*dns.TXT); ok && len(txt.Txt) > 0 {
+			fields := strings.Fields(strings.Split(strings.Join(txt.Txt, ""), "|")[0])
+			if len(fields) > 0 {
+				return fields[0]
+			}
+		}
+	}
+	return ""
+}
+
+// queries the nameserver directly instead of using the recursive resolver
+func (d domainAnalyzer) queryNameserver(ctx context.Context, address string, name string, qtype uint16, recursionDesired bool) (*dns.Msg, error) {
+	ctx, cancel := context.WithTimeout(ctx, nameserverTimeout)
+	defer cancel()
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	m.RecursionDesired = recursionDesired
+	msg, _, err := d.client.ExchangeContext(ctx, m, address)
+	return msg, err
+}
+
+// returns true, if the nameserver transfers the zone to anyone (RFC5936 Section 4)
+func zoneTransferAllowed(ctx context.Context, address string, zone string) bool {
+	ctx, cancel := context.WithTimeout(ctx, nameserverTimeout)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return false
+	}
+	// the transfer does not support a context - closing the connection aborts it
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	transfer := &dns.Transfer{Conn: &dns.Conn{Conn: conn}, ReadTimeout: nameserverTimeout, WriteTimeout: nameserverTimeout}
+	m := new(dns.Msg)
+	m.SetAxfr(dns.Fqdn(zone))
+	envelopes, err := transfer.In(m, address)
+	if err != nil {
+		conn.Close()
+		return false
+	}
+	allowed := false
+	// the channel needs to be drained - otherwise the transfer is not closed
+	for envelope := range envelopes {
+		if envelope.Error == nil && len(envelope.RR) > 0 {
+			allowed = true
+		}
+	}
+	return allowed
+}
+
+// checks a single address of a nameserver (address including the port)
+func (d domainAnalyzer) checkNameserverAddress(ctx context.Context, address string, zone string) nameserverAddress {
+	res := nameserverAddress{}
+
+	msg, err := d.queryNameserver(ctx, address, zone, dns.TypeSOA, false)
+	switch {
+	case err != nil:
+		var opErr *net.OpError
+		res.Unreachable = errors.As(err, &opErr) && opErr.Op == "dial"
+		res.Error = err.Error()
+	case msg.Rcode != dns.RcodeSuccess:
+		res.Error = dns.RcodeToString[msg.Rcode]
+	case !msg.Authoritative:
+		res.Error = "not authoritative"
+	default:
+		for _, answer := range msg.Answer {
+			if soa, ok := answer.(*dns.SOA); ok && normalizeHostname(soa.Hdr.Name) == zone {
+				res.Authoritative = true
+				res.Serial = &soa.Serial
+			}
+		}
+		if !res.Authoritative {
+			res.Error = "missing SOA record"
+		}
+	}
+	return res
+}
+
+// sends a recursive query for a name of another zone and requests a zone transfer.
+// both requests are flagged as attack traffic by some providers - the probes are only done, if nameserverProbes is enabled.
+func (d domainAnalyzer) probeNameserverAddress(ctx context.Context, address string, zone string) nameserverProbe {
+	res := nameserverProbe{}
+	// an authoritative nameserver should not resolve names of other zones (RFC5358)
+	probe := utils.Filter(recursionProbeNames, func(name string) bool { return !dns.IsSubDomain(dns.Fqdn(zone), name) })[0]
+	msg, err := d.queryNameserver(ctx, address, probe, dns.TypeA, true)
+	res.OpenRecursion = err == nil && msg.RecursionAvailable && msg.Rcode == dns.RcodeSuccess && len(msg.Answer) > 0
+
+	res.ZoneTransfer = zoneTransferAllowed(ctx, address, zone)
+	return res
+}
+
+func (d domainAnalyzer) checkNameserverHost(ctx context.Context, host string, zone string) nameserverHost {
+	res := nameserverHost{Host: host, Addresses: make([]nameserverAddress, 0)}
+	ips, _, err := d.addresses(ctx, host)
+	if err != nil {
+		return res
+	}
+	res.Addresses = concurrency.All(utils.Map(ips, func(ip net.IP) func() nameserverAddress {
+		return func() nameserverAddress {
+			address := d.checkNameserverAddress(ctx, net.JoinHostPort(ip.String(), "53"), zone)
+			address.IP = ip.String()
+			address.ASN = d.asn(ctx, ip)
+			return address
+		}
+	})...)
+	return res
+}
+
+// returns the network prefix of the ip - /24 for IPv4 and /48 for IPv6
+func networkPrefix(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String() + "/48"
+}
+
+func nameserverErrors(hosts []nameserverHost) []string {
+	errors := make([]string, 0)
+	if len(hosts) < minNameservers {
+		errors = append(errors, NSTooFewNameservers)
+	}
+
+	addresses := make([]nameserverAddress, 0)
+	for _, host := range hosts {
+		addresses = append(addresses, host.Addresses...)
+	}
+	if len(addresses) == 0 {
+		return append(errors, NSLameDelegation)
+	}
+
+	// every nameserver needs to be reachable and authoritative for the zone
+	if utils.Some(hosts, func(host nameserverHost) bool {
+		return len(host.Addresses) == 0 || utils.Some(host.Addresses, func(address nameserverAddress) bool { return !address.Authoritative && !address.Unreachable })
+	}) {
+		errors = append(errors, NSLameDelegation)
+	}
+
+	serials := make([]uint32, 0)
+	for _, address := range addresses {
+		if address.Serial != nil && !utils.Includes(serials, *address.Serial) {
+			serials = append(serials, *address.Serial)
+		}
+	}
+	if len(serials) > 1 {
+		errors = append(errors, NSSerialMismatch)
+	}
+
+	// the nameservers should not share a single point of failure (RFC2182 Section 3.1)
+	prefixes := make([]string, 0)
+	asns := make([]string, 0)
+	for _, address := range addresses {
+		if prefix := networkPrefix(net.ParseIP(address.IP)); !utils.Includes(prefixes, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+		if address.ASN != "" && !utils.Includes(asns, address.ASN) {
+			asns = append(asns, address.ASN)
+		}
+	}
+	// the asn check is skipped, if the asn of an address is not known
+	asnKnown := utils.Every(addresses, func(address nameserverAddress) bool { return address.ASN != "" })
+	if len(prefixes) < 2 || (asnKnown && len(asns) < 2) {
+		errors = append(errors, NSMissingNetworkDiversity)
+	}
+	return errors
+}
+
+/*
+REQUIRED: The zone is served by at least two nameservers (RFC1034 Section 4.1, RFC2182 Section 5)
+REQUIRED: Every nameserver answers authoritatively for the zone - no lame delegation (RFC1912 Section 2.8)
+REQUIRED: Every nameserver serves the same SOA serial
+REQUIRED: The nameservers are not located in a single /24 (/48 for IPv6) network or a single autonomous system (RFC2182 Section 3.1)
+
+	The nameservers are queried directly - the zone is the closest enclosing zone of the hostname.
+	Open recursion and zone transfers are probed by the opt-in check nameserverProbes.
+
+Source: https://www.rfc-editor.org/rfc/rfc2182, https://www.rfc-editor.org/rfc/rfc1912, https://www.rfc-editor.org/rfc/rfc5358
+*/
+func (d domainAnalyzer) nameservers(ctx context.Context, target Target) AnalysisResult {
+	start := time.Now()
+	zone, hostnames, err := d.zoneNameservers(ctx, target)
+	if err != nil || len(hostnames) == 0 {
+		return NewAnalysisResult(Unknown, nil, nil, nil, time.Since(start))
+	}
+
+	hosts := concurrency.All(utils.Map(hostnames, func(host string) func() nameserverHost {
+		return func() nameserverHost {
+			return d.checkNameserverHost(ctx, host, zone)
+		}
+	})...)
+
+	actualValue := map[string]any{
+		"zone":        zone,
+		"nameservers": hosts,
+	}
+	errors := nameserverErrors(hosts)
+	if len(errors) > 0 {
+		return NewAnalysisResult(Failure, actualValue, errors, nil, time.Since(start))
+	}
+	return NewAnalysisResult(Success, actualValue, nil, nil, time.Since(start))
+}
+
+/*
+REQUIRED: The nameservers do not resolve names of other zones - no open recursion (RFC5358)
+REQUIRED: The nameservers do not allow zone transfers (AXFR) to anyone (RFC5936 Section 6)
+
+	Every address of every nameserver of the zone receives a recursive query for a name of another zone and an AXFR request.
+	Providers flag these requests as attack traffic - the check is not part of AllChecks and needs to be enabled explicitly.
+
+Source: https://www.rfc-editor.org/rfc/rfc5358, https://www.rfc-editor.org/rfc/rfc5936
+*/
+func (d domainAnalyzer) nameserverProbes(ctx context.Context, target Target) AnalysisResult {
+	start := time.Now()
+	zone, hostnames, err := d.zoneNameservers(ctx, target)
+	if err != nil || len(hostnames) == 0 {
+		return NewAnalysisResult(Unknown, nil, nil, nil, time.Since(start))
+	}
+
+	probes := make([]nameserverProbe, 0)
+	for _, hostProbes := range concurrency.All(utils.Map(hostnames, func(host string) func() []nameserverProbe {
+		return func() []nameserverProbe {
+			ips, _, err := d.addresses(ctx, host)
+			if err != nil {
+				return nil
+			}
+			return concurrency.All(utils.Map(ips, func(ip net.IP) func() nameserverProbe {
+				return func() nameserverProbe {
+					probe := d.probeNameserverAddress(ctx, net.JoinHostPort(ip.String(), "53"), zone)
+					probe.Host = host
+					probe.IP = ip.String()
+					return probe
+				}
+			})...)
+		}
+	})...) {
+		probes = append(probes, hostProbes...)
+	}
+
+	actualValue := map[string]any{
+		"zone":   zone,
+		"probes": probes,
+	}
+	errors := make([]string, 0)
+	if utils.Some(probes, func(probe nameserverProbe) bool { return probe.OpenRecursion }) {
+		errors = append(errors, NSOpenRecursion)
+	}
+	if utils.Some(probes, func(probe nameserverProbe) bool { return probe.ZoneTransfer }) {
+		errors = append(errors, NSZoneTransferAllowed)
+	}
+	if len(errors) > 0 {
+		return NewAnalysisResult(Failure, actualValue, errors, nil, time.Since(start))
+	}
+	return NewAnalysisResult(Success, actualValue, nil, nil, time.Since(start))
+}
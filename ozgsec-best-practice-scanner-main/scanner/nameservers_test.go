@@ -0,0 +1,209 @@
+package scanner
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+type testNameserver struct {
+	serial        uint32
+	authoritative bool
+	recursion     bool
+	zoneTransfer  bool
+}
+
+// starts an udp and tcp nameserver for the zone example.test. on the same port
+func startTestNameserver(t *testing.T, ns testNameserver) string {
+	t.Helper()
+	soa := mustNewRR(t, "example.test. 3600 IN SOA ns1.example.test. hostmaster.example.test. 1 7200 3600 1209600 3600").(*dns.SOA)
+	soa.Serial = ns.serial
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		question := r.Question[0]
+		switch {
+		case question.Qtype == dns.TypeAXFR:
+			if !ns.zoneTransfer {
+				m.Rcode = dns.RcodeRefused
+			} else {
+				m.Answer = []dns.RR{soa, mustNewRR(t, "www.example.test. 3600 IN A 127.0.0.1"), soa}
+			}
+		case question.Name == "example.test." && question.Qtype == dns.TypeSOA:
+			m.Authoritative = ns.authoritative
+			m.Answer = []dns.RR{soa}
+		case r.RecursionDesired && ns.recursion:
+			m.RecursionAvailable = true
+			m.Answer = []dns.RR{mustNewRR(t, question.Name+" 3600 IN A 192.0.2.1")}
+		default:
+			m.Rcode = dns.RcodeRefused
+		}
+		w.WriteMsg(m) // nolint // the test fails, if the response is missing
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.ListenPacket("udp", listener.Addr().String())
+	if err != nil {
+		listener.Close()
+		t.Skip("could not listen on the same udp port:", err)
+	}
+	for _, server := range []*dns.Server{{Listener: listener, Handler: handler}, {PacketConn: conn, Handler: handler}} {
+		started := make(chan struct{})
+		server.NotifyStartedFunc = func() { close(started) }
+		go server.ActivateAndServe() // nolint // the server is shut down after the test
+		<-started
+		t.Cleanup(func() { server.Shutdown() }) // nolint // the test is over anyway
+	}
+	return listener.Addr().String()
+}
+
+func TestCheckNameserverAddress(t *testing.T) {
+	table := []struct {
+		name                  string
+		nameserver            testNameserver
+		expectedAuthoritative bool
+	}{
+		{"valid", testNameserver{serial: 1, authoritative: true}, true},
+		{"lame", testNameserver{serial: 1}, false},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			d := domainAnalyzer{client: new(dns.Client)}
+			actual := d.checkNameserverAddress(context.Background(), startTestNameserver(t, test.nameserver), "example.test")
+
+			if actual.Authoritative != test.expectedAuthoritative {
+				t.Errorf("Expected authoritative to be %v, got %+v", test.expectedAuthoritative, actual)
+			}
+			if actual.Authoritative && (actual.Serial == nil || *actual.Serial != test.nameserver.serial) {
+				t.Errorf("Expected serial %d, got %+v", test.nameserver.serial, actual.Serial)
+			}
+		})
+	}
+}
+
+func TestProbeNameserverAddress(t *testing.T) {
+	table := []struct {
+		name                 string
+		nameserver           testNameserver
+		expectedRecursion    bool
+		expectedZoneTransfer bool
+	}{
+		{"valid", testNameserver{serial: 1, authoritative: true}, false, false},
+		{"open recursion", testNameserver{serial: 1, authoritative: true, recursion: true}, true, false},
+		{"zone transfer", testNameserver{serial: 1, authoritative: true, zoneTransfer: true}, false, true},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			d := domainAnalyzer{client: new(dns.Client)}
+			actual := d.probeNameserverAddress(context.Background(), startTestNameserver(t, test.nameserver), "example.test")
+
+			if actual.OpenRecursion != test.expectedRecursion {
+				t.Errorf("Expected open recursion to be %v, got %v", test.expectedRecursion, actual.OpenRecursion)
+			}
+			if actual.ZoneTransfer != test.expectedZoneTransfer {
+				t.Errorf("Expected zone transfer to be %v, got %v", test.expectedZoneTransfer, actual.ZoneTransfer)
+			}
+		})
+	}
+}
+
+func TestZoneTransferAllowedCancelled(t *testing.T) {
+	// the listener accepts the connection but never answers
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if zoneTransferAllowed(ctx, listener.Addr().String(), "example.test") {
+		t.Error("Expected no zone transfer")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the zone transfer to be aborted with the context, took %v", elapsed)
+	}
+}
+
+func TestNameserverErrors(t *testing.T) {
+	address := func(ip string, asn string, serial uint32) nameserverAddress {
+		return nameserverAddress{IP: ip, ASN: asn, Authoritative: true, Serial: &serial}
+	}
+	valid := []nameserverHost{
+		{Host: "ns1.example.test", Addresses: []nameserverAddress{address("192.0.2.1", "64496", 1)}},
+		{Host: "ns2.example.test", Addresses: []nameserverAddress{address("198.51.100.1", "64497", 1), address("2001:db8::1", "64497", 1)}},
+	}
+
+	table := []struct {
+		name           string
+		hosts          []nameserverHost
+		expectedErrors []string
+	}{
+		{"valid", valid, []string{}},
+		{"single nameserver", valid[:1], []string{NSTooFewNameservers, NSMissingNetworkDiversity}},
+		{"no addresses", []nameserverHost{{Host: "ns1.example.test"}, {Host: "ns2.example.test"}}, []string{NSLameDelegation}},
+		{"lame", append([]nameserverHost{{Host: "ns3.example.test", Addresses: []nameserverAddress{{IP: "203.0.113.1", ASN: "64498"}}}}, valid...), []string{NSLameDelegation}},
+		{"unreachable", append([]nameserverHost{{Host: "ns3.example.test", Addresses: []nameserverAddress{{IP: "2001:db8:1::1", ASN: "64498", Unreachable: true}}}}, valid...), []string{}},
+		{"serial mismatch", []nameserverHost{valid[0], {Host: "ns2.example.test", Addresses: []nameserverAddress{address("198.51.100.1", "64497", 2)}}}, []string{NSSerialMismatch}},
+		{"same network", []nameserverHost{valid[0], {Host: "ns2.example.test", Addresses: []nameserverAddress{address("192.0.2.2", "64497", 1)}}}, []string{NSMissingNetworkDiversity}},
+		{"same asn", []nameserverHost{valid[0], {Host: "ns2.example.test", Addresses: []nameserverAddress{address("198.51.100.1", "64496", 1)}}}, []string{NSMissingNetworkDiversity}},
+		{"unknown asn", []nameserverHost{valid[0], {Host: "ns2.example.test", Addresses: []nameserverAddress{address("198.51.100.1", "", 1)}}}, []string{}},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			actual := nameserverErrors(test.hosts)
+			if len(actual) != len(test.expectedErrors) || !utils.IncludesSubset(actual, test.expectedErrors) {
+				t.Errorf("Expected errors %v, got %v", test.expectedErrors, actual)
+			}
+		})
+	}
+}
+
+func TestZoneNameservers(t *testing.T) {
+	d := domainAnalyzer{
+		client: new(dns.Client),
+		resolver: startTestResolver(t, testRecords(t,
+			"example.test. 3600 IN NS ns1.example.test.",
+			"example.test. 3600 IN NS ns2.example.net.",
+		), nil),
+	}
+	target, _ := url.Parse("https://www.example.test")
+	zone, hosts, err := d.zoneNameservers(context.Background(), Target{URL: target})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zone != "example.test" {
+		t.Errorf("Expected zone example.test, got %s", zone)
+	}
+	if len(hosts) != 2 || !utils.IncludesSubset(hosts, []string{"ns1.example.test", "ns2.example.net"}) {
+		t.Errorf("Expected ns1.example.test and ns2.example.net, got %v", hosts)
+	}
+}
+
+func TestASN(t *testing.T) {
+	d := domainAnalyzer{
+		client: new(dns.Client),
+		resolver: startTestResolver(t, testRecords(t,
+			`1.2.0.192.origin.asn.cymru.com. 3600 IN TXT "64496 | 192.0.2.0/24 | DE | ripencc | 2010-01-01"`,
+		), nil),
+	}
+	if actual := d.asn(context.Background(), net.ParseIP("192.0.2.1")); actual != "64496" {
+		t.Errorf("Expected 64496, got %s", actual)
+	}
+	if actual := d.asn(context.Background(), net.ParseIP("198.51.100.1")); actual != "" {
+		t.Errorf("Expected an unknown asn, got %s", actual)
+	}
+}
@@ -0,0 +1,127 @@
+package scanner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// path to a public suffix list in the format of https://publicsuffix.org/list/public_suffix_list.dat.
+// if empty, the list bundled with golang.org/x/net/publicsuffix is used.
+var publicSuffixListPath = os.Getenv("PUBLIC_SUFFIX_LIST")
+
+type publicSuffixList interface {
+	// PublicSuffix returns the public suffix of the domain (e.g. "co.uk" for "www.example.co.uk")
+	PublicSuffix(domain string) string
+}
+
+var suffixList = loadPublicSuffixList(publicSuffixListPath)
+
+func loadPublicSuffixList(path string) publicSuffixList {
+	if path == "" {
+		return publicsuffix.List
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		slog.Error("could not load public suffix list - using the bundled list", "path", path, "err", err)
+		return publicsuffix.List
+	}
+	defer f.Close()
+	list, err := parsePublicSuffixList(f)
+	if err != nil {
+		slog.Error("could not parse public suffix list - using the bundled list", "path", path, "err", err)
+		return publicsuffix.List
+	}
+	return list
+}
+
+// the rules of a public suffix list (https://github.com/publicsuffix/list/wiki/Format)
+type publicSuffixRules struct {
+	rules      map[string]bool
+	wildcards  map[string]bool
+	exceptions map[string]bool
+}
+
+func parsePublicSuffixList(r io.Reader) (publicSuffixRules, error) {
+	list := publicSuffixRules{
+		rules:      make(map[string]bool),
+		wildcards:  make(map[string]bool),
+		exceptions: make(map[string]bool),
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// only the first field of a line is part of the rule
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "//") {
+			continue
+		}
+		rule, err := idna.ToASCII(strings.ToLower(fields[0]))
+		if err != nil {
+			return list, fmt.Errorf("invalid rule %q: %w", fields[0], err)
+		}
+		switch {
+		case strings.HasPrefix(rule, "!"):
+			list.exceptions[rule[1:]] = true
+		case strings.HasPrefix(rule, "*."):
+			list.wildcards[rule[2:]] = true
+		default:
+			list.rules[rule] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return list, err
+	}
+	if len(list.rules) == 0 {
+		return list, fmt.Errorf("the public suffix list does not contain any rule")
+	}
+	return list, nil
+}
+
+// returns the longest matching rule - an exception rule removes its leftmost label, the default rule is "*"
+func (l publicSuffixRules) PublicSuffix(domain string) string {
+	labels := strings.Split(domain, ".")
+	suffix := labels[len(labels)-1]
+	for i := len(labels) - 1; i >= 0; i-- {
+		name := strings.Join(labels[i:], ".")
+		if l.exceptions[name] {
+			return strings.Join(labels[i+1:], ".")
+		}
+		if l.rules[name] {
+			suffix = name
+		}
+		if i > 0 && l.wildcards[name] && !l.exceptions[strings.Join(labels[i-1:], ".")] {
+			suffix = strings.Join(labels[i-1:], ".")
+		}
+	}
+	return suffix
+}
+
+// returns the registrable domain (public suffix and one more label) of the domain.
+// if the domain is a public suffix itself or an ip, the domain is returned.
+func RegistrableDomain(domain string) string {
+	domain = normalizeHostname(domain)
+	if domain == "" || net.ParseIP(domain) != nil {
+		return domain
+	}
+	suffix := suffixList.PublicSuffix(domain)
+	if suffix == domain || !strings.HasSuffix(domain, "."+suffix) {
+		return domain
+	}
+	labels := strings.Split(strings.TrimSuffix(domain, "."+suffix), ".")
+	return labels[len(labels)-1] + "." + suffix
+}
+
+// returns the domain used by the mail checks - the registrable domain of the hostname, unless it is overridden by the scan options
+func mailDomain(target Target) string {
+	if target.Options.MailDomain != "" {
+		return normalizeHostname(target.Options.MailDomain)
+	}
+	return RegistrableDomain(target.URL.Hostname())
+}
@@ -0,0 +1,110 @@
+package scanner
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const testPublicSuffixList = `// ===BEGIN ICANN DOMAINS===
+de
+uk
+co.uk
+// wildcard and exception rules
+*.ck
+!www.ck
+jp
+*.kawasaki.jp
+!city.kawasaki.jp
+// idn rules are converted to punycode
+政府
+`
+
+func TestParsePublicSuffixList(t *testing.T) {
+	list, err := parsePublicSuffixList(strings.NewReader(testPublicSuffixList))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := map[string]string{
+		"example.de":            "de",
+		"www.example.co.uk":     "co.uk",
+		"example.uk":            "uk",
+		"a.b.ck":                "b.ck",
+		"www.ck":                "ck",
+		"a.city.kawasaki.jp":    "kawasaki.jp",
+		"a.b.kawasaki.jp":       "b.kawasaki.jp",
+		"example.xn--mxtq1m":    "xn--mxtq1m",
+		"example.unknown":       "unknown",
+		"www.example.gov.local": "local",
+	}
+	for domain, expected := range table {
+		if actual := list.PublicSuffix(domain); actual != expected {
+			t.Errorf("Expected the public suffix of %s to be %s, got %s", domain, expected, actual)
+		}
+	}
+}
+
+func TestParsePublicSuffixListWithoutRules(t *testing.T) {
+	if _, err := parsePublicSuffixList(strings.NewReader("// only a comment\n")); err == nil {
+		t.Fatal("Expected an error for a list without rules")
+	}
+}
+
+func TestRegistrableDomain(t *testing.T) {
+	list, err := parsePublicSuffixList(strings.NewReader(testPublicSuffixList))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := suffixList
+	suffixList = list
+	defer func() { suffixList = previous }()
+
+	table := map[string]string{
+		"www.example.de":     "example.de",
+		"awww.example.de":    "example.de",
+		"awww.de":            "awww.de",
+		"WWW.Example.co.uk.": "example.co.uk",
+		"a.b.example.co.uk":  "example.co.uk",
+		"co.uk":              "co.uk",
+		"a.city.kawasaki.jp": "city.kawasaki.jp",
+		"192.0.2.1":          "192.0.2.1",
+	}
+	for domain, expected := range table {
+		if actual := RegistrableDomain(domain); actual != expected {
+			t.Errorf("Expected the registrable domain of %s to be %s, got %s", domain, expected, actual)
+		}
+	}
+}
+
+func TestMailDomain(t *testing.T) {
+	table := []struct {
+		name       string
+		target     string
+		mailDomain string
+		expected   string
+	}{
+		{"www prefix", "https://www.example.de", "", "example.de"},
+		{"www in a label", "https://awww.example.de", "", "example.de"},
+		{"subdomain", "https://portal.service.example.de", "", "example.de"},
+		{"override", "https://www.example.de", "Mail.Example.org.", "mail.example.org"},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			u, _ := url.Parse(test.target)
+			if actual := mailDomain(Target{URL: u, Options: TargetScanOptions{MailDomain: test.mailDomain}}); actual != test.expected {
+				t.Errorf("Expected %s, got %s", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestGetAllSubdomainsFromTarget(t *testing.T) {
+	u, _ := url.Parse("https://a.b.example.co.uk")
+	actual := getAllSubdomainsFromTarget(Target{URL: u})
+	expected := []string{"a.b.example.co.uk", "b.example.co.uk", "example.co.uk"}
+	if strings.Join(actual, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+}
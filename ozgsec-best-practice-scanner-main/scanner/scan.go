@@ -42,6 +42,7 @@ func NewScanner() scanner {
 	var networkAnalyzer = NewNetworkAnalyzer(httpclient.NewDefaultClient())
 	var organizationalAnalyzer = NewOrgAnalyzer()
 	var tlsAnalyzer = NewTLSAnalyzer()
+	var tr03116Analyzer = NewTR03116Analyzer()
 	var httpAnalyzer = NewHttpAnalyzer()
 	var accessibilityAnalyzer = NewAccessibilityAnalyzer(languageDetector)
 
@@ -60,6 +61,7 @@ func NewScanner() scanner {
 	tlsAnalyzers := NewAnalyzerGroup(
 		certificateAnalyzer,
 		tlsAnalyzer,
+		tr03116Analyzer,
 	)
 
 	return scanner{
@@ -73,6 +75,8 @@ type ScanSuccess = map[AnalysisRuleId]AnalysisResult
 
 type tlsClient interface {
 	Get(ctx context.Context, target *url.URL, tlsConfig *tls.Config) (net.Conn, error)
+	// Dial establishes a plain tcp connection - it is used for handshake probes
+	Dial(ctx context.Context, target *url.URL) (net.Conn, error)
 }
 type httpClient interface {
 	Get(ctx context.Context, target *url.URL) (resp httpclient.Response, err error)
@@ -88,10 +92,32 @@ type cacher[T any] interface {
 }
 
 type TargetScanOptions struct {
-	CachingLayer  cacher[any]
-	HttpClient    httpClient
-	TlsClient     tlsClient
-	EnabledChecks map[AnalysisRuleId]bool // provides a map, which checks should be executed
+	CachingLayer   cacher[any]
+	HttpClient     httpClient
+	TlsClient      tlsClient
+	EnabledChecks  map[AnalysisRuleId]bool // provides a map, which checks should be executed
+	RequiredChecks map[AnalysisRuleId]bool // informational checks contained in this map are treated like every other check
+	// if true, the certificate details of the scan response contain the PEM encoded certificates
+	IncludeCertificatePEM bool
+	// name of the policy, which is used to evaluate the key strength of the certificate (e.g. mozilla-intermediate or bsi-tr-02102-2024)
+	KeyStrengthPolicy string
+	// the selectors, which are looked up by the dkim check - if empty, DefaultDKIMSelectors are used
+	DKIMSelectors []string
+	// selectors, which are looked up in addition for a domain (key: registrable domain)
+	DomainDKIMSelectors map[string][]string
+	// maps the organization of an issuing CA to its CAA issuer domains - used in addition to the built-in mapping
+	CAAIssuerDomains map[string][]string
+	// subdomains, whose CNAME chains are checked by the subdomainTakeover check (key: registrable domain)
+	TakeoverSubdomains map[string][]string
+	// the domain used by the mail checks (spf, dkim, dmarc, mta-sts, tls-rpt, starttls) - if empty, the registrable domain of the hostname is used
+	MailDomain string
+}
+
+// returns all informational checks, which are not marked as required
+func (o TargetScanOptions) informationalChecks() []AnalysisRuleId {
+	return utils.Filter(InformationalChecks, func(check AnalysisRuleId) bool {
+		return !o.RequiredChecks[check]
+	})
 }
 
 func maybeDoCheck(check AnalysisRuleId, options TargetScanOptions, fn func() AnalysisResult) AnalysisResult {
@@ -182,6 +208,58 @@ type resp struct {
 	err  error
 }
 
+// returns the provided tls connection state or establishes a new tls connection.
+// the state is shared by the tls analyzers and the certificate details - this way the served chain is only fetched once.
+// nil is returned, if no tls connection could be established or no tls check is enabled.
+// the CertificateRequest of the server is only known, if a new tls connection was established.
+func (s scanner) tlsConnectionState(ctx context.Context, target Target, state *tls.ConnectionState) (*tls.ConnectionState, *ClientCertificateRequest) {
+	if state != nil || !doingAnyChecks(target.Options, s.tlsAnalyzers.GetAnalysisRuleIds()) {
+		return state, nil
+	}
+	conn, request, err := tlsHandshake(ctx, target, nil)
+	if err != nil {
+		slog.Debug("could not establish tls connection", "err", err)
+		// a server, which requires a client certificate, did already send its certificate
+		return clientAuthRequiredState(err), request
+	}
+	defer conn.Close()
+	res := conn.(*tls.Conn).ConnectionState()
+	return &res, request
+}
+
+// analyzes the target, if the http request failed - the http checks are reported as errors.
+// if the server requested a client certificate during the tls handshake and refused the http request with an alert, the missing certificate caused the failure.
+// in this case, every check, which could not be done, is marked as clientAuthRequired.
+func (s scanner) analyzeWithoutResponse(ctx context.Context, target Target, err error) (map[AnalysisRuleId]AnalysisResult, *tls.ConnectionState, *ClientCertificateRequest) {
+	var tlsState *tls.ConnectionState
+	var clientCertificateRequest *ClientCertificateRequest
+	analysisResult := concurrency.All(
+		func() map[AnalysisRuleId]AnalysisResult {
+			// just return an error for the http analysis
+			return buildAnalysisError(err, s.httpAnalyzers.GetAnalysisRuleIds())
+		},
+		func() map[AnalysisRuleId]AnalysisResult {
+			// there is no http response, which could provide a tls connection state
+			tlsState, clientCertificateRequest = s.tlsConnectionState(ctx, target, nil)
+			res, _ := s.tlsAnalyzers.Analyze(ctx, target, tlsState)
+			return res
+		},
+		func() map[AnalysisRuleId]AnalysisResult {
+			res, _ := s.netAnalyzers.Analyze(ctx, target, nil)
+			return res
+		},
+	)
+
+	res := utils.Merge(analysisResult...)
+	// TLS 1.3 servers reject the missing certificate after the handshake - the alert of the failed http request shows, that it is required.
+	// the http request of a server with optional client authentication might fail for an unrelated reason (e.g. a timeout).
+	if clientCertificateRequest != nil && isClientCertificateRefused(err) {
+		clientCertificateRequest.Required = true
+		applyClientAuthRequired(res, target.Options, clientCertificateRequest)
+	}
+	return res, tlsState, clientCertificateRequest
+}
+
 var ipApiURL, _ = url.Parse("https://ipinfo.io/ip")
 
 var resolver *net.Resolver = &net.Resolver{
@@ -277,32 +355,21 @@ func (s scanner) Scan(ctx context.Context, targetURI string, options TargetScanO
 
 		target := Target{URL: uri, IPs: ips, IPV4Address: selectIPV4(ips), Options: options}
 
-		analysisResult := concurrency.All(
-			func() map[AnalysisRuleId]AnalysisResult {
-				// just return an error for the http analysis
-				return buildAnalysisError(err, s.httpAnalyzers.GetAnalysisRuleIds())
-			},
-			func() map[AnalysisRuleId]AnalysisResult {
-				// we cannot provide a tls connection state
-				res, _ := s.tlsAnalyzers.Analyze(ctx, target, nil)
-				return res
-			},
-			func() map[AnalysisRuleId]AnalysisResult {
-				res, _ := s.netAnalyzers.Analyze(ctx, target, nil)
-				return res
-			},
-		)
-
-		res := utils.Merge(analysisResult...)
+		res, tlsState, clientCertificateRequest := s.analyzeWithoutResponse(ctx, target, err)
+		applyCAAIssuer(res, target, tlsState)
+		applyHTTPSRecordObservations(ctx, res, target, tlsState, nil)
 		printTiming(target.Options, res)
 		return ScanResponse{
-			Target:    targetURI,
-			SUT:       targetURI,
-			IpAddress: target.IPV4Address.String(),
-			Duration:  time.Since(start).Milliseconds(),
-			Timestamp: time.Now().UnixMilli(),
-			Result:    res,
-			ScannerIP: scannerIP,
+			Target:              targetURI,
+			SUT:                 targetURI,
+			IpAddress:           target.IPV4Address.String(),
+			Duration:            time.Since(start).Milliseconds(),
+			Timestamp:           time.Now().UnixMilli(),
+			Result:              res,
+			ScannerIP:           scannerIP,
+			InformationalChecks: options.informationalChecks(),
+			CertificateDetails:  certificateDetails(tlsState, options.IncludeCertificatePEM),
+			ClientCertRequest:   clientCertificateRequest,
 		}
 	}
 
@@ -327,6 +394,8 @@ func (s scanner) Scan(ctx context.Context, targetURI string, options TargetScanO
 	}
 	target := Target{URL: resp.GetURL(), IPs: ips, IPV4Address: selectIPV4(ips), Options: options}
 
+	var tlsState *tls.ConnectionState
+	var clientCertificateRequest *ClientCertificateRequest
 	analysisResult := concurrency.All(
 		func() map[AnalysisRuleId]AnalysisResult {
 			// just return an error for the http analysis
@@ -334,8 +403,9 @@ func (s scanner) Scan(ctx context.Context, targetURI string, options TargetScanO
 			return res
 		},
 		func() map[AnalysisRuleId]AnalysisResult {
-			// we cannot provide a tls connection state
-			res, _ := s.tlsAnalyzers.Analyze(ctx, target, resp.TLS())
+			// if the target was not reached using https, a new tls connection is established
+			tlsState, clientCertificateRequest = s.tlsConnectionState(ctx, target, resp.TLS())
+			res, _ := s.tlsAnalyzers.Analyze(ctx, target, tlsState)
 			return res
 		},
 		func() map[AnalysisRuleId]AnalysisResult {
@@ -345,15 +415,20 @@ func (s scanner) Scan(ctx context.Context, targetURI string, options TargetScanO
 	)
 
 	res := utils.Merge(analysisResult...)
+	applyCAAIssuer(res, target, tlsState)
+	applyHTTPSRecordObservations(ctx, res, target, tlsState, resp.Response())
 	printTiming(target.Options, res)
 	response := ScanResponse{
-		Target:    targetURI,
-		SUT:       sut,
-		IpAddress: target.IPV4Address.String(),
-		Duration:  time.Since(start).Milliseconds(),
-		Timestamp: time.Now().UnixMilli(),
-		Result:    res,
-		ScannerIP: scannerIP,
+		Target:              targetURI,
+		SUT:                 sut,
+		IpAddress:           target.IPV4Address.String(),
+		Duration:            time.Since(start).Milliseconds(),
+		Timestamp:           time.Now().UnixMilli(),
+		Result:              res,
+		ScannerIP:           scannerIP,
+		InformationalChecks: options.informationalChecks(),
+		CertificateDetails:  certificateDetails(tlsState, options.IncludeCertificatePEM),
+		ClientCertRequest:   clientCertificateRequest,
 	}
 
 	return response
@@ -18,6 +18,13 @@ type ScanResponse struct {
 	// the ip address of the scanner
 	// which was used to scan the target
 	ScannerIP string `json:"scannerIP"`
+	// checks which are only informational for this scan.
+	// a failure of those checks should not be treated as a finding
+	InformationalChecks []AnalysisRuleId `json:"informationalChecks"`
+	// every certificate of the served chain - starting with the leaf
+	CertificateDetails []CertificateDetails `json:"certificateDetails"`
+	// the CertificateRequest of the server, if it asks for a client certificate (mutual TLS)
+	ClientCertRequest *ClientCertificateRequest `json:"clientCertificateRequest"`
 }
 
 func (s ScanResponse) Fields() map[string]interface{} {
@@ -0,0 +1,354 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+const (
+	SPFMultipleRecords    = "spfMultipleRecords"
+	SPFSyntaxError        = "spfSyntaxError"
+	SPFTooManyLookups     = "spfTooManyDNSLookups"
+	SPFTooManyVoidLookups = "spfTooManyVoidLookups"
+	SPFLoop               = "spfLoop"
+	SPFIncludeNotFound    = "spfIncludeNotFound"
+	SPFPassAll            = "spfPassAll"
+	SPFNeutralAll         = "spfNeutralAll"
+	SPFSoftFailAll        = "spfSoftFailAll"
+	SPFPtrMechanism       = "spfPtrMechanism"
+)
+
+// RFC7208 Section 4.6.4
+const (
+	spfMaxLookups     = 10
+	spfMaxVoidLookups = 2
+	spfMaxMXRecords   = 10
+)
+
+// the terms, which cause a dns lookup (RFC7208 Section 4.6.4)
+var spfLookupTerms = []string{"include", "a", "mx", "ptr", "exists", "redirect"}
+
+type spfEvaluation struct {
+	lookups     int
+	voidLookups int
+	// the domains of the current include or redirect chain - used to detect loops
+	chain           []string
+	includes        []string
+	errors          []string
+	recommendations []string
+}
+
+func (e *spfEvaluation) addError(errorId string) {
+	if !utils.Includes(e.errors, errorId) {
+		e.errors = append(e.errors, errorId)
+	}
+}
+
+func (e *spfEvaluation) voidLookup() {
+	e.voidLookups++
+	if e.voidLookups > spfMaxVoidLookups {
+		e.addError(SPFTooManyVoidLookups)
+	}
+}
+
+func (e *spfEvaluation) addRecommendation(recommendation string) {
+	if !utils.Includes(e.recommendations, recommendation) {
+		e.recommendations = append(e.recommendations, recommendation)
+	}
+}
+
+// the strings of a TXT record need to be concatenated (RFC7208 Section 3.3)
+func txtRecordValue(txt *dns.TXT) string {
+	return strings.Join(txt.Txt, "")
+}
+
+func isSPFRecord(value string) bool {
+	return strings.EqualFold(value, "v=spf1") || strings.HasPrefix(strings.ToLower(value), "v=spf1 ")
+}
+
+// returns the spf records of the domain.
+// the second return value is false, if the lookup was void (NXDOMAIN or no records).
+func (d domainAnalyzer) spfRecords(ctx context.Context, domain string) ([]string, bool, error) {
+	msg, err := d.exchange(ctx, domain, dns.TypeTXT)
+	if err != nil {
+		return nil, false, err
+	}
+	if msg.Rcode != dns.RcodeSuccess && msg.Rcode != dns.RcodeNameError {
+		return nil, false, fmt.Errorf("dns lookup of %s failed: %s", domain, dns.RcodeToString[msg.Rcode])
+	}
+
+	records := make([]string, 0)
+	for _, answer := range msg.Answer {
+		if txt, ok := answer.(*dns.TXT); ok && isSPFRecord(txtRecordValue(txt)) {
+			records = append(records, txtRecordValue(txt))
+		}
+	}
+	return records, len(msg.Answer) > 0, nil
+}
+
+// splits a term into its qualifier, name and value (e.g. "~include:example.com" -> "~", "include", "example.com")
+func parseSPFTerm(term string) (string, string, string, bool) {
+	// modifiers use "=" (e.g. redirect=example.com)
+	if name, value, ok := strings.Cut(term, "="); ok && !strings.ContainsAny(name, ":/") {
+		return "", strings.ToLower(name), value, true
+	}
+
+	qualifier := "+"
+	if strings.ContainsAny(term[:1], "+-~?") {
+		qualifier, term = term[:1], term[1:]
+	}
+	name, value, _ := strings.Cut(term, ":")
+	if name == term {
+		// a and mx might be followed by a cidr length without a domain (e.g. a/24)
+		name, value, _ = strings.Cut(term, "/")
+		if value != "" {
+			value = "/" + value
+		}
+	}
+	return qualifier, strings.ToLower(name), value, false
+}
+
+// removes the cidr length of the domain-spec of the a and mx mechanisms
+func spfDomainSpec(value string, domain string) string {
+	spec, _, _ := strings.Cut(value, "/")
+	if spec == "" {
+		return domain
+	}
+	return spec
+}
+
+func validSPFNetwork(value string, ipv6 bool) bool {
+	ip, cidr, hasCidr := strings.Cut(value, "/")
+	parsed := net.ParseIP(ip)
+	if parsed == nil || (parsed.To4() == nil) != ipv6 {
+		return false
+	}
+	if hasCidr {
+		_, _, err := net.ParseCIDR(value)
+		return err == nil && cidr != ""
+	}
+	return true
+}
+
+// checks, if the name exists (the lookup is not void)
+func (d domainAnalyzer) spfHostExists(ctx context.Context, name string, qtypes ...uint16) (bool, error) {
+	for _, qtype := range qtypes {
+		msg, err := d.exchange(ctx, name, qtype)
+		if err != nil {
+			return false, err
+		}
+		if len(msg.Answer) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// evaluates the spf record of the domain and returns the qualifier of the "all" mechanism (empty, if there is none)
+func (d domainAnalyzer) evaluateSPF(ctx context.Context, domain string, record string, e *spfEvaluation) (string, error) {
+	e.chain = append(e.chain, strings.ToLower(dns.Fqdn(domain)))
+	defer func() { e.chain = e.chain[:len(e.chain)-1] }()
+
+	all := ""
+	redirect := ""
+	for _, term := range strings.Fields(record)[1:] {
+		qualifier, name, value, isModifier := parseSPFTerm(term)
+		if utils.Includes(spfLookupTerms, name) {
+			e.lookups++
+			if e.lookups > spfMaxLookups {
+				e.addError(SPFTooManyLookups)
+				// stop resolving - the record is a permerror anyway
+				return all, nil
+			}
+		}
+
+		if isModifier {
+			if name == "redirect" {
+				redirect = value
+			}
+			// unknown modifiers and exp are ignored (RFC7208 Section 6)
+			continue
+		}
+
+		// macros (e.g. %{i}) can only be expanded for a sender - the lookup is counted, but not done
+		if strings.Contains(value, "%") {
+			continue
+		}
+
+		var exists bool
+		var err error
+		switch name {
+		case "all":
+			all = qualifier + "all"
+			continue
+		case "ip4", "ip6":
+			if !validSPFNetwork(value, name == "ip6") {
+				e.addError(SPFSyntaxError)
+			}
+			continue
+		case "ptr":
+			// the ptr mechanism should not be used (RFC7208 Section 5.5)
+			e.addRecommendation(SPFPtrMechanism)
+			continue
+		case "a":
+			exists, err = d.spfHostExists(ctx, spfDomainSpec(value, domain), dns.TypeA, dns.TypeAAAA)
+		case "exists":
+			exists, err = d.spfHostExists(ctx, value, dns.TypeA)
+		case "mx":
+			var msg *dns.Msg
+			msg, err = d.exchange(ctx, spfDomainSpec(value, domain), dns.TypeMX)
+			if err == nil {
+				exists = len(msg.Answer) > 0
+				if len(msg.Answer) > spfMaxMXRecords {
+					e.addError(SPFTooManyLookups)
+				}
+			}
+		case "include":
+			if value == "" {
+				e.addError(SPFSyntaxError)
+				continue
+			}
+			exists, err = d.evaluateSPFInclude(ctx, value, e)
+		default:
+			e.addError(SPFSyntaxError)
+			continue
+		}
+
+		if err != nil {
+			return all, err
+		}
+		if !exists {
+			e.voidLookup()
+		}
+	}
+
+	// the redirect is only used, if there is no all mechanism (RFC7208 Section 6.1)
+	if redirect == "" || all != "" {
+		return all, nil
+	}
+	if d.spfLoop(redirect, e) {
+		return all, nil
+	}
+	records, exists, err := d.spfRecords(ctx, redirect)
+	if err != nil {
+		return all, err
+	}
+	if !exists {
+		e.voidLookup()
+	}
+	if len(records) != 1 {
+		// a missing or ambiguous record of the redirect target is a permerror
+		if len(records) == 0 {
+			e.addError(SPFIncludeNotFound)
+		} else {
+			e.addError(SPFMultipleRecords)
+		}
+		return all, nil
+	}
+	e.includes = append(e.includes, redirect)
+	return d.evaluateSPF(ctx, redirect, records[0], e)
+}
+
+func (d domainAnalyzer) spfLoop(domain string, e *spfEvaluation) bool {
+	if utils.Includes(e.chain, strings.ToLower(dns.Fqdn(domain))) {
+		e.addError(SPFLoop)
+		return true
+	}
+	return false
+}
+
+// evaluates the record of an included domain. the "all" mechanism of the included record does not matter.
+func (d domainAnalyzer) evaluateSPFInclude(ctx context.Context, domain string, e *spfEvaluation) (bool, error) {
+	if d.spfLoop(domain, e) {
+		return true, nil
+	}
+	records, exists, err := d.spfRecords(ctx, domain)
+	if err != nil {
+		return false, err
+	}
+	switch len(records) {
+	case 0:
+		e.addError(SPFIncludeNotFound)
+	case 1:
+		e.includes = append(e.includes, domain)
+		if _, err := d.evaluateSPF(ctx, domain, records[0], e); err != nil {
+			return exists, err
+		}
+	default:
+		e.addError(SPFMultipleRecords)
+	}
+	return exists, nil
+}
+
+/*
+REQUIRED: The domain publishes exactly one valid SPF record (RFC7208)
+
+	The record is evaluated like a receiving mail server would do it (without a sender ip):
+	include and redirect are resolved recursively, the a, mx and exists mechanisms are looked up.
+	The record must not need more than 10 dns lookups (and 2 void lookups), must not contain loops and must not authorize everyone using "+all".
+
+RECOMMENDED: The record ends with "-all" - "~all" and "?all" (or no "all" at all) do not reject unauthorized senders.
+RECOMMENDED: The ptr mechanism is not used.
+
+Source: https://www.rfc-editor.org/rfc/rfc7208
+*/
+func (d domainAnalyzer) spf(ctx context.Context, target Target) AnalysisResult {
+	start := time.Now()
+	hostname := mailDomain(target)
+
+	records, _, err := d.spfRecords(ctx, hostname)
+	if err != nil {
+		return NewAnalysisResult(Unknown, nil, nil, nil, time.Since(start))
+	}
+	if len(records) == 0 {
+		return NewAnalysisResult(Failure, nil, nil, nil, time.Since(start))
+	}
+	if len(records) > 1 {
+		return NewAnalysisResult(Failure, map[string]any{
+			"records": records,
+		}, []string{SPFMultipleRecords}, nil, time.Since(start))
+	}
+
+	e := spfEvaluation{
+		includes:        make([]string, 0),
+		errors:          make([]string, 0),
+		recommendations: make([]string, 0),
+	}
+	all, err := d.evaluateSPF(ctx, hostname, records[0], &e)
+	if err != nil {
+		return NewAnalysisResult(Unknown, map[string]any{
+			"spf":   records[0],
+			"error": err.Error(),
+		}, nil, nil, time.Since(start))
+	}
+
+	switch all {
+	case "+all":
+		e.addError(SPFPassAll)
+	case "~all":
+		e.addRecommendation(SPFSoftFailAll)
+	case "-all":
+	default:
+		// "?all" and a missing all mechanism both result in neutral
+		e.addRecommendation(SPFNeutralAll)
+	}
+
+	actualValue := map[string]any{
+		"spf":         records[0],
+		"all":         all,
+		"lookups":     e.lookups,
+		"voidLookups": e.voidLookups,
+		"includes":    e.includes,
+	}
+	if len(e.errors) > 0 {
+		return NewAnalysisResult(Failure, actualValue, e.errors, e.recommendations, time.Since(start))
+	}
+	return NewAnalysisResult(Success, actualValue, nil, e.recommendations, time.Since(start))
+}
@@ -0,0 +1,132 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+// builds the records of the test resolver. a TXT record with multiple strings is separated by "|".
+func testTXTRecords(t *testing.T, records map[string][]string) map[string][]dns.RR {
+	t.Helper()
+	res := make(map[string][]dns.RR)
+	for name, values := range records {
+		for _, value := range values {
+			res[dns.Fqdn(name)+"/TXT"] = append(res[dns.Fqdn(name)+"/TXT"], &dns.TXT{
+				Hdr: dns.RR_Header{Name: dns.Fqdn(name), Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 3600},
+				Txt: strings.Split(value, "|"),
+			})
+		}
+	}
+	return res
+}
+
+func TestSPF(t *testing.T) {
+	tooManyIncludes := map[string][]string{"example.test": {"v=spf1 include:0.example.test -all"}}
+	for i := 0; i < 11; i++ {
+		tooManyIncludes[fmt.Sprintf("%d.example.test", i)] = []string{fmt.Sprintf("v=spf1 include:%d.example.test", i+1)}
+	}
+
+	table := []struct {
+		name                    string
+		records                 map[string][]string
+		expectedDidPass         DidPass
+		expectedErrors          []string
+		expectedRecommendations []string
+	}{
+		{
+			name: "include",
+			records: map[string][]string{
+				"example.test":      {"v=spf1 ip4:192.0.2.0/24 include:_spf.example.test -all"},
+				"_spf.example.test": {"v=spf1 ip6:2001:db8::/32 ~all"},
+			},
+			expectedDidPass: Success,
+		},
+		{
+			name:                    "split strings",
+			records:                 map[string][]string{"example.test": {"v=spf1 ip4:192.0.2.1 |~all"}},
+			expectedDidPass:         Success,
+			expectedRecommendations: []string{SPFSoftFailAll},
+		},
+		{
+			name: "redirect",
+			records: map[string][]string{
+				"example.test":      {"v=spf1 redirect=_spf.example.test"},
+				"_spf.example.test": {"v=spf1 ip4:192.0.2.1 -all"},
+			},
+			expectedDidPass: Success,
+		},
+		{
+			name:            "pass all",
+			records:         map[string][]string{"example.test": {"v=spf1 +all"}},
+			expectedDidPass: Failure,
+			expectedErrors:  []string{SPFPassAll},
+		},
+		{
+			name:                    "neutral all",
+			records:                 map[string][]string{"example.test": {"v=spf1 ip4:192.0.2.1"}},
+			expectedDidPass:         Success,
+			expectedRecommendations: []string{SPFNeutralAll},
+		},
+		{
+			name:            "multiple records",
+			records:         map[string][]string{"example.test": {"v=spf1 -all", "v=spf1 ip4:192.0.2.1 -all"}},
+			expectedDidPass: Failure,
+			expectedErrors:  []string{SPFMultipleRecords},
+		},
+		{
+			name: "loop",
+			records: map[string][]string{
+				"example.test":   {"v=spf1 include:a.example.test -all"},
+				"a.example.test": {"v=spf1 include:example.test -all"},
+			},
+			expectedDidPass: Failure,
+			expectedErrors:  []string{SPFLoop},
+		},
+		{
+			name:            "missing include",
+			records:         map[string][]string{"example.test": {"v=spf1 include:missing.example.test -all"}},
+			expectedDidPass: Failure,
+			expectedErrors:  []string{SPFIncludeNotFound},
+		},
+		{
+			name:            "too many lookups",
+			records:         tooManyIncludes,
+			expectedDidPass: Failure,
+			expectedErrors:  []string{SPFTooManyLookups},
+		},
+		{
+			name:            "syntax error",
+			records:         map[string][]string{"example.test": {"v=spf1 ip4:192.0.2.300 -all"}},
+			expectedDidPass: Failure,
+			expectedErrors:  []string{SPFSyntaxError},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			d := domainAnalyzer{
+				client:   new(dns.Client),
+				resolver: startTestResolver(t, testTXTRecords(t, test.records), nil),
+			}
+			target, _ := url.Parse("https://www.example.test")
+			actual := d.spf(context.Background(), Target{URL: target})
+
+			if test.expectedDidPass == Success && !actual.IsSuccess() || test.expectedDidPass == Failure && !actual.IsError() {
+				t.Fatalf("Expected %v, got %+v", *test.expectedDidPass, actual)
+			}
+			if len(actual.Errors) != len(test.expectedErrors) || !utils.IncludesSubset(actual.Errors, test.expectedErrors) {
+				t.Errorf("Expected errors %v, got %v", test.expectedErrors, actual.Errors)
+			}
+			if test.expectedDidPass == Success && (len(actual.Recommendations) != len(test.expectedRecommendations) || !utils.IncludesSubset(actual.Recommendations, test.expectedRecommendations)) {
+				t.Errorf("Expected recommendations %v, got %v", test.expectedRecommendations, actual.Recommendations)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/concurrency"
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+const (
+	DanglingCNAME             = "danglingCname"
+	SubdomainTakeoverPossible = "subdomainTakeoverPossible"
+)
+
+const (
+	// the maximum number of CNAME records, which are followed
+	maxCNAMEChainLength = 8
+	// the maximum number of bytes of a response body, which are searched for a fingerprint
+	takeoverMaxBodySize = 512 * 1024
+)
+
+// path to a JSON file containing the signatures of takeover-prone services - if empty, defaultTakeoverSignatures are used
+var takeoverSignaturesPath = os.Getenv("TAKEOVER_SIGNATURES")
+
+// describes a service, whose resources can be claimed by anyone after they were deleted
+type takeoverSignature struct {
+	Service string `json:"service"`
+	// the CNAME targets of the service - "*.example.com" matches every subdomain of example.com
+	CNAMEs []string `json:"cnames"`
+	// true, if a non-existing target (NXDOMAIN) can be claimed
+	NXDomain bool `json:"nxdomain"`
+	// parts of the response body, which are served for a deleted resource
+	Fingerprints []string `json:"fingerprints"`
+	// the status code, which is served for a deleted resource - 0 matches every status code
+	HTTPStatus int `json:"httpStatus"`
+}
+
+// the signatures are based on https://github.com/EdOverflow/can-i-take-over-xyz
+var defaultTakeoverSignatures = []takeoverSignature{
+	{Service: "AWS S3", CNAMEs: []string{"*.amazonaws.com"}, Fingerprints: []string{"NoSuchBucket", "The specified bucket does not exist"}},
+	{Service: "AWS Elastic Beanstalk", CNAMEs: []string{"*.elasticbeanstalk.com"}, NXDomain: true},
+	{Service: "Microsoft Azure", CNAMEs: []string{
+		"*.azurewebsites.net", "*.cloudapp.net", "*.cloudapp.azure.com", "*.trafficmanager.net", "*.blob.core.windows.net",
+		"*.azureedge.net", "*.azure-api.net", "*.azurecontainer.io", "*.azurefd.net", "*.azurehdinsight.net",
+		"*.database.windows.net", "*.redis.cache.windows.net", "*.search.windows.net", "*.servicebus.windows.net", "*.visualstudio.com",
+	}, NXDomain: true},
+	{Service: "GitHub Pages", CNAMEs: []string{"*.github.io"}, Fingerprints: []string{"There isn't a GitHub Pages site here."}, HTTPStatus: 404},
+	{Service: "Heroku", CNAMEs: []string{"*.herokuapp.com", "*.herokudns.com"}, Fingerprints: []string{"No such app"}},
+	{Service: "Shopify", CNAMEs: []string{"*.myshopify.com"}, Fingerprints: []string{"Sorry, this shop is currently unavailable."}},
+	{Service: "Fastly", CNAMEs: []string{"*.fastly.net"}, Fingerprints: []string{"Fastly error: unknown domain"}},
+	{Service: "Pantheon", CNAMEs: []string{"*.pantheonsite.io"}, Fingerprints: []string{"The gods are wise"}},
+	{Service: "Surge.sh", CNAMEs: []string{"*.surge.sh"}, Fingerprints: []string{"project not found"}},
+	{Service: "Bitbucket", CNAMEs: []string{"*.bitbucket.io"}, Fingerprints: []string{"Repository not found"}},
+	{Service: "Zendesk", CNAMEs: []string{"*.zendesk.com"}, Fingerprints: []string{"Help Center Closed"}},
+	{Service: "ReadMe", CNAMEs: []string{"*.readme.io"}, Fingerprints: []string{"Project doesnt exist... yet!"}},
+	{Service: "WordPress.com", CNAMEs: []string{"*.wordpress.com"}, Fingerprints: []string{"Do you want to register"}},
+}
+
+func loadTakeoverSignatures(path string) ([]takeoverSignature, error) {
+	if path == "" {
+		return defaultTakeoverSignatures, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return defaultTakeoverSignatures, err
+	}
+	var signatures []takeoverSignature
+	if err := json.Unmarshal(data, &signatures); err != nil {
+		return defaultTakeoverSignatures, fmt.Errorf("could not parse takeover signatures: %w", err)
+	}
+	return signatures, nil
+}
+
+func (s takeoverSignature) matches(name string) bool {
+	return utils.Some(s.CNAMEs, func(pattern string) bool {
+		pattern = normalizeHostname(pattern)
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			return strings.HasSuffix(name, "."+suffix)
+		}
+		return name == pattern
+	})
+}
+
+// the result of a single CNAME chain
+type takeoverRecord struct {
+	Name string `json:"name"`
+	// the CNAME targets in the order they were followed
+	Chain []string `json:"chain"`
+	// the rcode of the address lookup of the last target
+	Rcode      string `json:"rcode"`
+	Dangling   bool   `json:"dangling"`
+	Vulnerable bool   `json:"vulnerable"`
+	Service    string `json:"service,omitempty"`
+	Evidence   string `json:"evidence,omitempty"`
+}
+
+// follows the CNAME chain of the name and returns the targets and the rcode of the address lookup of the last target
+func (d domainAnalyzer) cnameChain(ctx context.Context, name string) ([]string, int, error) {
+	chain := make([]string, 0)
+	current := normalizeHostname(name)
+	for len(chain) < maxCNAMEChainLength {
+		msg, err := d.exchange(ctx, current, dns.TypeCNAME)
+		if err != nil {
+			return nil, 0, err
+		}
+		next := ""
+		for _, answer := range msg.Answer {
+			if cname, ok := answer.(*dns.CNAME); ok && normalizeHostname(cname.Hdr.Name) == current {
+				next = normalizeHostname(cname.Target)
+			}
+		}
+		// a loop is reported like a missing target
+		if next == "" || utils.Includes(chain, next) {
+			break
+		}
+		chain = append(chain, next)
+		current = next
+	}
+
+	msg, err := d.exchange(ctx, current, dns.TypeA)
+	if err != nil {
+		return nil, 0, err
+	}
+	return chain, msg.Rcode, nil
+}
+
+// searches the response of the name for the fingerprints of the signature
+func matchTakeoverFingerprint(ctx context.Context, target Target, name string, signature takeoverSignature) (string, bool) {
+	res, err := target.Options.HttpClient.Get(ctx, &url.URL{Scheme: "http", Host: name, Path: "/"})
+	if err != nil || res.Response() == nil {
+		return "", false
+	}
+	resp := res.Response()
+	defer resp.Body.Close()
+	if signature.HTTPStatus != 0 && resp.StatusCode != signature.HTTPStatus {
+		return "", false
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, takeoverMaxBodySize))
+	if err != nil {
+		return "", false
+	}
+	for _, fingerprint := range signature.Fingerprints {
+		if strings.Contains(string(body), fingerprint) {
+			return fmt.Sprintf("HTTP %d: %q", resp.StatusCode, fingerprint), true
+		}
+	}
+	return "", false
+}
+
+func (d domainAnalyzer) checkTakeover(ctx context.Context, target Target, name string) (*takeoverRecord, error) {
+	chain, rcode, err := d.cnameChain(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(chain) == 0 {
+		// without a CNAME, the name is not delegated to a third party
+		return nil, nil
+	}
+	record := &takeoverRecord{
+		Name:     normalizeHostname(name),
+		Chain:    chain,
+		Rcode:    dns.RcodeToString[rcode],
+		Dangling: rcode == dns.RcodeNameError,
+	}
+
+	for _, signature := range d.takeoverSignatures {
+		if !utils.Some(chain, signature.matches) {
+			continue
+		}
+		if record.Dangling && signature.NXDomain {
+			record.Vulnerable, record.Service = true, signature.Service
+			record.Evidence = fmt.Sprintf("NXDOMAIN: %s", chain[len(chain)-1])
+			break
+		}
+		if !record.Dangling && len(signature.Fingerprints) > 0 {
+			if evidence, ok := matchTakeoverFingerprint(ctx, target, record.Name, signature); ok {
+				record.Vulnerable, record.Service, record.Evidence = true, signature.Service, evidence
+				break
+			}
+		}
+	}
+	return record, nil
+}
+
+// returns the configured subdomains of the domain - a name without the domain as suffix is relative to the domain
+func takeoverSubdomains(options TargetScanOptions, domain string) []string {
+	names := make([]string, 0)
+	for _, subdomain := range options.TakeoverSubdomains[strings.ToLower(domain)] {
+		name := normalizeHostname(subdomain)
+		if name != domain && !strings.HasSuffix(name, "."+domain) {
+			name += "." + domain
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+/*
+REQUIRED: The CNAME chains of the hostname and of the configured subdomains do not end in a non-existing name (dangling CNAME)
+REQUIRED: No CNAME chain points to a deleted resource of a takeover-prone service
+
+	A resource is considered deleted, if the service answers with NXDOMAIN or a known error page (signature).
+	The signatures are read from TAKEOVER_SIGNATURES - defaultTakeoverSignatures are used as a fallback.
+
+Source: https://github.com/EdOverflow/can-i-take-over-xyz
+*/
+func (d domainAnalyzer) subdomainTakeover(ctx context.Context, target Target) AnalysisResult {
+	start := time.Now()
+	hostname := normalizeHostname(target.URL.Hostname())
+	domain := RegistrableDomain(hostname)
+
+	names := []string{hostname}
+	for _, name := range takeoverSubdomains(target.Options, domain) {
+		if !utils.Includes(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	type result struct {
+		record *takeoverRecord
+		err    error
+	}
+	results := concurrency.All(utils.Map(names, func(name string) func() result {
+		return func() result {
+			record, err := d.checkTakeover(ctx, target, name)
+			return result{record, err}
+		}
+	})...)
+	if results[0].err != nil {
+		return NewAnalysisResult(Unknown, nil, nil, nil, time.Since(start))
+	}
+
+	records := make([]takeoverRecord, 0)
+	errors := make([]string, 0)
+	for _, r := range results {
+		if r.record == nil {
+			continue
+		}
+		records = append(records, *r.record)
+		switch {
+		case r.record.Vulnerable && !utils.Includes(errors, SubdomainTakeoverPossible):
+			errors = append(errors, SubdomainTakeoverPossible)
+		case !r.record.Vulnerable && r.record.Dangling && !utils.Includes(errors, DanglingCNAME):
+			errors = append(errors, DanglingCNAME)
+		}
+	}
+
+	actualValue := map[string]any{
+		"records": records,
+	}
+	if len(errors) > 0 {
+		return NewAnalysisResult(Failure, actualValue, errors, nil, time.Since(start))
+	}
+	return NewAnalysisResult(Success, actualValue, nil, nil, time.Since(start))
+}
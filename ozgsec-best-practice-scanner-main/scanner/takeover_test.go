@@ -0,0 +1,143 @@
+package scanner
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/httpclient"
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+func TestSubdomainTakeover(t *testing.T) {
+	table := []struct {
+		name               string
+		records            map[string][]dns.RR
+		rcodes             map[string]int
+		subdomains         []string
+		status             int
+		body               string
+		expectedDidPass    DidPass
+		expectedErrors     []string
+		expectedVulnerable []string
+	}{
+		{
+			name:            "no cname",
+			records:         testRecords(t, "www.example.test. 3600 IN A 192.0.2.1"),
+			expectedDidPass: Success,
+		},
+		{
+			name:            "cname to an existing target",
+			records:         testRecords(t, "www.example.test. 3600 IN CNAME web.example.net.", "web.example.net. 3600 IN A 192.0.2.1"),
+			expectedDidPass: Success,
+		},
+		{
+			name:            "dangling cname",
+			records:         testRecords(t, "www.example.test. 3600 IN CNAME gone.example.net."),
+			rcodes:          map[string]int{"gone.example.net.": dns.RcodeNameError},
+			expectedDidPass: Failure,
+			expectedErrors:  []string{DanglingCNAME},
+		},
+		{
+			name:               "nxdomain signature",
+			records:            testRecords(t, "www.example.test. 3600 IN CNAME old.example.net.", "old.example.net. 3600 IN CNAME agency.azurewebsites.net."),
+			rcodes:             map[string]int{"agency.azurewebsites.net.": dns.RcodeNameError},
+			expectedDidPass:    Failure,
+			expectedErrors:     []string{SubdomainTakeoverPossible},
+			expectedVulnerable: []string{"www.example.test"},
+		},
+		{
+			name:               "fingerprint signature",
+			records:            testRecords(t, "www.example.test. 3600 IN CNAME agency.github.io.", "agency.github.io. 3600 IN A 192.0.2.1"),
+			status:             http.StatusNotFound,
+			body:               "404 - There isn't a GitHub Pages site here.",
+			expectedDidPass:    Failure,
+			expectedErrors:     []string{SubdomainTakeoverPossible},
+			expectedVulnerable: []string{"www.example.test"},
+		},
+		{
+			name:            "fingerprint not found",
+			records:         testRecords(t, "www.example.test. 3600 IN CNAME agency.github.io.", "agency.github.io. 3600 IN A 192.0.2.1"),
+			status:          http.StatusOK,
+			body:            "Welcome",
+			expectedDidPass: Success,
+		},
+		{
+			name:            "configured subdomain",
+			records:         testRecords(t, "www.example.test. 3600 IN A 192.0.2.1", "cdn.example.test. 3600 IN CNAME gone.example.net."),
+			rcodes:          map[string]int{"gone.example.net.": dns.RcodeNameError},
+			subdomains:      []string{"cdn"},
+			expectedDidPass: Failure,
+			expectedErrors:  []string{DanglingCNAME},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+				w.Write([]byte(test.body)) // nolint // the test fails, if the response is missing
+			}))
+			defer server.Close()
+
+			d := domainAnalyzer{
+				client:             new(dns.Client),
+				resolver:           startTestResolverWithRcodes(t, test.records, nil, test.rcodes),
+				takeoverSignatures: defaultTakeoverSignatures,
+			}
+			target, _ := url.Parse("https://www.example.test")
+			actual := d.subdomainTakeover(context.Background(), Target{URL: target, Options: TargetScanOptions{
+				TakeoverSubdomains: map[string][]string{"example.test": test.subdomains},
+				HttpClient: httpclient.NewRedirectAwareHttpClient(&http.Transport{
+					// every connection is sent to the test server
+					DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+						return new(net.Dialer).DialContext(ctx, network, server.Listener.Addr().String())
+					},
+				}),
+			}})
+
+			if test.expectedDidPass == Success && !actual.IsSuccess() || test.expectedDidPass == Failure && !actual.IsError() {
+				t.Fatalf("Expected %v, got %+v", *test.expectedDidPass, actual)
+			}
+			if len(actual.Errors) != len(test.expectedErrors) || !utils.IncludesSubset(actual.Errors, test.expectedErrors) {
+				t.Errorf("Expected errors %v, got %v", test.expectedErrors, actual.Errors)
+			}
+			records := actual.ActualValue.(map[string]any)["records"].([]takeoverRecord)
+			vulnerable := utils.Map(utils.Filter(records, func(record takeoverRecord) bool { return record.Vulnerable }), func(record takeoverRecord) string {
+				if record.Evidence == "" || record.Service == "" {
+					t.Errorf("Expected the evidence and the service of %s", record.Name)
+				}
+				return record.Name
+			})
+			if len(vulnerable) != len(test.expectedVulnerable) || !utils.IncludesSubset(vulnerable, test.expectedVulnerable) {
+				t.Errorf("Expected vulnerable records %v, got %v", test.expectedVulnerable, vulnerable)
+			}
+		})
+	}
+}
+
+func TestLoadTakeoverSignatures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signatures.json")
+	if err := os.WriteFile(path, []byte(`[{"service": "Example", "cnames": ["*.example.net", "example.org"], "nxdomain": true}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	signatures, err := loadTakeoverSignatures(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signatures) != 1 || signatures[0].Service != "Example" || !signatures[0].NXDomain {
+		t.Fatalf("Expected the signature of the file, got %+v", signatures)
+	}
+	for name, expected := range map[string]bool{"a.example.net": true, "example.net": false, "example.org": true, "a.example.org": false} {
+		if actual := signatures[0].matches(name); actual != expected {
+			t.Errorf("Expected %s to match %v, got %v", name, expected, actual)
+		}
+	}
+}
@@ -3,9 +3,13 @@ package scanner
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"errors"
 	"log/slog"
 	"net/url"
+	"reflect"
+	"sync"
 	"time"
 
 	"net"
@@ -41,7 +45,122 @@ var tls12StrongCipherSuites = []uint16{
 // just used for testing purposes. The value should be FALSE when running in production
 var insecureSkipVerify = false
 
+// ClientAuthRequired is reported, if the server aborted the handshake, because no client certificate was provided
+const ClientAuthRequired = "clientAuthRequired"
+
+// ClientCertificateRequest describes the CertificateRequest of a server, which asks for a client certificate (mutual TLS).
+// e-government portals (e.g. using the eID or Elster) require client certificates.
+type ClientCertificateRequest struct {
+	// the handshake failed, because no client certificate was provided.
+	// TLS 1.3 servers reject the missing certificate after the handshake - they are only reported as required, if the http request failed.
+	Required bool `json:"required"`
+	// the distinguished names of the certificate authorities accepted by the server
+	AcceptableCAs []string `json:"acceptableCAs"`
+}
+
+// ClientAuthRequiredError is returned, if the handshake failed after the server requested a client certificate
+type ClientAuthRequiredError struct {
+	Request ClientCertificateRequest
+	// the connection state after the server certificate was received
+	State *tls.ConnectionState
+	Err   error
+}
+
+func (e *ClientAuthRequiredError) Error() string {
+	return "server requires a client certificate: " + e.Err.Error()
+}
+
+func (e *ClientAuthRequiredError) Unwrap() error {
+	return e.Err
+}
+
+// the alerts, which a server sends, if it refuses a connection without a client certificate
+// (handshake_failure, bad_certificate and certificate_required - RFC8446 Section 6.2)
+var clientCertificateRefusedAlerts = []tls.AlertError{40, 42, 116}
+
+// checks if the error is caused by an alert of the server, which refused the missing client certificate
+func isClientCertificateRefused(err error) bool {
+	var alert tls.AlertError
+	if errors.As(err, &alert) {
+		return utils.Includes(clientCertificateRefusedAlerts, alert)
+	}
+	// crypto/tls does not export the type of a received alert - it is an uint8 wrapped inside a "remote error"
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "remote error" {
+		if v := reflect.ValueOf(opErr.Err); v.Kind() == reflect.Uint8 {
+			return utils.Includes(clientCertificateRefusedAlerts, tls.AlertError(v.Uint()))
+		}
+	}
+	return false
+}
+
+// returns the connection state of a handshake, which failed after the server requested a client certificate
+func clientAuthRequiredState(err error) *tls.ConnectionState {
+	var clientAuthErr *ClientAuthRequiredError
+	if errors.As(err, &clientAuthErr) {
+		return clientAuthErr.State
+	}
+	return nil
+}
+
+// the handshake reached the point, where the server requested a client certificate.
+// the protocol version, the cipher suite and the key exchange were negotiated at that point.
+func handshakeSucceeded(err error) bool {
+	var clientAuthErr *ClientAuthRequiredError
+	return err == nil || errors.As(err, &clientAuthErr)
+}
+
+func distinguishedNames(rawNames [][]byte) []string {
+	names := make([]string, 0, len(rawNames))
+	for _, rawName := range rawNames {
+		var rdn pkix.RDNSequence
+		if _, err := asn1.Unmarshal(rawName, &rdn); err != nil {
+			continue
+		}
+		var name pkix.Name
+		name.FillFromRDNSequence(&rdn)
+		names = append(names, name.String())
+	}
+	return names
+}
+
+// handshakeObserver records the CertificateRequest and the connection state of a handshake - even if the handshake fails afterwards
+type handshakeObserver struct {
+	mut     sync.Mutex
+	request *ClientCertificateRequest
+	state   *tls.ConnectionState
+}
+
+func (o *handshakeObserver) observe(config *tls.Config) *tls.Config {
+	config = config.Clone()
+	config.GetClientCertificate = func(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		o.mut.Lock()
+		defer o.mut.Unlock()
+		o.request = &ClientCertificateRequest{AcceptableCAs: distinguishedNames(info.AcceptableCAs)}
+		// do not send any certificate
+		return &tls.Certificate{}, nil
+	}
+	verifyConnection := config.VerifyConnection
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		o.mut.Lock()
+		o.state = &state
+		o.mut.Unlock()
+		if verifyConnection != nil {
+			return verifyConnection(state)
+		}
+		return nil
+	}
+	return config
+}
+
 func tlsConnect(ctx context.Context, target Target, tlsConfig *tls.Config) (net.Conn, error) {
+	conn, _, err := tlsHandshake(ctx, target, tlsConfig)
+	return conn, err
+}
+
+// tlsHandshake establishes a tls connection and returns the CertificateRequest of the server (nil if the server did not request a client certificate).
+// if the handshake failed after the CertificateRequest, a ClientAuthRequiredError is returned.
+func tlsHandshake(ctx context.Context, target Target, tlsConfig *tls.Config) (net.Conn, *ClientCertificateRequest, error) {
 	if tlsConfig == nil {
 		tlsConfig = &tls.Config{
 			ServerName:         target.URL.Hostname(),
@@ -58,12 +177,31 @@ func tlsConnect(ctx context.Context, target Target, tlsConfig *tls.Config) (net.
 	u, err := url.Parse("http://" + rawUrl)
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return target.Options.TlsClient.Get(ctx, u, tlsConfig)
+
+	observer := handshakeObserver{}
+	conn, err := target.Options.TlsClient.Get(ctx, u, observer.observe(tlsConfig))
+	observer.mut.Lock()
+	defer observer.mut.Unlock()
+	if err != nil {
+		if observer.request != nil && ctx.Err() == nil {
+			observer.request.Required = true
+			return nil, observer.request, &ClientAuthRequiredError{Request: *observer.request, State: observer.state, Err: err}
+		}
+		return nil, nil, err
+	}
+	return conn, observer.request, nil
 }
 
 func tlsVersionSupported(ctx context.Context, target Target, tlsVersion uint16) DidPass {
+	didPass, _ := tlsVersionProbe(ctx, target, tlsVersion)
+	return didPass
+}
+
+// tlsVersionProbe returns, if the version is supported and the CertificateRequest of the server, if any.
+// a server, which requires a client certificate, does support the version - even though the handshake fails.
+func tlsVersionProbe(ctx context.Context, target Target, tlsVersion uint16) (DidPass, *ClientCertificateRequest) {
 	config := tls.Config{
 		MinVersion:         tlsVersion,
 		MaxVersion:         tlsVersion,
@@ -71,44 +209,42 @@ func tlsVersionSupported(ctx context.Context, target Target, tlsVersion uint16)
 		InsecureSkipVerify: insecureSkipVerify, // nolint // we are just interested in the tls stack - not if the certificate is valid
 	}
 
-	// check if the url does already specify a port _ than we can use it
-	port := target.URL.Port()
-	if port == "" {
-		port = "443"
-	}
-	rawUrl := target.IPV4Address.String() + ":" + port
-	u, err := url.Parse("http://" + rawUrl)
-	if err != nil {
-		return Unknown
-	}
-
-	conn, err := target.Options.TlsClient.Get(ctx, u, &config)
+	conn, request, err := tlsHandshake(ctx, target, &config)
 
 	if errors.Is(err, tlsclient.ErrProxyConnectionFailed) {
 		slog.Info("proxy connection failed")
-		return Unknown
+		return Unknown, nil
 	}
-	if err != nil {
-		// check if timeout
-		if ctx.Err() != nil {
-			return Unknown
+	if handshakeSucceeded(err) {
+		if conn != nil {
+			conn.Close()
 		}
-		return Failure
+		return Success, request
 	}
-	defer conn.Close()
-	return Success
+	// check if timeout
+	if ctx.Err() != nil {
+		return Unknown, nil
+	}
+	return Failure, nil
 }
 
-func tls12Supported(ctx context.Context, target Target) AnalysisResult {
+func tlsVersionSupportedResult(ctx context.Context, target Target, tlsVersion uint16) AnalysisResult {
 	start := time.Now()
-	didPass := tlsVersionSupported(ctx, target, tls.VersionTLS12)
+	didPass, request := tlsVersionProbe(ctx, target, tlsVersion)
+	if request != nil {
+		return NewAnalysisResult(didPass, map[string]any{
+			"clientCertificateRequest": request,
+		}, nil, nil, time.Since(start))
+	}
 	return NewAnalysisResult(didPass, nil, nil, nil, time.Since(start))
 }
 
+func tls12Supported(ctx context.Context, target Target) AnalysisResult {
+	return tlsVersionSupportedResult(ctx, target, tls.VersionTLS12)
+}
+
 func tls13Supported(ctx context.Context, target Target) AnalysisResult {
-	start := time.Now()
-	didPass := tlsVersionSupported(ctx, target, tls.VersionTLS13)
-	return NewAnalysisResult(didPass, nil, nil, nil, time.Since(start))
+	return tlsVersionSupportedResult(ctx, target, tls.VersionTLS13)
 }
 
 func deprecatedTLSDeactivated(ctx context.Context, target Target) AnalysisResult {
@@ -135,6 +271,87 @@ func strongKeyExchange(_ context.Context, _ Target) AnalysisResult {
 	return NewAnalysisResult(Unknown, nil, nil, nil, time.Duration(0))
 }
 
+type keyExchangeGroup struct {
+	id   tls.CurveID
+	name string
+}
+
+// hybrid post-quantum key exchange groups. Those are only available in TLS 1.3.
+// the ids are used directly, since older go versions do not export them.
+// crypto/tls ignores ids it does not implement - therefore the groups are probed using a raw ClientHello.
+// REF: https://www.iana.org/assignments/tls-parameters/tls-parameters.xhtml#tls-parameters-8
+var hybridKeyExchangeGroups = []keyExchangeGroup{
+	{id: tls.CurveID(0x11EC), name: "X25519MLKEM768"},
+	{id: tls.CurveID(0x11EB), name: "SecP256r1MLKEM768"},
+	{id: tls.CurveID(0x11ED), name: "SecP384r1MLKEM1024"},
+}
+
+// keyExchangeGroupSupported offers exactly one key exchange group to the server.
+// the handshake does only succeed, if the server accepts this group.
+func keyExchangeGroupSupported(ctx context.Context, target Target, tlsVersion uint16, group tls.CurveID) DidPass {
+	conn, err := tlsConnect(ctx, target, &tls.Config{
+		ServerName:         target.URL.Hostname(),
+		InsecureSkipVerify: insecureSkipVerify, // nolint // we are just interested in the tls stack - not if the certificate is valid
+		MinVersion:         tlsVersion,
+		MaxVersion:         tlsVersion,
+		CurvePreferences:   []tls.CurveID{group},
+	})
+	if errors.Is(err, tlsclient.ErrProxyConnectionFailed) {
+		return Unknown
+	}
+	if !handshakeSucceeded(err) {
+		if ctx.Err() != nil {
+			return Unknown
+		}
+		return Failure
+	}
+	if conn != nil {
+		conn.Close()
+	}
+	return Success
+}
+
+/*
+INFORMATIONAL CHECK
+
+	(the check does not fail a scan, unless it is marked as required inside a scan profile)
+
+RECOMMENDED: The server negotiates a hybrid post-quantum key exchange group in TLS 1.3
+
+REF: https://www.bsi.bund.de/SharedDocs/Downloads/DE/BSI/Publikationen/Broschueren/Kryptografie-quantensicher-gestalten.html
+*/
+func postQuantumKeyExchange(ctx context.Context, target Target) AnalysisResult {
+	start := time.Now()
+	results := concurrency.All(utils.Map(hybridKeyExchangeGroups, func(group keyExchangeGroup) func() DidPass {
+		return func() DidPass {
+			return probeDidPass(ctx, probeKeyExchangeGroup(ctx, target, group.id))
+		}
+	})...)
+
+	supportedGroups := make([]string, 0)
+	unknown := false
+	for i, didPass := range results {
+		if didPass == Unknown {
+			unknown = true
+			continue
+		}
+		if *didPass {
+			supportedGroups = append(supportedGroups, hybridKeyExchangeGroups[i].name)
+		}
+	}
+
+	actualValue := map[string]any{
+		"supportedGroups": supportedGroups,
+	}
+	if len(supportedGroups) > 0 {
+		return NewAnalysisResult(Success, actualValue, nil, nil, time.Since(start))
+	}
+	if unknown {
+		return NewAnalysisResult(Unknown, actualValue, nil, nil, time.Since(start))
+	}
+	return NewAnalysisResult(Failure, actualValue, nil, nil, time.Since(start))
+}
+
 func strongCipherSuitesSupported(ctx context.Context, target Target, state *tls.ConnectionState) AnalysisResult {
 	start := time.Now()
 	// try to reuse the connection
@@ -152,8 +369,10 @@ func strongCipherSuitesSupported(ctx context.Context, target Target, state *tls.
 		CipherSuites:       tls13StrongCipherSuites,
 	})
 
-	if err == nil {
-		conn.Close()
+	if handshakeSucceeded(err) {
+		if conn != nil {
+			conn.Close()
+		}
 		// it does not support strong ciphers for tls13
 		return NewAnalysisResult(Success, nil, nil, nil, time.Since(start))
 	}
@@ -165,7 +384,7 @@ func strongCipherSuitesSupported(ctx context.Context, target Target, state *tls.
 		MaxVersion:         tls.VersionTLS12,
 		CipherSuites:       tls12StrongCipherSuites,
 	})
-	if err != nil {
+	if !handshakeSucceeded(err) {
 		if ctx.Err() != nil {
 			return NewAnalysisResult(Unknown, nil, nil, nil, time.Since(start))
 		}
@@ -173,7 +392,9 @@ func strongCipherSuitesSupported(ctx context.Context, target Target, state *tls.
 		return NewAnalysisResult(Failure, nil, nil, nil, time.Since(start))
 
 	}
-	conn.Close()
+	if conn != nil {
+		conn.Close()
+	}
 	return NewAnalysisResult(Success, nil, nil, nil, time.Since(start))
 }
 
@@ -192,6 +413,10 @@ func (t tlsAnalyzer) GetAnalysisRuleIds() []AnalysisRuleId {
 		HTTPS,
 		StrongKeyExchange,
 		StrongCipherSuites,
+		PostQuantumKeyExchange,
+		Heartbleed,
+		CCSInjection,
+		ROBOT,
 	}
 }
 
@@ -228,5 +453,9 @@ func (t tlsAnalyzer) Analyze(ctx context.Context, target Target, state *tls.Conn
 		HTTPS:                    NewAnalysisResult(ptr(tls12.IsSuccess() || tls13.IsSuccess() || deprecatedTLSDeactivated.IsError()), nil, nil, nil, time.Duration(0)),
 		StrongKeyExchange:        strongKeyExchange(ctx, target),
 		StrongCipherSuites:       strongCipherSuitesSupported(ctx, target, state),
+		PostQuantumKeyExchange:   maybeDoCheck(PostQuantumKeyExchange, target.Options, func() AnalysisResult { return postQuantumKeyExchange(ctx, target) }),
+		Heartbleed:               maybeDoCheck(Heartbleed, target.Options, func() AnalysisResult { return heartbleed(ctx, target) }),
+		CCSInjection:             maybeDoCheck(CCSInjection, target.Options, func() AnalysisResult { return ccsInjection(ctx, target) }),
+		ROBOT:                    maybeDoCheck(ROBOT, target.Options, func() AnalysisResult { return robot(ctx, target) }),
 	}, nil
 }
@@ -3,14 +3,20 @@ package scanner
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
+	"golang.org/x/crypto/cryptobyte"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/httpclient"
 	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/tlsclient"
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
 )
 
 func TestTLS(t *testing.T) {
@@ -143,3 +149,342 @@ func TestStrongCipherSuites(t *testing.T) {
 
 	}
 }
+
+// returns the key exchange groups of the supported_groups extension of a ClientHello
+func offeredGroups(clientHello []byte) []tls.CurveID {
+	s := cryptobyte.String(clientHello)
+	var sessionID, cipherSuites, compressionMethods, extensions cryptobyte.String
+	if !s.Skip(2+32) ||
+		!s.ReadUint8LengthPrefixed(&sessionID) ||
+		!s.ReadUint16LengthPrefixed(&cipherSuites) ||
+		!s.ReadUint8LengthPrefixed(&compressionMethods) ||
+		!s.ReadUint16LengthPrefixed(&extensions) {
+		return nil
+	}
+	groups := make([]tls.CurveID, 0)
+	for !extensions.Empty() {
+		var id uint16
+		var data, list cryptobyte.String
+		if !extensions.ReadUint16(&id) || !extensions.ReadUint16LengthPrefixed(&data) {
+			return nil
+		}
+		if id != extensionSupportedGroups || !data.ReadUint16LengthPrefixed(&list) {
+			continue
+		}
+		var group uint16
+		for list.ReadUint16(&group) {
+			groups = append(groups, tls.CurveID(group))
+		}
+	}
+	return groups
+}
+
+// a TLS 1.3 server, which answers with a HelloRetryRequest, if one of the offered groups is supported.
+// the groups are not implemented - the test does not depend on the key exchange groups of the toolchain.
+func startKeyExchangeGroupServer(t *testing.T, supportedGroups []tls.CurveID) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				messages, err := readHandshakeMessages(conn, handshakeTypeClientHello)
+				if err != nil {
+					return
+				}
+				offered := offeredGroups(messages[handshakeTypeClientHello])
+				selected := utils.Filter(supportedGroups, func(group tls.CurveID) bool {
+					return utils.Includes(offered, group)
+				})
+				if len(selected) == 0 {
+					// handshake_failure
+					conn.Write(marshalRecord(recordTypeAlert, tls.VersionTLS12, []byte{2, 40})) // nolint // the test fails, if the response is missing
+					return
+				}
+
+				var hello cryptobyte.Builder
+				hello.AddUint8(handshakeTypeServerHello)
+				hello.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+					b.AddUint16(tls.VersionTLS12)
+					// the random of a HelloRetryRequest is fixed (RFC8446 Section 4.1.3) - the probe does not depend on it
+					b.AddBytes(make([]byte, 32))
+					b.AddUint8(0)
+					b.AddUint16(tls.TLS_AES_128_GCM_SHA256)
+					b.AddUint8(0)
+					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+						b.AddUint16(extensionSupportedVersions)
+						b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+							b.AddUint16(tls.VersionTLS13)
+						})
+						b.AddUint16(extensionKeyShare)
+						b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+							b.AddUint16(uint16(selected[0]))
+						})
+					})
+				})
+				conn.Write(marshalRecord(recordTypeHandshake, tls.VersionTLS12, hello.BytesOrPanic())) // nolint // the test fails, if the response is missing
+			}(conn)
+		}
+	}()
+	return "https://" + listener.Addr().String()
+}
+
+func TestPostQuantumKeyExchange(t *testing.T) {
+	table := []struct {
+		supportedGroups []tls.CurveID
+		expected        bool
+		expectedGroups  []string
+	}{
+		{
+			supportedGroups: []tls.CurveID{tls.X25519},
+			expected:        false,
+			expectedGroups:  []string{},
+		},
+		{
+			supportedGroups: []tls.CurveID{tls.X25519, tls.CurveID(0x11EC)},
+			expected:        true,
+			expectedGroups:  []string{"X25519MLKEM768"},
+		},
+		{
+			supportedGroups: []tls.CurveID{tls.CurveID(0x11ED), tls.CurveID(0x11EB)},
+			expected:        true,
+			expectedGroups:  []string{"SecP256r1MLKEM768", "SecP384r1MLKEM1024"},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(fmt.Sprint(test.supportedGroups), func(t *testing.T) {
+			target, _ := url.Parse(startKeyExchangeGroupServer(t, test.supportedGroups))
+
+			inspector := NewTLSAnalyzer()
+			res, _ := inspector.Analyze(context.Background(), Target{URL: target, IPV4Address: net.ParseIP(target.Hostname()), Options: TargetScanOptions{
+				TlsClient: tlsclient.NewDefaultClient(),
+				EnabledChecks: map[AnalysisRuleId]bool{
+					PostQuantumKeyExchange: true,
+				},
+			}}, nil)
+
+			actual := res[PostQuantumKeyExchange]
+			if *actual.DidPass != test.expected {
+				t.Error("Expected to be", test.expected, "but was", *actual.DidPass)
+			}
+			groups := actual.ActualValue.(map[string]any)["supportedGroups"].([]string)
+			if fmt.Sprint(groups) != fmt.Sprint(test.expectedGroups) {
+				t.Error("Expected groups", test.expectedGroups, "but got", groups)
+			}
+		})
+	}
+}
+
+// the raw TLS 1.3 ClientHello is accepted by crypto/tls - the server requests the key share of the offered group
+func TestProbeKeyExchangeGroup(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{
+		MinVersion:       tls.VersionTLS13,
+		CurvePreferences: []tls.CurveID{tls.X25519},
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	target, _ := url.Parse(server.URL)
+	probeTarget := Target{URL: target, IPV4Address: net.ParseIP(target.Hostname()), Options: TargetScanOptions{TlsClient: tlsclient.NewDefaultClient()}}
+
+	if err := probeKeyExchangeGroup(context.Background(), probeTarget, tls.X25519); err != nil {
+		t.Errorf("Expected X25519 to be supported, got %v", err)
+	}
+	if err := probeKeyExchangeGroup(context.Background(), probeTarget, tls.CurveP384); err == nil {
+		t.Error("Expected P-384 to be rejected")
+	}
+}
+
+func TestClientCertificateRequest(t *testing.T) {
+	insecureSkipVerify = true
+	ca := newTestCA(t, "Test Client CA", nil)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	table := []struct {
+		tlsVersion       uint16
+		rule             AnalysisRuleId
+		expectedRequired bool
+	}{
+		{tlsVersion: tls.VersionTLS12, rule: TLS12, expectedRequired: true},
+		// the TLS 1.3 server rejects the missing certificate after the handshake
+		{tlsVersion: tls.VersionTLS13, rule: TLS13, expectedRequired: false},
+	}
+
+	for _, test := range table {
+		t.Run(fmt.Sprint(test.tlsVersion), func(t *testing.T) {
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			server.TLS = &tls.Config{
+				MinVersion: test.tlsVersion,
+				MaxVersion: test.tlsVersion,
+				ClientAuth: tls.RequireAndVerifyClientCert,
+				ClientCAs:  clientCAs,
+			}
+			server.StartTLS()
+			defer server.Close()
+
+			target, _ := url.Parse(server.URL)
+			scanTarget := Target{URL: target, IPV4Address: net.ParseIP(target.Hostname()), Options: TargetScanOptions{
+				TlsClient: tlsclient.NewDefaultClient(),
+				EnabledChecks: map[AnalysisRuleId]bool{
+					TLS12: true,
+					TLS13: true,
+				},
+			}}
+
+			res, _ := NewTLSAnalyzer().Analyze(context.Background(), scanTarget, nil)
+			actual := res[test.rule]
+			if !actual.IsSuccess() {
+				t.Fatalf("Expected %s to be supported, got %+v", test.rule, actual)
+			}
+			request, ok := actual.ActualValue.(map[string]any)["clientCertificateRequest"].(*ClientCertificateRequest)
+			if !ok {
+				t.Fatalf("Expected the client certificate request to be reported, got %v", actual.ActualValue)
+			}
+			if request.Required != test.expectedRequired {
+				t.Errorf("Expected required to be %v, got %v", test.expectedRequired, request.Required)
+			}
+			if !utils.Includes(request.AcceptableCAs, "CN=Test Client CA") {
+				t.Errorf("Expected the acceptable CAs to contain the client CA, got %v", request.AcceptableCAs)
+			}
+
+			// the server certificate is available, even though the handshake failed
+			_, err := tlsConnect(context.Background(), scanTarget, &tls.Config{
+				MinVersion:         test.tlsVersion,
+				MaxVersion:         test.tlsVersion,
+				InsecureSkipVerify: true, // nolint // the test server uses a self signed certificate
+			})
+			if test.expectedRequired {
+				state := clientAuthRequiredState(err)
+				if state == nil || len(state.PeerCertificates) == 0 {
+					t.Errorf("Expected the connection state of the failed handshake, got %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestAnalyzeWithoutResponseClientAuthRequired(t *testing.T) {
+	insecureSkipVerify = true
+	ca := newTestCA(t, "Test Client CA", nil)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	for _, tlsVersion := range []uint16{tls.VersionTLS12, tls.VersionTLS13} {
+		t.Run(fmt.Sprint(tlsVersion), func(t *testing.T) {
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			server.TLS = &tls.Config{
+				MaxVersion: tlsVersion,
+				ClientAuth: tls.RequireAnyClientCert,
+				ClientCAs:  clientCAs,
+			}
+			server.StartTLS()
+			defer server.Close()
+
+			target, _ := url.Parse(server.URL)
+			httpClient := httpclient.NewRedirectAwareHttpClient(&http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // nolint // the test server uses a self signed certificate
+			})
+			scanTarget := Target{URL: target, IPV4Address: net.ParseIP(target.Hostname()), Options: TargetScanOptions{
+				TlsClient:  tlsclient.NewDefaultClient(),
+				HttpClient: httpClient,
+				EnabledChecks: map[AnalysisRuleId]bool{
+					HSTS:             true,
+					TLS12:            true,
+					ValidCertificate: true,
+				},
+			}}
+			_, err := httpClient.Get(context.Background(), target)
+			if err == nil {
+				t.Fatal("Expected the http request to fail without a client certificate")
+			}
+
+			s := scanner{
+				httpAnalyzers: NewAnalyzerGroup(NewHeaderAnalyzer()),
+				netAnalyzers:  NewAnalyzerGroup[any](),
+				tlsAnalyzers:  NewAnalyzerGroup(NewTLSAnalyzer()),
+			}
+			res, _, request := s.analyzeWithoutResponse(context.Background(), scanTarget, err)
+			if request == nil || !request.Required {
+				t.Fatalf("Expected the client certificate to be required, got %+v", request)
+			}
+
+			hsts := res[HSTS]
+			if hsts.DidPass != nil || !utils.Includes(hsts.Errors, ClientAuthRequired) {
+				t.Fatalf("Expected %s to be marked as %s, got %+v", HSTS, ClientAuthRequired, hsts)
+			}
+			reported := hsts.ActualValue.(map[string]any)["clientCertificateRequest"].(*ClientCertificateRequest)
+			if !utils.Includes(reported.AcceptableCAs, "CN=Test Client CA") {
+				t.Errorf("Expected the acceptable CAs to contain the client CA, got %v", reported.AcceptableCAs)
+			}
+			// the tls checks can be done without a client certificate
+			if tls12 := res[TLS12]; !tls12.IsSuccess() || utils.Includes(tls12.Errors, ClientAuthRequired) {
+				t.Errorf("Expected %s to be supported, got %+v", TLS12, tls12)
+			}
+			// disabled checks are not marked
+			if utils.Includes(res[XFrameOptions].Errors, ClientAuthRequired) {
+				t.Errorf("Expected the disabled check %s not to be marked", XFrameOptions)
+			}
+		})
+	}
+}
+
+// the server requests an optional client certificate - the failed http request is not caused by the missing certificate
+func TestAnalyzeWithoutResponseOptionalClientAuth(t *testing.T) {
+	insecureSkipVerify = true
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	target, _ := url.Parse(server.URL)
+	httpClient := httpclient.NewRedirectAwareHttpClient(&http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // nolint // the test server uses a self signed certificate
+	})
+	scanTarget := Target{URL: target, IPV4Address: net.ParseIP(target.Hostname()), Options: TargetScanOptions{
+		TlsClient:  tlsclient.NewDefaultClient(),
+		HttpClient: httpClient,
+		EnabledChecks: map[AnalysisRuleId]bool{
+			HSTS:  true,
+			TLS12: true,
+		},
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := httpClient.Get(ctx, target)
+	if err == nil {
+		t.Fatal("Expected the http request to time out")
+	}
+
+	s := scanner{
+		httpAnalyzers: NewAnalyzerGroup(NewHeaderAnalyzer()),
+		netAnalyzers:  NewAnalyzerGroup[any](),
+		tlsAnalyzers:  NewAnalyzerGroup(NewTLSAnalyzer()),
+	}
+	res, _, request := s.analyzeWithoutResponse(context.Background(), scanTarget, err)
+	if request == nil || request.Required {
+		t.Fatalf("Expected an optional client certificate request, got %+v", request)
+	}
+	if utils.Includes(res[HSTS].Errors, ClientAuthRequired) {
+		t.Errorf("Expected %s not to be marked as %s, got %+v", HSTS, ClientAuthRequired, res[HSTS])
+	}
+}
@@ -0,0 +1,410 @@
+package scanner
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"time"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// crypto/tls neither offers nor exposes several extensions (e.g. heartbeat or truncated_hmac).
+// therefore the probes in this file build the ClientHello themselves and just parse the ServerHello.
+// the handshake is never completed.
+
+// REF: https://www.iana.org/assignments/tls-extensiontype-values/tls-extensiontype-values.xhtml
+const (
+	extensionServerName           uint16 = 0
+	extensionTruncatedHMAC        uint16 = 4
+	extensionSupportedGroups      uint16 = 10
+	extensionECPointFormats       uint16 = 11
+	extensionSignatureAlgorithms  uint16 = 13
+	extensionHeartbeat            uint16 = 15
+	extensionEncryptThenMAC       uint16 = 22
+	extensionExtendedMasterSecret uint16 = 23
+	extensionSupportedVersions    uint16 = 43
+	extensionKeyShare             uint16 = 51
+	extensionRenegotiationInfo    uint16 = 0xff01
+)
+
+const (
+	recordTypeChangeCipherSpec uint8 = 20
+	recordTypeAlert            uint8 = 21
+	recordTypeHandshake        uint8 = 22
+	recordTypeHeartbeat        uint8 = 24
+
+	handshakeTypeClientHello       uint8 = 1
+	handshakeTypeServerHello       uint8 = 2
+	handshakeTypeCertificate       uint8 = 11
+	handshakeTypeServerHelloDone   uint8 = 14
+	handshakeTypeClientKeyExchange uint8 = 16
+)
+
+var errHandshakeAlert = errors.New("server responded with an alert")
+var errUnparsableCertificate = errors.New("certificate of the server could not be parsed")
+
+// the cipher suites offered by the raw ClientHello.
+// the list contains every suite golang knows about - the server should be able to pick one of them.
+var probeCipherSuites = func() []uint16 {
+	suites := make([]uint16, 0)
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		if !utils.Includes(suite.SupportedVersions, tls.VersionTLS13) {
+			suites = append(suites, suite.ID)
+		}
+	}
+	return suites
+}()
+
+// the cipher suites offered by the raw TLS 1.3 ClientHello
+var tls13ProbeCipherSuites = []uint16{tls.TLS_AES_128_GCM_SHA256, tls.TLS_AES_256_GCM_SHA384, tls.TLS_CHACHA20_POLY1305_SHA256}
+
+type clientHelloExtension struct {
+	id   uint16
+	data []byte
+}
+
+type serverHello struct {
+	version     uint16
+	cipherSuite uint16
+	extensions  map[uint16][]byte
+}
+
+func (s serverHello) hasExtension(id uint16) bool {
+	_, ok := s.extensions[id]
+	return ok
+}
+
+// the default extensions of the raw ClientHello - they are required by most servers to answer at all
+func defaultClientHelloExtensions(serverName string) []clientHelloExtension {
+	var sni cryptobyte.Builder
+	sni.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint8(0) // host_name
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes([]byte(serverName))
+		})
+	})
+	var signatureAlgorithms cryptobyte.Builder
+	signatureAlgorithms.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		for _, scheme := range []tls.SignatureScheme{
+			tls.ECDSAWithP256AndSHA256, tls.ECDSAWithP384AndSHA384, tls.ECDSAWithP521AndSHA512,
+			tls.PSSWithSHA256, tls.PSSWithSHA384, tls.PSSWithSHA512,
+			tls.PKCS1WithSHA256, tls.PKCS1WithSHA384, tls.PKCS1WithSHA512, tls.PKCS1WithSHA1,
+		} {
+			b.AddUint16(uint16(scheme))
+		}
+	})
+
+	extensions := []clientHelloExtension{
+		{id: extensionSupportedGroups, data: marshalSupportedGroups([]tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384, tls.CurveP521})},
+		// uncompressed
+		{id: extensionECPointFormats, data: []byte{1, 0}},
+		{id: extensionSignatureAlgorithms, data: signatureAlgorithms.BytesOrPanic()},
+	}
+	// an ip address must not be used as server name (RFC6066 Section 3)
+	if serverName != "" && net.ParseIP(serverName) == nil {
+		extensions = append(extensions, clientHelloExtension{id: extensionServerName, data: sni.BytesOrPanic()})
+	}
+	return extensions
+}
+
+func marshalSupportedGroups(groups []tls.CurveID) []byte {
+	var b cryptobyte.Builder
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		for _, group := range groups {
+			b.AddUint16(uint16(group))
+		}
+	})
+	return b.BytesOrPanic()
+}
+
+// marshals a TLS 1.2 ClientHello inside a single handshake record
+func marshalClientHello(cipherSuites []uint16, extensions []clientHelloExtension) ([]byte, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+
+	var b cryptobyte.Builder
+	b.AddUint8(recordTypeHandshake)
+	// the record layer version is TLS 1.0 for compatibility (RFC5246 Appendix E.1)
+	b.AddUint16(tls.VersionTLS10)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint8(handshakeTypeClientHello)
+		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddUint16(tls.VersionTLS12)
+			b.AddBytes(random)
+			// empty session id
+			b.AddUint8(0)
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				for _, suite := range cipherSuites {
+					b.AddUint16(suite)
+				}
+			})
+			// null compression
+			b.AddUint8(1)
+			b.AddUint8(0)
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				for _, extension := range extensions {
+					b.AddUint16(extension.id)
+					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+						b.AddBytes(extension.data)
+					})
+				}
+			})
+		})
+	})
+	return b.Bytes()
+}
+
+type tlsRecord struct {
+	contentType uint8
+	fragment    []byte
+}
+
+func readRecord(r io.Reader) (tlsRecord, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return tlsRecord{}, err
+	}
+	length := int(header[3])<<8 | int(header[4])
+	fragment := make([]byte, length)
+	if _, err := io.ReadFull(r, fragment); err != nil {
+		return tlsRecord{}, err
+	}
+	return tlsRecord{contentType: header[0], fragment: fragment}, nil
+}
+
+// reads the handshake messages of the server until the message of the provided type is complete.
+// the messages are returned by their type.
+func readHandshakeMessages(r io.Reader, until uint8) (map[uint8][]byte, error) {
+	messages := make(map[uint8][]byte)
+	handshake := make([]byte, 0)
+	for {
+		record, err := readRecord(r)
+		if err != nil {
+			return nil, err
+		}
+
+		switch record.contentType {
+		case recordTypeAlert:
+			return nil, errHandshakeAlert
+		case recordTypeHandshake:
+			handshake = append(handshake, record.fragment...)
+		default:
+			return nil, fmt.Errorf("unexpected record type %d", record.contentType)
+		}
+
+		// a record might contain multiple messages and a message might be fragmented across multiple records
+		for len(handshake) >= 4 {
+			messageLength := int(handshake[1])<<16 | int(handshake[2])<<8 | int(handshake[3])
+			if len(handshake) < 4+messageLength {
+				break
+			}
+			messageType := handshake[0]
+			messages[messageType] = handshake[4 : 4+messageLength]
+			handshake = handshake[4+messageLength:]
+			if messageType == until {
+				return messages, nil
+			}
+		}
+	}
+}
+
+// reads the records from the connection until the ServerHello handshake message is complete
+func readServerHello(r io.Reader) (serverHello, error) {
+	messages, err := readHandshakeMessages(r, handshakeTypeServerHello)
+	if err != nil {
+		return serverHello{}, err
+	}
+	return parseServerHello(messages[handshakeTypeServerHello])
+}
+
+func parseServerHello(message []byte) (serverHello, error) {
+	s := cryptobyte.String(message)
+	hello := serverHello{
+		extensions: make(map[uint16][]byte),
+	}
+	var random, sessionID cryptobyte.String
+	var compression uint8
+	if !s.ReadUint16(&hello.version) ||
+		!s.ReadBytes((*[]byte)(&random), 32) ||
+		!s.ReadUint8LengthPrefixed(&sessionID) ||
+		!s.ReadUint16(&hello.cipherSuite) ||
+		!s.ReadUint8(&compression) {
+		return serverHello{}, errors.New("malformed server hello")
+	}
+	// the extensions are optional
+	if s.Empty() {
+		return hello, nil
+	}
+	var extensions cryptobyte.String
+	if !s.ReadUint16LengthPrefixed(&extensions) {
+		return serverHello{}, errors.New("malformed server hello extensions")
+	}
+	for !extensions.Empty() {
+		var id uint16
+		var data cryptobyte.String
+		if !extensions.ReadUint16(&id) || !extensions.ReadUint16LengthPrefixed(&data) {
+			return serverHello{}, errors.New("malformed server hello extension")
+		}
+		hello.extensions[id] = data
+	}
+	return hello, nil
+}
+
+// opens a plain tcp connection to the target - the tls handshake needs to be done by the caller
+func tlsDial(ctx context.Context, target Target) (net.Conn, error) {
+	port := target.URL.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	u, err := url.Parse("http://" + target.IPV4Address.String() + ":" + port)
+	if err != nil {
+		return nil, err
+	}
+	return target.Options.TlsClient.Dial(ctx, u)
+}
+
+// opens a connection and sends a raw TLS 1.2 ClientHello with the default and the provided extensions.
+// a provided extension replaces the default extension with the same id.
+// the caller needs to close the connection.
+func sendClientHello(ctx context.Context, target Target, cipherSuites []uint16, extensions []clientHelloExtension) (net.Conn, error) {
+	defaults := utils.Filter(defaultClientHelloExtensions(target.URL.Hostname()), func(d clientHelloExtension) bool {
+		return !utils.Some(extensions, func(e clientHelloExtension) bool {
+			return e.id == d.id
+		})
+	})
+	clientHello, err := marshalClientHello(cipherSuites, append(defaults, extensions...))
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := tlsDial(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(10 * time.Second)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if _, err := conn.Write(clientHello); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// sends a raw TLS 1.2 ClientHello with the default and the provided extensions and returns the ServerHello
+func probeServerHello(ctx context.Context, target Target, cipherSuites []uint16, extensions []clientHelloExtension) (serverHello, error) {
+	conn, err := sendClientHello(ctx, target, cipherSuites, extensions)
+	if err != nil {
+		return serverHello{}, err
+	}
+	defer conn.Close()
+	return readServerHello(conn)
+}
+
+// sends a raw TLS 1.3 ClientHello, which offers the provided key exchange group without a key share.
+// a server, which supports the group, requests the key share using a HelloRetryRequest (RFC8446 Section 4.2.8).
+// the handshake is never completed - therefore the key exchange of the group does not need to be implemented.
+func probeKeyExchangeGroup(ctx context.Context, target Target, group tls.CurveID) error {
+	hello, err := probeServerHello(ctx, target, tls13ProbeCipherSuites, []clientHelloExtension{
+		{id: extensionSupportedGroups, data: marshalSupportedGroups([]tls.CurveID{group})},
+		{id: extensionSupportedVersions, data: []byte{2, 0x03, 0x04}},
+		// empty client_shares
+		{id: extensionKeyShare, data: []byte{0, 0}},
+	})
+	if err != nil {
+		return err
+	}
+	version := cryptobyte.String(hello.extensions[extensionSupportedVersions])
+	var selectedVersion uint16
+	if !version.ReadUint16(&selectedVersion) || selectedVersion != tls.VersionTLS13 {
+		return errors.New("server did not negotiate TLS 1.3")
+	}
+	// the key share of a HelloRetryRequest just contains the selected group - the key share of a ServerHello starts with it
+	keyShare := cryptobyte.String(hello.extensions[extensionKeyShare])
+	var selectedGroup uint16
+	if !keyShare.ReadUint16(&selectedGroup) {
+		return errors.New("server did not select a key exchange group")
+	}
+	if tls.CurveID(selectedGroup) != group {
+		return fmt.Errorf("server selected the key exchange group %d, which was not offered", selectedGroup)
+	}
+	return nil
+}
+
+// sends a raw TLS 1.2 ClientHello and returns the DER encoded certificates of the Certificate message.
+// the certificates are not parsed - the probe works for certificates, which crypto/tls rejects.
+// a server, which only supports TLS 1.3, encrypts the Certificate message and can not be probed.
+func probeCertificates(ctx context.Context, target Target) ([][]byte, error) {
+	conn, err := sendClientHello(ctx, target, probeCipherSuites, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	messages, err := readHandshakeMessages(conn, handshakeTypeCertificate)
+	if err != nil {
+		return nil, err
+	}
+	return parseCertificateMessage(messages[handshakeTypeCertificate])
+}
+
+// fetches the leaf certificate using a raw handshake.
+// the leaf is returned together with an error wrapping errUnparsableCertificate, if crypto/x509 is not able to parse it.
+func probeUnparsableCertificate(ctx context.Context, target Target) ([]byte, error) {
+	certificates, err := probeCertificates(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := x509.ParseCertificate(certificates[0]); err != nil {
+		return certificates[0], fmt.Errorf("%w: %w", errUnparsableCertificate, err)
+	}
+	return certificates[0], nil
+}
+
+func parseCertificateMessage(message []byte) ([][]byte, error) {
+	s := cryptobyte.String(message)
+	var certificateList cryptobyte.String
+	if !s.ReadUint24LengthPrefixed(&certificateList) || !s.Empty() {
+		return nil, errors.New("malformed certificate message")
+	}
+	certificates := make([][]byte, 0)
+	for !certificateList.Empty() {
+		var certificate cryptobyte.String
+		if !certificateList.ReadUint24LengthPrefixed(&certificate) {
+			return nil, errors.New("malformed certificate")
+		}
+		certificates = append(certificates, certificate)
+	}
+	if len(certificates) == 0 {
+		return nil, errors.New("server did not send a certificate")
+	}
+	return certificates, nil
+}
+
+// marshals a single record using the negotiated version
+func marshalRecord(contentType uint8, version uint16, fragment []byte) []byte {
+	var b cryptobyte.Builder
+	b.AddUint8(contentType)
+	b.AddUint16(version)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(fragment)
+	})
+	return b.BytesOrPanic()
+}
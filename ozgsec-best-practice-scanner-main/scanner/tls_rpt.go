@@ -0,0 +1,101 @@
+package scanner
+
+import (
+	"context"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+const (
+	TLSRPTMultipleRecords  = "tlsRptMultipleRecords"
+	TLSRPTSyntaxError      = "tlsRptSyntaxError"
+	TLSRPTInvalidReportURI = "tlsRptInvalidReportURI"
+)
+
+// checks a rua uri of a TLS-RPT record - only mailto and https are allowed (RFC8460 Section 3)
+func validTLSRPTReportURI(uri string) bool {
+	if address, isMailto := strings.CutPrefix(uri, "mailto:"); isMailto {
+		_, err := mail.ParseAddress(address)
+		return err == nil
+	}
+	parsed, err := url.Parse(uri)
+	return err == nil && parsed.Scheme == "https" && parsed.Host != ""
+}
+
+// parses a TLS-RPT record and returns the report uris together with the errors (as error ids)
+func parseTLSRPTRecord(record string) ([]string, []string) {
+	fields := utils.Map(strings.Split(record, ";"), strings.TrimSpace)
+	// the version needs to be the first field
+	if fields[0] != "v=TLSRPTv1" {
+		return nil, []string{TLSRPTSyntaxError}
+	}
+	var uris []string
+	for _, field := range fields[1:] {
+		if field == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, []string{TLSRPTSyntaxError}
+		}
+		// other fields are extensions and are ignored
+		if strings.TrimSpace(name) == "rua" {
+			uris = utils.Map(strings.Split(value, ","), strings.TrimSpace)
+		}
+	}
+	if len(uris) == 0 {
+		return nil, []string{TLSRPTSyntaxError}
+	}
+	if !utils.Every(uris, validTLSRPTReportURI) {
+		return uris, []string{TLSRPTInvalidReportURI}
+	}
+	return uris, nil
+}
+
+/*
+REQUIRED: The domain publishes exactly one valid "_smtp._tls" TXT record (RFC8460 Section 3)
+
+	The record starts with "v=TLSRPTv1" and contains a rua field with at least one mailto: or https: uri.
+
+Source: https://www.rfc-editor.org/rfc/rfc8460
+*/
+func (d domainAnalyzer) tlsRPT(ctx context.Context, target Target) AnalysisResult {
+	start := time.Now()
+	domain := mailDomain(target)
+
+	msg, err := d.exchange(ctx, "_smtp._tls."+domain, dns.TypeTXT)
+	if err != nil {
+		return NewAnalysisResult(Unknown, nil, nil, nil, time.Since(start))
+	}
+	records := make([]string, 0)
+	for _, answer := range msg.Answer {
+		if txt, ok := answer.(*dns.TXT); ok && strings.HasPrefix(txtRecordValue(txt), "v=TLSRPTv1") {
+			records = append(records, txtRecordValue(txt))
+		}
+	}
+	if len(records) == 0 {
+		return NewAnalysisResult(Failure, nil, nil, nil, time.Since(start))
+	}
+	if len(records) > 1 {
+		// multiple records disable the reporting (RFC8460 Section 3)
+		return NewAnalysisResult(Failure, map[string]any{
+			"records": records,
+		}, []string{TLSRPTMultipleRecords}, nil, time.Since(start))
+	}
+
+	uris, errors := parseTLSRPTRecord(records[0])
+	actualValue := map[string]any{
+		"record": records[0],
+		"rua":    uris,
+	}
+	if len(errors) > 0 {
+		return NewAnalysisResult(Failure, actualValue, errors, nil, time.Since(start))
+	}
+	return NewAnalysisResult(Success, actualValue, nil, nil, time.Since(start))
+}
@@ -0,0 +1,66 @@
+package scanner
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+func TestTLSRPT(t *testing.T) {
+	table := []struct {
+		name            string
+		records         []string
+		expectedDidPass DidPass
+		expectedErrors  []string
+	}{
+		{
+			name:            "mailto and https",
+			records:         []string{"v=TLSRPTv1; rua=mailto:tlsrpt@example.test,https://reports.example.test/tlsrpt"},
+			expectedDidPass: Success,
+		},
+		{
+			name:            "missing record",
+			expectedDidPass: Failure,
+		},
+		{
+			name:            "multiple records",
+			records:         []string{"v=TLSRPTv1; rua=mailto:tlsrpt@example.test", "v=TLSRPTv1; rua=mailto:other@example.test"},
+			expectedDidPass: Failure,
+			expectedErrors:  []string{TLSRPTMultipleRecords},
+		},
+		{
+			name:            "missing rua",
+			records:         []string{"v=TLSRPTv1;"},
+			expectedDidPass: Failure,
+			expectedErrors:  []string{TLSRPTSyntaxError},
+		},
+		{
+			name:            "http uri",
+			records:         []string{"v=TLSRPTv1; rua=http://reports.example.test/tlsrpt"},
+			expectedDidPass: Failure,
+			expectedErrors:  []string{TLSRPTInvalidReportURI},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			d := domainAnalyzer{
+				client:   new(dns.Client),
+				resolver: startTestResolver(t, testTXTRecords(t, map[string][]string{"_smtp._tls.example.test": test.records}), nil),
+			}
+			target, _ := url.Parse("https://www.example.test")
+			actual := d.tlsRPT(context.Background(), Target{URL: target})
+
+			if test.expectedDidPass == Success && !actual.IsSuccess() || test.expectedDidPass == Failure && !actual.IsError() {
+				t.Fatalf("Expected %v, got %+v", *test.expectedDidPass, actual)
+			}
+			if len(actual.Errors) != len(test.expectedErrors) || !utils.IncludesSubset(actual.Errors, test.expectedErrors) {
+				t.Errorf("Expected errors %v, got %v", test.expectedErrors, actual.Errors)
+			}
+		})
+	}
+}
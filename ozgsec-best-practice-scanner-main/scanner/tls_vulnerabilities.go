@@ -0,0 +1,393 @@
+package scanner
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/concurrency"
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+// the probes in this file test for classic flaws of TLS implementations.
+// they are non-destructive: no memory of the server is reported and no handshake is completed.
+// the probes are disabled by default - they need to be listed in the enabled checks.
+
+// the time to wait for the response of the server to a probe
+const vulnerabilityProbeResponseTimeout = 3 * time.Second
+
+// TLS alert descriptions (RFC5246 Section 7.2)
+const (
+	alertBadRecordMAC     uint8 = 20
+	alertDecryptionFailed uint8 = 21
+)
+
+// the cipher suites using the RSA key exchange - only those are affected by ROBOT
+var rsaKeyExchangeCipherSuites = []uint16{
+	0x009C, // TLS_RSA_WITH_AES_128_GCM_SHA256
+	0x009D, // TLS_RSA_WITH_AES_256_GCM_SHA384
+	0x003C, // TLS_RSA_WITH_AES_128_CBC_SHA256
+	0x003D, // TLS_RSA_WITH_AES_256_CBC_SHA256
+	0x002F, // TLS_RSA_WITH_AES_128_CBC_SHA
+	0x0035, // TLS_RSA_WITH_AES_256_CBC_SHA
+	0x000A, // TLS_RSA_WITH_3DES_EDE_CBC_SHA
+}
+
+func concatBytes(parts ...[]byte) []byte {
+	res := make([]byte, 0)
+	for _, part := range parts {
+		res = append(res, part...)
+	}
+	return res
+}
+
+// sends the ClientHello and reads the messages of the server up to the ServerHelloDone
+func startHandshake(ctx context.Context, target Target, cipherSuites []uint16, extensions []clientHelloExtension) (net.Conn, serverHello, map[uint8][]byte, error) {
+	conn, err := sendClientHello(ctx, target, cipherSuites, extensions)
+	if err != nil {
+		return nil, serverHello{}, nil, err
+	}
+	messages, err := readHandshakeMessages(conn, handshakeTypeServerHelloDone)
+	if err != nil {
+		conn.Close()
+		return nil, serverHello{}, nil, err
+	}
+	hello, err := parseServerHello(messages[handshakeTypeServerHello])
+	if err != nil {
+		conn.Close()
+		return nil, serverHello{}, nil, err
+	}
+	return conn, hello, messages, nil
+}
+
+// describes the records the server sends in response to a probe (e.g. [alert(2,10) closed]).
+// the content of the records is never reported.
+func observeResponse(conn net.Conn) []string {
+	if err := conn.SetReadDeadline(time.Now().Add(vulnerabilityProbeResponseTimeout)); err != nil {
+		return []string{"error"}
+	}
+	events := make([]string, 0)
+	// limit the number of records - the server might send a lot of data
+	for i := 0; i < 4; i++ {
+		record, err := readRecord(conn)
+		var netErr net.Error
+		switch {
+		case errors.As(err, &netErr) && netErr.Timeout():
+			return append(events, "timeout")
+		case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+			return append(events, "closed")
+		case errors.Is(err, syscall.ECONNRESET):
+			return append(events, "reset")
+		case err != nil:
+			return append(events, "error")
+		}
+
+		switch record.contentType {
+		case recordTypeAlert:
+			if len(record.fragment) == 2 {
+				events = append(events, fmt.Sprintf("alert(%d,%d)", record.fragment[0], record.fragment[1]))
+			} else {
+				// an encrypted alert
+				events = append(events, "alert")
+			}
+		case recordTypeHeartbeat:
+			events = append(events, fmt.Sprintf("heartbeat(%d)", len(record.fragment)))
+		default:
+			events = append(events, fmt.Sprintf("record(%d)", record.contentType))
+		}
+	}
+	return events
+}
+
+/*
+REQUIRED: The server is not vulnerable to Heartbleed (CVE-2014-0160)
+
+	A heartbeat request is sent right after the ServerHelloDone. The request claims a payload of 16 bytes but does not contain any payload.
+	A patched server discards the request. A vulnerable server responds with 16 bytes of its memory - those bytes are never reported.
+	A server, which does not negotiate the heartbeat extension, is not vulnerable.
+
+Source: https://heartbleed.com/
+*/
+func heartbleed(ctx context.Context, target Target) AnalysisResult {
+	start := time.Now()
+	// do not probe the bsi - our ip will be blocked
+	if bsiNet.Contains(target.IPV4Address) {
+		return NewAnalysisResult(Unknown, nil, nil, nil, time.Since(start))
+	}
+
+	conn, hello, _, err := startHandshake(ctx, target, probeCipherSuites, []clientHelloExtension{
+		// peer_allowed_to_send (RFC6520 Section 2)
+		{id: extensionHeartbeat, data: []byte{1}},
+	})
+	if err != nil {
+		return NewAnalysisResult(Unknown, map[string]any{"error": err.Error()}, nil, nil, time.Since(start))
+	}
+	defer conn.Close()
+
+	if !hello.hasExtension(extensionHeartbeat) {
+		return NewAnalysisResult(Success, map[string]any{
+			"heartbeatExtension": false,
+		}, nil, nil, time.Since(start))
+	}
+
+	// heartbeat_request with a payload_length of 16 - but without any payload
+	if _, err := conn.Write(marshalRecord(recordTypeHeartbeat, hello.version, []byte{1, 0x00, 0x10})); err != nil {
+		return NewAnalysisResult(Unknown, map[string]any{"error": err.Error()}, nil, nil, time.Since(start))
+	}
+	response := observeResponse(conn)
+	actualValue := map[string]any{
+		"heartbeatExtension": true,
+		"response":           response,
+	}
+	if utils.Some(response, func(event string) bool { return strings.HasPrefix(event, "heartbeat") }) {
+		return NewAnalysisResult(Failure, actualValue, nil, nil, time.Since(start))
+	}
+	return NewAnalysisResult(Success, actualValue, nil, nil, time.Since(start))
+}
+
+/*
+REQUIRED: The server is not vulnerable to the OpenSSL CCS injection (CVE-2014-0224)
+
+	Two ChangeCipherSpec messages are sent right after the ServerHelloDone - before any key was exchanged.
+	A server, which is not vulnerable, rejects the early ChangeCipherSpec (e.g. with an unexpected_message alert).
+	A vulnerable server accepts it and fails to decrypt the second message (bad_record_mac or decryption_failed).
+
+Source: https://www.openssl.org/news/secadv/20140605.txt
+*/
+func ccsInjection(ctx context.Context, target Target) AnalysisResult {
+	start := time.Now()
+	// do not probe the bsi - our ip will be blocked
+	if bsiNet.Contains(target.IPV4Address) {
+		return NewAnalysisResult(Unknown, nil, nil, nil, time.Since(start))
+	}
+
+	conn, hello, _, err := startHandshake(ctx, target, probeCipherSuites, nil)
+	if err != nil {
+		return NewAnalysisResult(Unknown, map[string]any{"error": err.Error()}, nil, nil, time.Since(start))
+	}
+	defer conn.Close()
+
+	changeCipherSpec := marshalRecord(recordTypeChangeCipherSpec, hello.version, []byte{1})
+	if _, err := conn.Write(changeCipherSpec); err != nil {
+		return NewAnalysisResult(Unknown, map[string]any{"error": err.Error()}, nil, nil, time.Since(start))
+	}
+	// the server might already have closed the connection after the first message
+	conn.Write(changeCipherSpec) // nolint // the response of the server is evaluated
+
+	response := observeResponse(conn)
+	actualValue := map[string]any{
+		"response": response,
+	}
+	if utils.Includes(response, fmt.Sprintf("alert(2,%d)", alertBadRecordMAC)) || utils.Includes(response, fmt.Sprintf("alert(2,%d)", alertDecryptionFailed)) {
+		return NewAnalysisResult(Failure, actualValue, nil, nil, time.Since(start))
+	}
+	// the server did not react at all - it is not possible to tell, if it accepted the message
+	if utils.Every(response, func(event string) bool { return event == "timeout" }) {
+		return NewAnalysisResult(Unknown, actualValue, nil, nil, time.Since(start))
+	}
+	return NewAnalysisResult(Success, actualValue, nil, nil, time.Since(start))
+}
+
+type robotVariant struct {
+	name string
+	// builds the plaintext of the premaster secret using the padding (modulus size - 51 bytes, without zero bytes) and 46 random bytes
+	plaintext func(padding, random []byte) []byte
+}
+
+// the premaster secret variants of the ROBOT paper.
+// REF: https://robotattack.org/ and https://github.com/robotattackorg/robot-detect
+var robotVariants = []robotVariant{
+	{name: "correct", plaintext: func(padding, random []byte) []byte {
+		return concatBytes([]byte{0x00, 0x02}, padding, []byte{0x00, 0x03, 0x03}, random)
+	}},
+	{name: "wrongFirstBytes", plaintext: func(padding, random []byte) []byte {
+		return concatBytes([]byte{0x41, 0x17}, padding, []byte{0x00, 0x03, 0x03}, random)
+	}},
+	{name: "wrongZeroPosition", plaintext: func(padding, random []byte) []byte {
+		return concatBytes([]byte{0x00, 0x02}, padding, []byte{0x11}, random, []byte{0x00, 0x11})
+	}},
+	{name: "missingZero", plaintext: func(padding, random []byte) []byte {
+		return concatBytes([]byte{0x00, 0x02}, padding, []byte{0x11, 0x11, 0x11}, random)
+	}},
+	{name: "wrongVersion", plaintext: func(padding, random []byte) []byte {
+		return concatBytes([]byte{0x00, 0x02}, padding, []byte{0x00, 0x02, 0x02}, random)
+	}},
+}
+
+// parses the public key of the leaf certificate of a Certificate message
+func rsaPublicKey(certificateMessage []byte) (*rsa.PublicKey, error) {
+	s := cryptobyte.String(certificateMessage)
+	var certificates, certificate cryptobyte.String
+	if !s.ReadUint24LengthPrefixed(&certificates) || !certificates.ReadUint24LengthPrefixed(&certificate) {
+		return nil, errors.New("malformed certificate message")
+	}
+	cert, err := x509.ParseCertificate(certificate)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("certificate does not contain a rsa key")
+	}
+	return key, nil
+}
+
+func nonZeroRandomBytes(length int) ([]byte, error) {
+	res := make([]byte, length)
+	if _, err := rand.Read(res); err != nil {
+		return nil, err
+	}
+	for i := range res {
+		for res[i] == 0 {
+			if _, err := rand.Read(res[i : i+1]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return res, nil
+}
+
+// sends the premaster secret of the variant (encrypted without padding) and returns the response of the server.
+// if the message flow is shortened, neither the ChangeCipherSpec nor the Finished message are sent.
+func robotProbe(ctx context.Context, target Target, variant robotVariant, shortened bool) (string, error) {
+	conn, hello, messages, err := startHandshake(ctx, target, rsaKeyExchangeCipherSuites, nil)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	key, err := rsaPublicKey(messages[handshakeTypeCertificate])
+	if err != nil {
+		return "", err
+	}
+	if key.Size() < 64 {
+		return "", errors.New("rsa key is too small")
+	}
+	padding, err := nonZeroRandomBytes(key.Size() - 51)
+	if err != nil {
+		return "", err
+	}
+	random := make([]byte, 46)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	m := new(big.Int).SetBytes(variant.plaintext(padding, random))
+	c := new(big.Int).Exp(m, big.NewInt(int64(key.E)), key.N)
+
+	var clientKeyExchange cryptobyte.Builder
+	clientKeyExchange.AddUint8(handshakeTypeClientKeyExchange)
+	clientKeyExchange.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(c.FillBytes(make([]byte, key.Size())))
+		})
+	})
+
+	records := marshalRecord(recordTypeHandshake, hello.version, clientKeyExchange.BytesOrPanic())
+	if !shortened {
+		// the Finished message can not be decrypted by the server
+		finished := make([]byte, 64)
+		if _, err := rand.Read(finished); err != nil {
+			return "", err
+		}
+		records = concatBytes(records,
+			marshalRecord(recordTypeChangeCipherSpec, hello.version, []byte{1}),
+			marshalRecord(recordTypeHandshake, hello.version, finished),
+		)
+	}
+	if _, err := conn.Write(records); err != nil {
+		return "", err
+	}
+	return strings.Join(observeResponse(conn), " "), nil
+}
+
+type robotResponse struct {
+	response string
+	err      error
+}
+
+/*
+REQUIRED: The server is not vulnerable to ROBOT (Return Of Bleichenbacher's Oracle Threat)
+
+	Premaster secrets with a correct and with four different kinds of broken PKCS#1 v1.5 padding are sent using the RSA key exchange.
+	The server is vulnerable, if it responds differently to them - the responses act as padding oracle.
+	The probe is done with the full message flow (ClientKeyExchange, ChangeCipherSpec and Finished) and the shortened message flow (just the ClientKeyExchange).
+	A server, which does not support the RSA key exchange, is not vulnerable.
+
+Source: https://robotattack.org/
+*/
+func robot(ctx context.Context, target Target) AnalysisResult {
+	start := time.Now()
+	// do not probe the bsi - our ip will be blocked
+	if bsiNet.Contains(target.IPV4Address) {
+		return NewAnalysisResult(Unknown, nil, nil, nil, time.Since(start))
+	}
+
+	// check if the server does support the rsa key exchange at all
+	conn, _, messages, err := startHandshake(ctx, target, rsaKeyExchangeCipherSuites, nil)
+	if errors.Is(err, errHandshakeAlert) {
+		return NewAnalysisResult(Success, map[string]any{
+			"rsaKeyExchange": false,
+		}, nil, nil, time.Since(start))
+	}
+	if err != nil {
+		return NewAnalysisResult(Unknown, map[string]any{"error": err.Error()}, nil, nil, time.Since(start))
+	}
+	conn.Close()
+	if _, err := rsaPublicKey(messages[handshakeTypeCertificate]); err != nil {
+		return NewAnalysisResult(Unknown, map[string]any{"error": err.Error()}, nil, nil, time.Since(start))
+	}
+
+	// the correct variant is sent twice - the responses of the server need to be stable
+	variants := append([]robotVariant{robotVariants[0]}, robotVariants...)
+	var responses map[string]string
+	for _, shortened := range []bool{false, true} {
+		results := concurrency.All(utils.Map(variants, func(variant robotVariant) func() robotResponse {
+			return func() robotResponse {
+				response, err := robotProbe(ctx, target, variant, shortened)
+				return robotResponse{response: response, err: err}
+			}
+		})...)
+
+		messageFlow := "full"
+		if shortened {
+			messageFlow = "shortened"
+		}
+		responses = make(map[string]string)
+		for i, result := range results[1:] {
+			if result.err != nil {
+				return NewAnalysisResult(Unknown, map[string]any{"error": result.err.Error()}, nil, nil, time.Since(start))
+			}
+			responses[variants[i+1].name] = result.response
+		}
+		actualValue := map[string]any{
+			"rsaKeyExchange": true,
+			"messageFlow":    messageFlow,
+			"responses":      responses,
+		}
+
+		if results[0].response != results[1].response {
+			// the server does not respond consistently - no statement is possible
+			return NewAnalysisResult(Unknown, actualValue, nil, nil, time.Since(start))
+		}
+		if !utils.Every(results, func(result robotResponse) bool { return result.response == results[0].response }) {
+			return NewAnalysisResult(Failure, actualValue, nil, nil, time.Since(start))
+		}
+	}
+
+	return NewAnalysisResult(Success, map[string]any{
+		"rsaKeyExchange": true,
+		"responses":      responses,
+	}, nil, nil, time.Since(start))
+}
@@ -0,0 +1,110 @@
+package scanner
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"golang.org/x/crypto/cryptobyte"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/tlsclient"
+)
+
+func vulnerabilityProbeTarget(t *testing.T, rawURL string) Target {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Target{URL: target, IPV4Address: net.ParseIP(target.Hostname()), Options: TargetScanOptions{
+		TlsClient: tlsclient.NewDefaultClient(),
+		EnabledChecks: map[AnalysisRuleId]bool{
+			Heartbleed:   true,
+			CCSInjection: true,
+			ROBOT:        true,
+		},
+	}}
+}
+
+func TestVulnerabilityProbes(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{
+		MaxVersion: tls.VersionTLS12,
+		// the rsa key exchange is required to probe for ROBOT
+		CipherSuites: []uint16{tls.TLS_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	res, err := NewTLSAnalyzer().Analyze(context.Background(), vulnerabilityProbeTarget(t, server.URL), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, check := range VulnerabilityProbes {
+		if !res[check].IsSuccess() {
+			t.Errorf("Expected %s to succeed, got %+v", check, res[check])
+		}
+	}
+	if res[ROBOT].ActualValue.(map[string]any)["rsaKeyExchange"] != true {
+		t.Errorf("Expected the rsa key exchange to be probed, got %+v", res[ROBOT])
+	}
+}
+
+// a server, which answers every heartbeat request - even the malformed one
+func TestHeartbleed(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		if _, err := readHandshakeMessages(conn, handshakeTypeClientHello); err != nil {
+			return
+		}
+		var hello cryptobyte.Builder
+		hello.AddUint8(handshakeTypeServerHello)
+		hello.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddUint16(tls.VersionTLS12)
+			b.AddBytes(make([]byte, 32))
+			b.AddUint8(0)
+			b.AddUint16(tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256)
+			b.AddUint8(0)
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				b.AddUint16(extensionHeartbeat)
+				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+					b.AddUint8(1)
+				})
+			})
+		})
+		// ServerHelloDone
+		hello.AddBytes([]byte{handshakeTypeServerHelloDone, 0, 0, 0})
+		if _, err := conn.Write(marshalRecord(recordTypeHandshake, tls.VersionTLS12, hello.BytesOrPanic())); err != nil {
+			return
+		}
+
+		record, err := readRecord(conn)
+		if err != nil || record.contentType != recordTypeHeartbeat {
+			return
+		}
+		// heartbeat_response leaking 16 bytes of memory
+		conn.Write(marshalRecord(recordTypeHeartbeat, tls.VersionTLS12, append([]byte{2, 0x00, 0x10}, make([]byte, 16+16)...))) // nolint // the test fails, if the response is missing
+	}()
+
+	actual := heartbleed(context.Background(), vulnerabilityProbeTarget(t, "https://"+listener.Addr().String()))
+	if !actual.IsError() {
+		t.Fatalf("Expected heartbleed to fail, got %+v", actual)
+	}
+}
@@ -0,0 +1,323 @@
+package scanner
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"time"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/concurrency"
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/tlsclient"
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+// the clauses of the BSI TR-03116-4, which are reported as violated
+const (
+	TLS12NotSupported                = "tls12NotSupported"
+	DeprecatedProtocolSupported      = "deprecatedProtocolSupported"
+	NoAllowedCipherSuite             = "noAllowedCipherSuite"
+	CipherSuiteNotAllowed            = "cipherSuiteNotAllowed"
+	CipherSuiteOrderNotEnforced      = "cipherSuiteOrderNotEnforced"
+	NoAllowedKeyExchangeGroup        = "noAllowedKeyExchangeGroup"
+	CertificateKeyTooWeak            = "certificateKeyTooWeak"
+	OCSPStaplingNotSupported         = "ocspStaplingNotSupported"
+	ExtendedMasterSecretNotSupported = "extendedMasterSecretNotSupported"
+	SecureRenegotiationNotSupported  = "secureRenegotiationNotSupported"
+	EncryptThenMACNotSupported       = "encryptThenMacNotSupported"
+	TruncatedHMACSupported           = "truncatedHmacSupported"
+	HeartbeatSupported               = "heartbeatSupported"
+)
+
+const (
+	TLS13NotSupported = "tls13NotSupported"
+)
+
+// the TLS 1.2 cipher suites allowed by BSI TR-03116-4 (referencing BSI TR-02102-2).
+// the order of the list is the prescribed preference: elliptic curve before finite field diffie-hellman and AEAD before CBC.
+// the ids are used directly, since golang does not implement the DHE and CBC-SHA384 suites.
+// REF: https://www.bsi.bund.de/DE/Themen/Unternehmen-und-Organisationen/Standards-und-Zertifizierung/Technische-Richtlinien/TR-nach-Thema-sortiert/tr03116/TR-03116_node.html
+var tr03116TLS12CipherSuites = []uint16{
+	0xC02B, // TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256
+	0xC02C, // TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384
+	0xC02F, // TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+	0xC030, // TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384
+	0xC023, // TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256
+	0xC024, // TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA384
+	0xC027, // TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256
+	0xC028, // TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA384
+	0x009E, // TLS_DHE_RSA_WITH_AES_128_GCM_SHA256
+	0x009F, // TLS_DHE_RSA_WITH_AES_256_GCM_SHA384
+	0x0067, // TLS_DHE_RSA_WITH_AES_128_CBC_SHA256
+	0x006B, // TLS_DHE_RSA_WITH_AES_256_CBC_SHA256
+}
+
+var tr03116CipherSuiteNames = map[uint16]string{
+	0xC02B: "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	0xC02C: "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	0xC02F: "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	0xC030: "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+	0xC023: "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256",
+	0xC024: "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA384",
+	0xC027: "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256",
+	0xC028: "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA384",
+	0x009E: "TLS_DHE_RSA_WITH_AES_128_GCM_SHA256",
+	0x009F: "TLS_DHE_RSA_WITH_AES_256_GCM_SHA384",
+	0x0067: "TLS_DHE_RSA_WITH_AES_128_CBC_SHA256",
+	0x006B: "TLS_DHE_RSA_WITH_AES_256_CBC_SHA256",
+}
+
+// the CBC suites of the list above - encrypt_then_mac needs to be negotiated, if one of them is used
+var tr03116CBCCipherSuites = []uint16{0xC023, 0xC024, 0xC027, 0xC028, 0x0067, 0x006B}
+
+var tr03116TLS13CipherSuites = []uint16{
+	tls.TLS_AES_128_GCM_SHA256,
+	tls.TLS_AES_256_GCM_SHA384,
+	0x1304, // TLS_AES_128_CCM_SHA256 - not supported by golang
+}
+
+// the elliptic curves allowed for the key exchange, which can be probed using golang (brainpool curves are not supported)
+var tr03116KeyExchangeGroups = []keyExchangeGroup{
+	{id: tls.CurveP256, name: "secp256r1"},
+	{id: tls.CurveP384, name: "secp384r1"},
+	{id: tls.CurveP521, name: "secp521r1"},
+}
+
+func cipherSuiteName(id uint16) string {
+	if name, ok := tr03116CipherSuiteNames[id]; ok {
+		return name
+	}
+	return tls.CipherSuiteName(id)
+}
+
+// maps the error of a handshake probe to the usual tri-state
+func probeDidPass(ctx context.Context, err error) DidPass {
+	if err == nil {
+		return Success
+	}
+	if errors.Is(err, tlsclient.ErrProxyConnectionFailed) || ctx.Err() != nil {
+		return Unknown
+	}
+	return Failure
+}
+
+type tr03116Evaluation struct {
+	violatedClauses []string
+	unknownClauses  []string
+	recommendations []string
+	details         map[string]any
+}
+
+func (e *tr03116Evaluation) evaluate(clause string, didPass DidPass) {
+	if didPass == Unknown {
+		e.unknownClauses = append(e.unknownClauses, clause)
+	} else if !*didPass && !utils.Includes(e.violatedClauses, clause) {
+		e.violatedClauses = append(e.violatedClauses, clause)
+	}
+}
+
+// evaluates a clause, which is violated if the server accepted the probe
+func (e *tr03116Evaluation) evaluateRejected(clause string, accepted DidPass) {
+	if accepted == Unknown {
+		e.evaluate(clause, Unknown)
+		return
+	}
+	e.evaluate(clause, ptr(!*accepted))
+}
+
+type serverHelloProbe struct {
+	hello serverHello
+	err   error
+}
+
+// probes the cipher suites and the extensions of TLS 1.2.
+// the allowed suites are offered in reverse order - a server which enforces the prescribed order still picks the most preferred suite it supports.
+func (e *tr03116Evaluation) evaluateTLS12Handshake(ctx context.Context, target Target) {
+	reversed := make([]uint16, len(tr03116TLS12CipherSuites))
+	for i, suite := range tr03116TLS12CipherSuites {
+		reversed[len(reversed)-1-i] = suite
+	}
+
+	notAllowed := utils.Filter(probeCipherSuites, func(suite uint16) bool {
+		return !utils.Includes(tr03116TLS12CipherSuites, suite)
+	})
+
+	res := concurrency.All(
+		func() serverHelloProbe {
+			hello, err := probeServerHello(ctx, target, reversed, []clientHelloExtension{
+				{id: extensionExtendedMasterSecret, data: []byte{}},
+				// empty renegotiated_connection (RFC5746 Section 3.4)
+				{id: extensionRenegotiationInfo, data: []byte{0}},
+				{id: extensionEncryptThenMAC, data: []byte{}},
+				// peer_allowed_to_send (RFC6520 Section 2)
+				{id: extensionHeartbeat, data: []byte{1}},
+				{id: extensionTruncatedHMAC, data: []byte{}},
+			})
+			return serverHelloProbe{hello: hello, err: err}
+		},
+		func() serverHelloProbe {
+			hello, err := probeServerHello(ctx, target, notAllowed, nil)
+			return serverHelloProbe{hello: hello, err: err}
+		},
+	)
+	allowed, disallowed := res[0], res[1]
+
+	if disallowed.err == nil {
+		e.details["notAllowedCipherSuite"] = cipherSuiteName(disallowed.hello.cipherSuite)
+	}
+	e.evaluateRejected(CipherSuiteNotAllowed, probeDidPass(ctx, disallowed.err))
+
+	didPass := probeDidPass(ctx, allowed.err)
+	e.evaluate(NoAllowedCipherSuite, didPass)
+	if didPass == Unknown || !*didPass {
+		return
+	}
+
+	hello := allowed.hello
+	e.details["negotiatedCipherSuite"] = cipherSuiteName(hello.cipherSuite)
+	e.evaluate(ExtendedMasterSecretNotSupported, ptr(hello.hasExtension(extensionExtendedMasterSecret)))
+	e.evaluate(SecureRenegotiationNotSupported, ptr(hello.hasExtension(extensionRenegotiationInfo)))
+	e.evaluate(TruncatedHMACSupported, ptr(!hello.hasExtension(extensionTruncatedHMAC)))
+	e.evaluate(HeartbeatSupported, ptr(!hello.hasExtension(extensionHeartbeat)))
+	if utils.Includes(tr03116CBCCipherSuites, hello.cipherSuite) {
+		e.evaluate(EncryptThenMACNotSupported, ptr(hello.hasExtension(extensionEncryptThenMAC)))
+	}
+
+	// check if the server supports a suite, which is preferred over the negotiated one
+	index := 0
+	for i, suite := range tr03116TLS12CipherSuites {
+		if suite == hello.cipherSuite {
+			index = i
+		}
+	}
+	if index == 0 {
+		e.evaluate(CipherSuiteOrderNotEnforced, Success)
+		return
+	}
+	_, err := probeServerHello(ctx, target, tr03116TLS12CipherSuites[:index], nil)
+	e.evaluateRejected(CipherSuiteOrderNotEnforced, probeDidPass(ctx, err))
+}
+
+/*
+BSI TR-03116-4 compliance
+
+	REQUIRED: TLS 1.2 is supported - TLS 1.0 and TLS 1.1 are not supported
+	REQUIRED: only the cipher suites of the TR are accepted and the server picks them in the prescribed order
+	REQUIRED: at least one of the allowed elliptic curves is supported for the key exchange
+	REQUIRED: the key of the certificate fulfills BSI TR-02102
+	REQUIRED: the server staples an OCSP response
+	REQUIRED: extended_master_secret and renegotiation_info are supported, encrypt_then_mac is supported if a CBC suite is negotiated
+	REQUIRED: heartbeat and truncated_hmac are not supported
+	RECOMMENDED: TLS 1.3 is supported (only with the TLS 1.3 cipher suites of the TR)
+
+REF: https://www.bsi.bund.de/DE/Themen/Unternehmen-und-Organisationen/Standards-und-Zertifizierung/Technische-Richtlinien/TR-nach-Thema-sortiert/tr03116/TR-03116_node.html
+*/
+func tr03116Compliance(ctx context.Context, target Target, state *tls.ConnectionState) AnalysisResult {
+	start := time.Now()
+	if state == nil {
+		conn, err := tlsConnect(ctx, target, nil)
+		if err != nil {
+			if state = clientAuthRequiredState(err); state == nil {
+				return NewAnalysisResult(Unknown, nil, nil, nil, time.Since(start))
+			}
+		} else {
+			defer conn.Close()
+			res := conn.(*tls.Conn).ConnectionState()
+			state = &res
+		}
+	}
+
+	evaluation := tr03116Evaluation{
+		violatedClauses: make([]string, 0),
+		unknownClauses:  make([]string, 0),
+		recommendations: make([]string, 0),
+		details:         make(map[string]any),
+	}
+
+	res := concurrency.All(append([]func() DidPass{
+		func() DidPass {
+			return tlsVersionSupported(ctx, target, tls.VersionTLS12)
+		},
+		func() DidPass {
+			return tlsVersionSupported(ctx, target, tls.VersionTLS13)
+		},
+		func() DidPass {
+			return deprecatedTLSDeactivated(ctx, target).DidPass
+		},
+	}, utils.Map(tr03116KeyExchangeGroups, func(group keyExchangeGroup) func() DidPass {
+		return func() DidPass {
+			return keyExchangeGroupSupported(ctx, target, tls.VersionTLS12, group.id)
+		}
+	})...)...)
+
+	tls12, tls13, deprecatedDeactivated := res[0], res[1], res[2]
+	evaluation.evaluate(TLS12NotSupported, tls12)
+	evaluation.evaluate(DeprecatedProtocolSupported, deprecatedDeactivated)
+	if tls13 != Unknown && !*tls13 {
+		evaluation.recommendations = append(evaluation.recommendations, TLS13NotSupported)
+	}
+	if state.Version == tls.VersionTLS13 {
+		evaluation.details["negotiatedTLS13CipherSuite"] = tls.CipherSuiteName(state.CipherSuite)
+		evaluation.evaluate(CipherSuiteNotAllowed, ptr(utils.Includes(tr03116TLS13CipherSuites, state.CipherSuite)))
+	}
+
+	supportedGroups := make([]string, 0)
+	unknownGroups := false
+	for i, didPass := range res[3:] {
+		if didPass == Unknown {
+			unknownGroups = true
+		} else if *didPass {
+			supportedGroups = append(supportedGroups, tr03116KeyExchangeGroups[i].name)
+		}
+	}
+	evaluation.details["supportedGroups"] = supportedGroups
+	if len(supportedGroups) == 0 && unknownGroups {
+		evaluation.evaluate(NoAllowedKeyExchangeGroup, Unknown)
+	} else {
+		evaluation.evaluate(NoAllowedKeyExchangeGroup, ptr(len(supportedGroups) > 0))
+	}
+
+	// the handshake probes are only meaningful, if the server does support TLS 1.2 at all
+	if tls12 != Unknown && *tls12 {
+		evaluation.evaluateTLS12Handshake(ctx, target)
+	}
+
+	if len(state.PeerCertificates) > 0 {
+		keyStrength := isStrongPrivateKey(state.PeerCertificates[0], bsiTR02102Policy(time.Now().Year()))
+		evaluation.details["certificateKey"] = keyStrength.ActualValue
+		evaluation.evaluate(CertificateKeyTooWeak, keyStrength.DidPass)
+	}
+	evaluation.evaluate(OCSPStaplingNotSupported, ptr(len(state.OCSPResponse) > 0))
+
+	actualValue := map[string]any{
+		"violatedClauses": evaluation.violatedClauses,
+		"unknownClauses":  evaluation.unknownClauses,
+		"details":         evaluation.details,
+	}
+	if len(evaluation.violatedClauses) > 0 {
+		return NewAnalysisResult(Failure, actualValue, evaluation.violatedClauses, evaluation.recommendations, time.Since(start))
+	}
+	if len(evaluation.unknownClauses) > 0 {
+		return NewAnalysisResult(Unknown, actualValue, nil, evaluation.recommendations, time.Since(start))
+	}
+	return NewAnalysisResult(Success, actualValue, nil, evaluation.recommendations, time.Since(start))
+}
+
+type tr03116Analyzer struct {
+}
+
+func NewTR03116Analyzer() analyzer[*tls.ConnectionState] {
+	return tr03116Analyzer{}
+}
+
+func (t tr03116Analyzer) GetAnalysisRuleIds() []AnalysisRuleId {
+	return []AnalysisRuleId{
+		TR03116Compliance,
+	}
+}
+
+// accepts an existing tls connection state to reuse it for the certificate and the OCSP stapling clauses
+func (t tr03116Analyzer) Analyze(ctx context.Context, target Target, state *tls.ConnectionState) (map[AnalysisRuleId]AnalysisResult, error) {
+	return map[AnalysisRuleId]AnalysisResult{
+		TR03116Compliance: maybeDoCheck(TR03116Compliance, target.Options, func() AnalysisResult { return tr03116Compliance(ctx, target, state) }),
+	}, nil
+}
@@ -0,0 +1,110 @@
+package scanner
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/tlsclient"
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+)
+
+func TestTR03116Compliance(t *testing.T) {
+	insecureSkipVerify = true
+	leaf := issueTestCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "example.com"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+	}, nil)
+
+	table := []struct {
+		name                    string
+		tlsConfig               *tls.Config
+		expectedDidPass         DidPass
+		expectedViolatedClauses []string
+	}{
+		{
+			name: "compliant",
+			tlsConfig: &tls.Config{
+				MinVersion: tls.VersionTLS12,
+				CipherSuites: []uint16{
+					tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+					tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+				},
+				Certificates: []tls.Certificate{{
+					Certificate: [][]byte{leaf.cert.Raw},
+					PrivateKey:  leaf.key,
+					// the content of the response is not evaluated
+					OCSPStaple: []byte{1},
+				}},
+			},
+			expectedDidPass:         Success,
+			expectedViolatedClauses: []string{},
+		},
+		{
+			name:            "default configuration",
+			tlsConfig:       &tls.Config{MinVersion: tls.VersionTLS12},
+			expectedDidPass: Failure,
+			// the default certificate of httptest uses a RSA 2048 key
+			expectedViolatedClauses: []string{CipherSuiteNotAllowed, OCSPStaplingNotSupported, CertificateKeyTooWeak},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			server.TLS = test.tlsConfig
+			server.StartTLS()
+			defer server.Close()
+
+			target, _ := url.Parse(server.URL)
+
+			res, _ := NewTR03116Analyzer().Analyze(context.Background(), Target{URL: target, IPV4Address: net.ParseIP(target.Hostname()), Options: TargetScanOptions{
+				TlsClient: tlsclient.NewDefaultClient(),
+				EnabledChecks: map[AnalysisRuleId]bool{
+					TR03116Compliance: true,
+				},
+			}}, nil)
+
+			actual := res[TR03116Compliance]
+			if test.expectedDidPass == Success && !actual.IsSuccess() || test.expectedDidPass == Failure && !actual.IsError() {
+				t.Fatalf("Expected %v, got %+v", *test.expectedDidPass, actual)
+			}
+			if len(actual.Errors) != len(test.expectedViolatedClauses) || !utils.IncludesSubset(actual.Errors, test.expectedViolatedClauses) {
+				t.Errorf("Expected the violated clauses %v, got %v", test.expectedViolatedClauses, actual.Errors)
+			}
+		})
+	}
+}
+
+func TestParseServerHello(t *testing.T) {
+	var b []byte
+	b = append(b, 0x03, 0x03)
+	b = append(b, make([]byte, 32)...)
+	// empty session id, cipher suite and null compression
+	b = append(b, 0, 0xC0, 0x2F, 0)
+	// extended_master_secret and renegotiation_info
+	b = append(b, 0, 9, 0, 23, 0, 0, 0xff, 0x01, 0, 1, 0)
+
+	hello, err := parseServerHello(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hello.version != tls.VersionTLS12 || hello.cipherSuite != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("Expected TLS 1.2 and TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, got %x and %x", hello.version, hello.cipherSuite)
+	}
+	if !hello.hasExtension(extensionExtendedMasterSecret) || !hello.hasExtension(extensionRenegotiationInfo) || hello.hasExtension(extensionHeartbeat) {
+		t.Errorf("Expected only extended_master_secret and renegotiation_info, got %v", hello.extensions)
+	}
+
+	if _, err := parseServerHello(b[:20]); err == nil {
+		t.Errorf("Expected an error for a truncated server hello")
+	}
+}
@@ -1,5 +1,7 @@
 package scanner
 
+import "gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
+
 type FnMap[Param any] map[string]func(param Param) bool
 
 type validator[Param any] struct {
@@ -37,3 +39,18 @@ func (v validator[Param]) Validate(data Param) (*bool, []string, []string) {
 
 	return &didPass, errors, recommendations
 }
+
+// validates every param and returns only the errors and recommendations, which are found for every param
+func (v validator[Param]) validateAll(params []Param) (*bool, []string, []string) {
+	var errors, recommendations []string
+	for i, param := range params {
+		_, e, r := v.Validate(param)
+		if i == 0 {
+			errors, recommendations = e, r
+			continue
+		}
+		errors = utils.Filter(errors, func(id string) bool { return utils.Includes(e, id) })
+		recommendations = utils.Filter(recommendations, func(id string) bool { return utils.Includes(r, id) })
+	}
+	return ptr(len(errors) == 0), errors, recommendations
+}
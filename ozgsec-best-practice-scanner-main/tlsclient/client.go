@@ -24,3 +24,10 @@ func (p defaultClient) Get(ctx context.Context, target *url.URL, tlsConfig *tls.
 	}
 	return conn, nil
 }
+
+// Dial establishes a plain tcp connection without a tls handshake.
+// it is used for handshake probes, which are not supported by crypto/tls.
+func (p defaultClient) Dial(ctx context.Context, target *url.URL) (net.Conn, error) {
+	dialer := &net.Dialer{}
+	return dialer.DialContext(ctx, "tcp", target.Hostname()+":"+target.Port())
+}
@@ -76,3 +76,21 @@ func (p socks5) Get(ctx context.Context, target *url.URL, tlsConfig *tls.Config)
 		return res.conn, res.err
 	}
 }
+
+// Dial establishes a plain tcp connection through the proxy without a tls handshake.
+// it is used for handshake probes, which are not supported by crypto/tls.
+func (p socks5) Dial(ctx context.Context, target *url.URL) (net.Conn, error) {
+	dialer, err := proxy.SOCKS5("tcp", p.serverURL, p.auth, &net.Dialer{
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		return nil, errors.Join(err, ErrProxyConnectionFailed)
+	}
+
+	// the socks5 dialer supports a context - a connection is never established after the context is done
+	contextDialer, ok := dialer.(proxy.ContextDialer)
+	if !ok {
+		return nil, ErrProxyConnectionFailed
+	}
+	return contextDialer.DialContext(ctx, "tcp", target.Hostname()+":"+target.Port())
+}
@@ -0,0 +1,44 @@
+package tlsclient
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSOCKS5DialCancelled(t *testing.T) {
+	// the proxy accepts the connection but never answers the greeting
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	closed := make(chan struct{})
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(io.Discard, conn) // nolint // returns, once the client closes the connection
+		close(closed)
+	}()
+
+	proxyURL, _ := url.Parse("socks5://" + listener.Addr().String())
+	target, _ := url.Parse("https://example.test:443")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if conn, err := NewSOCKS5(proxyURL).Dial(ctx, target); err == nil {
+		conn.Close()
+		t.Fatal("Expected the dial to fail")
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Error("Expected the connection to the proxy to be closed")
+	}
+}
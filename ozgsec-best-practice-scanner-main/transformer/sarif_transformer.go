@@ -9,6 +9,7 @@ import (
 
 	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/sarif"
 	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/scanner"
+	"gitlab.opencode.de/bmi/ozg-rahmenarchitektur/ozgsec/ozgsec-best-practice-scanner/utils"
 )
 
 var mapping = map[scanner.AnalysisRuleId]sarif.ReportingDescriptor{
@@ -30,42 +31,91 @@ var mapping = map[scanner.AnalysisRuleId]sarif.ReportingDescriptor{
 		Id:   string(scanner.DKIM),
 		Name: ptr("DKIM"),
 		FullDescription: &sarif.MultiformatMessageString{
-			Text: "Checks if the domain has a DKIM record. RFC6376 (https://www.rfc-editor.org/rfc/rfc6376).",
+			Text: "Checks the DKIM keys of the domain. RFC6376 (https://www.rfc-editor.org/rfc/rfc6376). The selectors of common mail providers and the selectors configured for the domain are looked up. For every key found, the key type and length are reported. Invalid records, RSA keys shorter than 1024 bit (RFC8301) and domains, which only publish revoked keys, are reported as errors. RSA keys shorter than 2048 bit and keys in test mode are reported as recommendations. If no selector is found, the result is unknown.",
 		},
 	},
 	scanner.DMARC: {
 		Id:   string(scanner.DMARC),
 		Name: ptr("DMARC"),
 		FullDescription: &sarif.MultiformatMessageString{
-			Text: "Checks if the domain has a DMARC record. RFC7489 (https://www.rfc-editor.org/rfc/rfc7489).",
+			Text: "Checks if the domain has a valid DMARC record. RFC7489 (https://www.rfc-editor.org/rfc/rfc7489). If the hostname does not publish a record, the record of the organizational domain (public suffix list) is used. The tags p, sp, pct, adkim, aspf, rua, ruf and fo are parsed. Syntax errors, invalid report URIs, multiple records and report receivers of another domain without an authorization record are reported as errors. A policy of none, a partial percentage and missing aggregate reports are reported as recommendations.",
 		},
 	},
 	scanner.SPF: {
 		Id:   string(scanner.SPF),
 		Name: ptr("SPF"),
 		FullDescription: &sarif.MultiformatMessageString{
-			Text: "Checks if the domain has a SPF record. RFC7208 (https://www.rfc-editor.org/rfc/rfc7208).",
+			Text: "Checks if the domain has a valid SPF record. RFC7208 (https://www.rfc-editor.org/rfc/rfc7208). The record is evaluated recursively (include, redirect, a, mx and exists). Multiple records, syntax errors, more than 10 DNS lookups or 2 void lookups, loops, missing included records and \"+all\" are reported as errors. \"~all\", \"?all\" and the ptr mechanism are reported as recommendations.",
 		},
 	},
 	scanner.DANE: {
 		Id:   string(scanner.DANE),
 		Name: ptr("DANE"),
 		FullDescription: &sarif.MultiformatMessageString{
-			Text: "Checks if the domain has a DANE record. RFC6698 (https://www.rfc-editor.org/rfc/rfc6698).",
+			Text: "Checks if the TLSA records of the MX hosts match the certificates presented using STARTTLS. RFC6698 (https://www.rfc-editor.org/rfc/rfc6698), RFC7671 (https://www.rfc-editor.org/rfc/rfc7671). The full certificate or the DER encoded SubjectPublicKeyInfo is compared (exact, SHA-256 or SHA-512). DANE-EE records are matched against the leaf, DANE-TA records against the presented chain including a name check. PKIX-TA and PKIX-EE records additionally require a valid PKIX path. The match details of every record are reported. DANE requires DNSSEC.",
+		},
+	},
+	scanner.MTASTS: {
+		Id:   string(scanner.MTASTS),
+		Name: ptr("MTA-STS"),
+		FullDescription: &sarif.MultiformatMessageString{
+			Text: "Checks if the domain publishes a valid MTA-STS policy. RFC8461 (https://www.rfc-editor.org/rfc/rfc8461). The _mta-sts TXT record is checked and the policy is fetched from https://mta-sts.<domain>/.well-known/mta-sts.txt without following redirects. A missing or invalid record or policy, the mode none and MX records, which are not covered by the mx patterns of the policy, are reported as errors. The mode testing and a max_age shorter than one week are reported as recommendations.",
+		},
+	},
+	scanner.TLSRPT: {
+		Id:   string(scanner.TLSRPT),
+		Name: ptr("SMTP TLS Reporting"),
+		FullDescription: &sarif.MultiformatMessageString{
+			Text: "Checks if the domain publishes a valid SMTP TLS Reporting (TLS-RPT) record at _smtp._tls.<domain>. RFC8460 (https://www.rfc-editor.org/rfc/rfc8460). The record needs to start with v=TLSRPTv1 and to contain a rua field with mailto: or https: URIs.",
+		},
+	},
+	scanner.MXHygiene: {
+		Id:   string(scanner.MXHygiene),
+		Name: ptr("MX Host Hygiene"),
+		FullDescription: &sarif.MultiformatMessageString{
+			Text: "Checks the MX records of the domain. RFC5321 (https://www.rfc-editor.org/rfc/rfc5321). MX records pointing to IP literals or CNAMEs, MX hosts without A or AAAA records and IPs without forward-confirmed reverse DNS are reported as errors. A hostname in the SMTP greeting, which matches neither the MX host nor its reverse DNS name, is reported as a recommendation. A null MX (RFC7505) is a valid configuration of a domain, which does not accept mail, as long as it is the only MX record.",
+		},
+	},
+	scanner.Nameservers: {
+		Id:   string(scanner.Nameservers),
+		Name: ptr("Nameserver Health"),
+		FullDescription: &sarif.MultiformatMessageString{
+			Text: "Queries the nameservers of the zone, which contains the hostname, directly. RFC2182 (https://www.rfc-editor.org/rfc/rfc2182). Less than two nameservers, nameservers, which do not answer authoritatively (lame delegation), differing SOA serials and nameservers located in a single /24 (/48 for IPv6) network or a single autonomous system are reported as errors. Open recursion and zone transfers are probed by nameserverProbes.",
+		},
+	},
+	scanner.NameserverProbes: {
+		Id:   string(scanner.NameserverProbes),
+		Name: ptr("Nameserver Probes"),
+		FullDescription: &sarif.MultiformatMessageString{
+			Text: "Sends a recursive query for a name of another zone and a zone transfer request (AXFR) to every nameserver of the zone, which contains the hostname. Open recursion (RFC5358) and zone transfers allowed to anyone (RFC5936) are reported as errors. The probe is disabled by default, since some providers flag these requests as attacks.",
+		},
+	},
+	scanner.SubdomainTakeover: {
+		Id:   string(scanner.SubdomainTakeover),
+		Name: ptr("Subdomain Takeover"),
+		FullDescription: &sarif.MultiformatMessageString{
+			Text: "Follows the CNAME chains of the hostname and of the configured subdomains. CNAME chains ending in a non-existing name (dangling CNAME) and CNAME chains pointing to deleted resources of takeover-prone services (NXDOMAIN or a known error page) are reported as errors including the evidence. The signatures of the services can be replaced using a local signature file (TAKEOVER_SIGNATURES). Based on https://github.com/EdOverflow/can-i-take-over-xyz.",
+		},
+	},
+	scanner.HTTPSRecord: {
+		Id:   string(scanner.HTTPSRecord),
+		Name: ptr("HTTPS Resource Record"),
+		FullDescription: &sarif.MultiformatMessageString{
+			Text: "Checks if the hostname publishes an HTTPS resource record. RFC9460 (https://www.rfc-editor.org/rfc/rfc9460). AliasMode records are followed and the ech parameter needs to contain a valid ECHConfigList. The alpn, port, ipv4hint and ipv6hint parameters of the records pointing to the scanned host need to match the observed connection (h3 is verified using the Alt-Svc header) and a record containing an ech parameter requires TLS 1.3. The acceptance of Encrypted Client Hello itself is not verified. The check is informational.",
 		},
 	},
 	scanner.ValidCertificate: {
 		Id:   string(scanner.ValidCertificate),
 		Name: ptr("Valid Certificate"),
 		FullDescription: &sarif.MultiformatMessageString{
-			Text: "Checks if the certificate of a website is valid. A certificate is considered valid if it is not expired and if it is yet valid.",
+			Text: "Checks if the certificate of a website is valid. A certificate is considered valid if it is not expired and if it is yet valid. The recommendation expiresSoon is added, if the certificate expires within the configured warning window (CERTIFICATE_EXPIRY_WARNING_DAYS, default 30 days). The recommendation lifetimeExceedsMaximum is added, if the validity period exceeds the maximum of the CA/Browser Forum Baseline Requirements.",
 		},
 	},
 	scanner.ValidCertificateChain: {
 		Id:   string(scanner.ValidCertificateChain),
 		Name: ptr("Signing-Chain of the certificate is valid"),
 		FullDescription: &sarif.MultiformatMessageString{
-			Text: "Checks if the certificate chain is valid. The check is conform to RFC5280 (https://datatracker.ietf.org/doc/html/rfc5280#section-6.1)",
+			Text: "Checks if the certificate chain is valid. The check is conform to RFC5280 (https://datatracker.ietf.org/doc/html/rfc5280#section-6.1). The path is built against the system roots and an optional custom CA bundle (TRUST_STORE_CA_BUNDLE). Missing intermediates are fetched using the authority information access extension and reported together with the trust anchor and the validation error.",
 		},
 	},
 	scanner.MatchesHostname: {
@@ -75,18 +125,49 @@ var mapping = map[scanner.AnalysisRuleId]sarif.ReportingDescriptor{
 			Text: "Checks if the certificate matches the hostname of the website.",
 		},
 	},
+	scanner.CertificateKeyUsage: {
+		Id:   string(scanner.CertificateKeyUsage),
+		Name: ptr("Certificate can be used as TLS server certificate"),
+		FullDescription: &sarif.MultiformatMessageString{
+			Text: "Checks if the key usage of the certificate allows the usage as TLS server certificate (RFC5280 Section 4.2.1.3 and CA/Browser Forum Baseline Requirements Section 7.1.2.7). If present, the KeyUsage needs to contain digitalSignature - keyEncipherment is only allowed for RSA keys, keyCertSign and cRLSign are not allowed. An RSA key with keyEncipherment but without digitalSignature is reported as recommendation, since it can only be used for the RSA key exchange. The ExtendedKeyUsage needs to be present and contain serverAuth. The certificate must not be a CA certificate (BasicConstraints).",
+		},
+	},
+	scanner.LimitedSubjectAltNames: {
+		Id:   string(scanner.LimitedSubjectAltNames),
+		Name: ptr("Certificate is limited to a few names"),
+		FullDescription: &sarif.MultiformatMessageString{
+			Text: "Checks if the certificate contains wildcard names or more subject alternative names than configured (CERTIFICATE_MAX_SUBJECT_ALT_NAMES, default 100). A wildcard or large shared certificate spreads the impact of a compromised key to many services. The check is informational, unless a scan profile marks it as required.",
+		},
+		DefaultConfiguration: &sarif.ReportingConfiguration{
+			Enabled: true,
+			Level:   sarif.ReportingConfigurationLevelNote,
+			Rank:    -1,
+		},
+	},
+	scanner.DefaultCertificate: {
+		Id:   string(scanner.DefaultCertificate),
+		Name: ptr("Default certificate does not reveal other hostnames"),
+		FullDescription: &sarif.MultiformatMessageString{
+			Text: "Checks the certificates served to clients without server name indication and with an unknown server name. They are compared with the certificate served for the hostname. Names of the default certificates, which are not covered by the certificate of the hostname, are reported as leaked. The check is informational, unless a scan profile marks it as required.",
+		},
+		DefaultConfiguration: &sarif.ReportingConfiguration{
+			Enabled: true,
+			Level:   sarif.ReportingConfigurationLevelNote,
+			Rank:    -1,
+		},
+	},
 	scanner.StrongPrivateKey: {
 		Id:   string(scanner.StrongPrivateKey),
 		Name: ptr("Certificate is signed using a strong private key"),
 		FullDescription: &sarif.MultiformatMessageString{
-			Text: "Checks if the certificate is signed using a strong private key. A strong private key is a private RSA key with a bit length of at least 2048 or a DSA key.",
+			Text: "Checks if the key of the certificate is strong according to the selected key strength policy. The policies mozilla-intermediate (https://wiki.mozilla.org/Security/Server_Side_TLS) and BSI TR-02102 for a given year (https://www.bsi.bund.de/EN/Themen/Unternehmen-und-Organisationen/Standards-und-Zertifizierung/Technische-Richtlinien/TR-nach-Thema-sortiert/tr02102/tr02102_node.html) are supported. The size of the RSA modulus, the public exponent, the size of DSA keys and the allowed elliptic curves are checked. The applied policy is reported.",
 		},
 	},
 	scanner.NotRevoked: {
 		Id:   string(scanner.NotRevoked),
 		Name: ptr("Certificate is not revoked"),
 		FullDescription: &sarif.MultiformatMessageString{
-			Text: "Checks if the certificate is not revoked. The check is conform to RFC5280 (https://datatracker.ietf.org/doc/html/rfc5280#section-5.1.2.6)",
+			Text: "Checks if the certificate is not revoked. The check is conform to RFC5280 (https://datatracker.ietf.org/doc/html/rfc5280#section-5.1.2.6) and RFC6960 (https://www.rfc-editor.org/rfc/rfc6960). The stapled OCSP response, the OCSP responders and the CRL distribution points of every certificate in the served chain are consulted. CRLs and OCSP responses are only used if their signature is valid and they are not outdated. The status per certificate and source is reported.",
 		},
 	},
 	scanner.StrongSignatureAlgorithm: {
@@ -100,7 +181,7 @@ var mapping = map[scanner.AnalysisRuleId]sarif.ReportingDescriptor{
 		Id:   string(scanner.CertificateTransparency),
 		Name: ptr("Certificate Transparency"),
 		FullDescription: &sarif.MultiformatMessageString{
-			Text: "Checks if the certificate uses certificate transparency. RFC6962 (https://www.rfc-editor.org/rfc/rfc6962) defines a certificate transparency log as a log which contains all certificates which are issued by a CA. This check does not check if the certificate is in the log, but if the certificate contains the certificate transparency extension, signed certificate timestamps or a OCSP Response.",
+			Text: "Checks if the certificate is logged in certificate transparency logs according to RFC6962 (https://www.rfc-editor.org/rfc/rfc6962). The signed certificate timestamps are collected from the certificate, the TLS extension and the stapled OCSP response. Their signatures are verified against the public keys of a configured CT log list in the Chrome or Apple format. The check passes if valid timestamps of the configured minimum number of distinct logs (default: 2) are present. Without a log list the result is unknown. The verified logs are reported.",
 		},
 	},
 	scanner.SubResourceIntegrity: {
@@ -128,14 +209,14 @@ var mapping = map[scanner.AnalysisRuleId]sarif.ReportingDescriptor{
 		Id:   string(scanner.DNSSec),
 		Name: ptr("DNSSEC"),
 		FullDescription: &sarif.MultiformatMessageString{
-			Text: "Checks if the domain supports DNSSEC. RFC9364 (https://www.rfc-editor.org/rfc/rfc9364).",
+			Text: "Checks if the domain supports DNSSEC. RFC9364 (https://www.rfc-editor.org/rfc/rfc9364). The chain of trust is validated from the root trust anchor down to the zone of the hostname (DNSKEY, DS and RRSIG) and the signatures of the A, AAAA, MX, TLSA and CAA records are verified. The zone, where the chain breaks, and the reason (e.g. a missing DS record or an expired signature) are reported. Deprecated algorithms (RFC8624) and NSEC zone walking exposure are reported as recommendations.",
 		},
 	},
 	scanner.CAA: {
 		Id:   string(scanner.CAA),
 		Name: ptr("CAA"),
 		FullDescription: &sarif.MultiformatMessageString{
-			Text: "Checks if the domain supports CAA. RFC8659 (https://www.rfc-editor.org/rfc/rfc8659.html).",
+			Text: "Checks if the domain supports CAA. The relevant record set is searched by climbing the DNS tree, the properties are validated and the CA, which issued the served certificate, needs to be authorized. RFC8659 (https://www.rfc-editor.org/rfc/rfc8659.html).",
 		},
 	},
 	scanner.HTTPS: {
@@ -184,7 +265,7 @@ var mapping = map[scanner.AnalysisRuleId]sarif.ReportingDescriptor{
 		Id:   string(scanner.ContentSecurityPolicy),
 		Name: ptr("Content Security Policy"),
 		FullDescription: &sarif.MultiformatMessageString{
-			Text: "Checks if the website has a Content Security Policy (CSP) enabled. The Check does not validate the configuration since there is no standard. The check adds recommendations if the default-src is not set to 'self' and if script-src, style-src or img-src are missing.",
+			Text: "Checks if the website enforces a Content Security Policy (CSP) using the Content-Security-Policy header or a <meta http-equiv> element. A policy, which is only reported (Content-Security-Policy-Report-Only), is not sufficient. The check fails if every enforced policy allows 'unsafe-inline' or 'unsafe-eval' scripts without nonces or hashes, wildcard or http: sources or data: scripts. The check adds recommendations if object-src is not set to 'none', if base-uri, frame-ancestors or a reporting endpoint are missing, if the default-src is not set to 'self' and if script-src, style-src or img-src are missing.",
 		},
 	},
 	scanner.HTTP: {
@@ -264,6 +345,51 @@ var mapping = map[scanner.AnalysisRuleId]sarif.ReportingDescriptor{
 			Text: "Checks, if strong cipher suites are used during the TLS handshake. As Strong cipher suites we consider the recommended cipher suites from mozilla: https://wiki.mozilla.org/Security/Server_Side_TLS",
 		},
 	},
+	scanner.PostQuantumKeyExchange: {
+		Id:   string(scanner.PostQuantumKeyExchange),
+		Name: ptr("Post-quantum hybrid key exchange"),
+		FullDescription: &sarif.MultiformatMessageString{
+			Text: "Checks, if the server negotiates a hybrid post-quantum key exchange group (X25519MLKEM768, SecP256r1MLKEM768, SecP384r1MLKEM1024) in TLS 1.3. Each group is offered on its own. The supported groups are reported. The check is informational, unless a scan profile marks it as required.",
+		},
+		DefaultConfiguration: &sarif.ReportingConfiguration{
+			Enabled: true,
+			Level:   sarif.ReportingConfigurationLevelNote,
+			Rank:    -1,
+		},
+	},
+	scanner.TR03116Compliance: {
+		Id:   string(scanner.TR03116Compliance),
+		Name: ptr("BSI TR-03116-4 compliance"),
+		FullDescription: &sarif.MultiformatMessageString{
+			Text: "Checks, if the TLS configuration complies with the BSI TR-03116-4: TLS 1.2 is supported and TLS 1.0/1.1 are not, only the allowed cipher suites are accepted in the prescribed order, an allowed elliptic curve is supported for the key exchange, the certificate key fulfills the BSI TR-02102, an OCSP response is stapled, extended_master_secret and renegotiation_info (and encrypt_then_mac for CBC) are supported and heartbeat and truncated_hmac are not. The violated clauses are reported as error ids. The check is informational, unless a scan profile marks it as required.",
+		},
+		DefaultConfiguration: &sarif.ReportingConfiguration{
+			Enabled: true,
+			Level:   sarif.ReportingConfigurationLevelNote,
+			Rank:    -1,
+		},
+	},
+	scanner.Heartbleed: {
+		Id:   string(scanner.Heartbleed),
+		Name: ptr("Not vulnerable to Heartbleed"),
+		FullDescription: &sarif.MultiformatMessageString{
+			Text: "Checks, if the server is vulnerable to Heartbleed (CVE-2014-0160). A heartbeat request with a payload length exceeding the actual payload is sent during the handshake. A vulnerable server responds to it. The memory of the server is never reported. The probe is disabled by default.",
+		},
+	},
+	scanner.CCSInjection: {
+		Id:   string(scanner.CCSInjection),
+		Name: ptr("Not vulnerable to the OpenSSL CCS injection"),
+		FullDescription: &sarif.MultiformatMessageString{
+			Text: "Checks, if the server is vulnerable to the OpenSSL CCS injection (CVE-2014-0224). An early ChangeCipherSpec message is sent before any key was exchanged. A vulnerable server accepts it. The alerts of the server are reported. The probe is disabled by default.",
+		},
+	},
+	scanner.ROBOT: {
+		Id:   string(scanner.ROBOT),
+		Name: ptr("Not vulnerable to ROBOT"),
+		FullDescription: &sarif.MultiformatMessageString{
+			Text: "Checks, if the server is vulnerable to ROBOT (Return Of Bleichenbacher's Oracle Threat). Premaster secrets with a correct and with broken PKCS#1 v1.5 padding are sent using the RSA key exchange. A vulnerable server responds differently to them. The responses of the server are reported. The probe is disabled by default: https://robotattack.org/",
+		},
+	},
 }
 
 func getRules() []sarif.ReportingDescriptor {
@@ -310,7 +436,16 @@ func findRuleIndex(ruleId scanner.AnalysisRuleId) int {
 	return -1
 }
 
-func transformToSarifResult(results map[scanner.AnalysisRuleId]scanner.AnalysisResult) []sarif.Result {
+// failed informational checks are reported with the level note.
+// every other result keeps the default level.
+func resultLevel(ruleId scanner.AnalysisRuleId, didPass scanner.DidPass, informationalChecks []scanner.AnalysisRuleId) sarif.ResultLevel {
+	if didPass != nil && !*didPass && utils.Includes(informationalChecks, ruleId) {
+		return sarif.ResultLevelNote
+	}
+	return ""
+}
+
+func transformToSarifResult(results map[scanner.AnalysisRuleId]scanner.AnalysisResult, informationalChecks []scanner.AnalysisRuleId) []sarif.Result {
 	var res = make([]sarif.Result, len(results))
 
 	var i = 0
@@ -339,6 +474,7 @@ func transformToSarifResult(results map[scanner.AnalysisRuleId]scanner.AnalysisR
 			RuleId:    ptr(string(ruleId)),
 			RuleIndex: ruleIndex,
 			Kind:      didPassToKind(result.DidPass),
+			Level:     resultLevel(ruleId, result.DidPass, informationalChecks),
 			Message: sarif.Message{
 				Text: ptr(genericMessageString(ruleId, result.DidPass)),
 			},
@@ -381,16 +517,22 @@ func (s sarifTransformer) Transform(input scanner.ScanResponse) ([]byte, error)
 				},
 			},
 			Properties: sarif.PropertyBag{
-				"target":    input.Target,
-				"sut":       input.SUT,
-				"ipAddress": input.IpAddress,
+				"target":             input.Target,
+				"sut":                input.SUT,
+				"ipAddress":          input.IpAddress,
+				"certificateDetails": input.CertificateDetails,
 			},
 		}},
 	}
 
+	// the server asks for a client certificate (mutual TLS)
+	if input.ClientCertRequest != nil {
+		sarifReport.Runs[0].Properties["clientCertificateRequest"] = input.ClientCertRequest
+	}
+
 	// check if there are any results
 	if input.IsSuccess() {
-		sarifReport.Runs[0].Results = transformToSarifResult(input.Result.(map[scanner.AnalysisRuleId]scanner.AnalysisResult))
+		sarifReport.Runs[0].Results = transformToSarifResult(input.Result.(map[scanner.AnalysisRuleId]scanner.AnalysisResult), input.InformationalChecks)
 		sarifReport.Runs[0].Invocations = []sarif.Invocation{{
 			ExecutionSuccessful: true,
 			ExitCode:            ptr(0),